@@ -1,6 +1,13 @@
 #version 410
 
 uniform sampler2D albedoSampler;
+uniform sampler2DArray albedoArraySampler;
+
+// Animated textures have their frames in an array texture
+uniform bool albedoIsArray;
+uniform float albedoFrame;
+
+uniform vec4 tint;
 
 uniform bool shouldDiscard;
 
@@ -11,7 +18,13 @@ out vec4 frag_colour;
 
 void AddAlbedo(inout vec4 fragColour, in sampler2D sampler, in vec2 uv) 
 {
-    fragColour = texture(sampler, uv).rgba;
+    if (albedoIsArray) {
+        fragColour = texture(albedoArraySampler, vec3(uv, albedoFrame)).rgba;
+    } else {
+        fragColour = texture(sampler, uv).rgba;
+    }
+
+    fragColour *= tint;
 }
 
 void main() {
@@ -4,6 +4,10 @@ uniform mat4 projection;
 uniform mat4 view;
 uniform mat4 model;
 
+// Rows of the base texture transform
+uniform vec3 textureTransformS;
+uniform vec3 textureTransformT;
+
 layout(location = 0) in vec3 vertex;
 layout(location = 1) in vec3 normal;
 layout(location = 2) in vec2 uv;
@@ -14,5 +18,5 @@ out vec2 UV;
 void main() {
 	gl_Position = projection * view * model * vec4(vertex, 1.0);
 
-	UV = uv;
+	UV = vec2(dot(textureTransformS, vec3(uv, 1.0)), dot(textureTransformT, vec3(uv, 1.0)));
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"image"
 	_ "image/png"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
 
@@ -18,12 +19,24 @@ import (
 	"github.com/emily33901/go-forgery/render/adapters"
 	"github.com/emily33901/go-forgery/render/cache"
 	"github.com/emily33901/go-forgery/render/view"
+	"github.com/emily33901/go-forgery/settings"
+	"github.com/emily33901/go-forgery/valve/world"
 	"github.com/emily33901/go-forgery/windows"
 	imgui "github.com/emily33901/imgui-go"
-	"github.com/emily33901/lambda-core/core/filesystem"
 	"github.com/emily33901/lambda-core/core/logger"
 )
 
+// textureQualityNames are shown in the view menu, the index is the number of mips that are skipped
+var textureQualityNames = [...]string{
+	"High",
+	"Medium",
+	"Low",
+	"Very Low",
+}
+
+// textureBudgets are the texture budgets in megabytes that can be picked in the view menu
+var textureBudgets = [...]int{0, 256, 512, 1024, 2048, 4096}
+
 type stdOut struct{}
 
 func (log *stdOut) Write(data []byte) (n int, err error) {
@@ -42,7 +55,8 @@ type ImguiRenderer interface {
 }
 
 type ForgeryContext struct {
-	filesystem    filesystem.IFileSystem
+	filesystem    *valve.FileSystem
+	watcher       *valve.Watcher
 	context       *imgui.Context
 	platform      native.Platform
 	imguiRenderer ImguiRenderer
@@ -72,6 +86,26 @@ type ForgeryContext struct {
 	showAboutWindow     bool
 	showMaterialsWindow bool
 	showInfoOverlay     bool
+	showReplaceTextures bool
+	showPasteSpecial    bool
+	showInstances       bool
+	showConfigure       bool
+	showFilesystem      bool
+	showProblems        bool
+	showPack            bool
+	showImportTexture   bool
+	showMaterialEditor  bool
+
+	replaceTexturesWindow *windows.ReplaceTexturesWindow
+	pasteSpecialWindow    *windows.PasteSpecialWindow
+	configureWindow       *windows.ConfigureWindow
+	filesystemWindow      *windows.FileSystemWindow
+	materialsWindow       *windows.MaterialsWindow
+	packWindow            *windows.PackWindow
+	importTextureWindow   *windows.ImportTextureWindow
+	materialEditorWindow  *windows.MaterialEditorWindow
+
+	settings *settings.Settings
 
 	// TODO these really shouldnt be here!
 	cameraSens     float32
@@ -85,22 +119,75 @@ type ForgeryContext struct {
 
 	// Which texture is currently active from the materials window
 	selectedTexture string
+
+	// Clicking on a grouped solid selects the whole group
+	selectGroups bool
+
+	// Entities that were selected from outside of the scene windows
+	// (point entities have no solids to click on)
+	selectedEntities map[int]bool
+
+	// Files that have changed on disk but have not been reloaded yet
+	pendingReloads map[string]struct{}
+
+	// Assets the active map refers to that could not be found
+	problems []*formats.AssetReference
+
+	// func_instances in the active map
+	instances           []*formats.Instance
+	instancesError      string
+	showInstanceContent bool
 }
 
 func (f *ForgeryContext) RenderScene() {
 	for _, s := range f.sceneWindows {
 		s.RenderScene()
 	}
+
+	if f.showMaterialEditor && f.filesystem != nil {
+		f.materialEditorWindow.RenderPreview()
+	}
 }
 
 func (f *ForgeryContext) RenderUI() {
 	// 1. Show the big demo window (Most of the sample code is in ImGui::ShowDemoWindow()!
 	// You can browse its code to learn more about Dear ImGui!).
 
-	if f.platform.IsShiftPressed() && f.platform.KeyWentDown('A') {
+	// Shortcuts are left alone while a text field is being typed in
+	typing := imgui.CurrentIO().WantTextInput()
+
+	if !typing && f.platform.IsShiftPressed() && f.platform.KeyWentDown('A') {
 		f.showMaterialsWindow = !f.showMaterialsWindow
 	}
 
+	if !typing && f.documentLoaded && f.platform.IsCtrlPressed() {
+		if f.platform.KeyWentDown('C') {
+			f.Copy()
+		}
+		if f.platform.KeyWentDown('X') {
+			f.Cut()
+		}
+		if f.platform.KeyWentDown('V') {
+			f.Paste(formats.DefaultPasteOptions())
+		}
+		if f.platform.KeyWentDown('G') {
+			f.Group()
+		}
+		if f.platform.KeyWentDown('U') {
+			f.Ungroup()
+		}
+		if f.platform.KeyWentDown('S') {
+			f.Save(false)
+		}
+		if f.platform.KeyWentDown('H') {
+			if f.platform.IsShiftPressed() {
+				f.UnhideAll()
+			} else {
+				f.HideSelected()
+			}
+		}
+	}
+
 	if !f.texturesLoadingComplete {
 		done := false
 		for i := 0; i < 1000 && !done; i++ {
@@ -123,6 +210,8 @@ func (f *ForgeryContext) RenderUI() {
 		}
 	}
 
+	f.HotReload()
+
 	if f.showDemoWindow {
 		imgui.ShowDemoWindow(&f.showDemoWindow)
 	}
@@ -134,7 +223,19 @@ func (f *ForgeryContext) RenderUI() {
 		f.fpsHistory = f.fpsHistory[1:]
 	}
 
+	cache.UpdateStreaming()
+
+	if f.filesystem != nil {
+		var inUse func() map[string]bool
+		if f.documentLoaded {
+			inUse = f.scene.Materials
+		}
+		cache.UpdateResidency(f.filesystem, inUse)
+	}
+
 	if f.documentLoaded {
+		cache.UpdateProxies()
+
 		for _, window := range f.sceneWindows {
 			// We do this here because we dont have a deltaTime in sceneWindow.Render()
 			window.Camera().Update() // f.deltaTime.Seconds()
@@ -147,28 +248,23 @@ func (f *ForgeryContext) RenderUI() {
 		if imgui.BeginMenu("File") {
 			if imgui.MenuItem("New") {
 			}
-			if imgui.MenuItemV("Open", "Ctrl-O", false, true) {
+			if imgui.MenuItemV("Open", "Ctrl-O", false, f.filesystem != nil) {
 				filename, err := dialog.File().Filter("Hammer map file", "vmf").Load()
-				if err == nil {
-					newMap, err := formats.LoadVmf(filename)
-
-					if err != nil {
-						panic(err)
-					}
-
-					// TODO we need to clean up the old scene and cameras and associated data
-
-					f.activeMap = newMap
-					f.documentLoaded = true
-					f.scene = view.NewSceneFromVmf(f.filesystem, f.activeMap)
+				if err == nil && f.confirmCloseMap(filename) {
+					f.OpenMap(filename)
 				}
 			}
 			if imgui.BeginMenu("Recent") {
 				imgui.EndMenu()
 			}
-			if imgui.MenuItemV("Save", "Ctrl-S", false, true) {
+			if imgui.MenuItemV("Save", "Ctrl-S", false, f.documentLoaded) {
+				f.Save(false)
+			}
+			if imgui.MenuItemV("Save As...", "", false, f.documentLoaded) {
+				f.Save(true)
 			}
-			if imgui.MenuItem("Save As...") {
+			if imgui.MenuItem("Configure...") {
+				f.showConfigure = true
 			}
 			if imgui.BeginMenu("Color Scheme") {
 				if imgui.MenuItem("Light") {
@@ -187,6 +283,38 @@ func (f *ForgeryContext) RenderUI() {
 			imgui.EndMenu()
 		}
 
+		if imgui.BeginMenu("Edit") {
+			if imgui.MenuItemV("Cut", "Ctrl-X", false, f.documentLoaded) {
+				f.Cut()
+			}
+			if imgui.MenuItemV("Copy", "Ctrl-C", false, f.documentLoaded) {
+				f.Copy()
+			}
+			if imgui.MenuItemV("Paste", "Ctrl-V", false, f.documentLoaded) {
+				f.Paste(formats.DefaultPasteOptions())
+			}
+			if imgui.MenuItemV("Paste Special...", "", false, f.documentLoaded) {
+				f.showPasteSpecial = true
+			}
+			imgui.Separator()
+			if imgui.MenuItemV("Group", "Ctrl-G", false, f.documentLoaded) {
+				f.Group()
+			}
+			if imgui.MenuItemV("Ungroup", "Ctrl-U", false, f.documentLoaded) {
+				f.Ungroup()
+			}
+			if imgui.Checkbox("Select whole groups", &f.selectGroups) {
+			}
+			imgui.Separator()
+			if imgui.MenuItemV("Hide Selected", "Ctrl-H", false, f.documentLoaded) {
+				f.HideSelected()
+			}
+			if imgui.MenuItemV("Unhide All", "Ctrl-Shift-H", false, f.documentLoaded) {
+				f.UnhideAll()
+			}
+			imgui.EndMenu()
+		}
+
 		if imgui.BeginMenu("View") {
 			if imgui.MenuItem("New View") {
 				f.NewSceneWindow()
@@ -194,11 +322,60 @@ func (f *ForgeryContext) RenderUI() {
 			if imgui.MenuItem("Material Viewer") {
 				f.showMaterialsWindow = true
 			}
+			if imgui.MenuItem("Filesystem Browser") {
+				f.showFilesystem = true
+			}
+			if imgui.BeginMenu("Texture Quality") {
+				for i, name := range textureQualityNames {
+					if imgui.MenuItemV(name, "", f.settings.TextureQuality == i, true) {
+						f.SetTextureQuality(i)
+					}
+				}
+				imgui.EndMenu()
+			}
+			if imgui.BeginMenu("Texture Budget") {
+				for _, budget := range textureBudgets {
+					name := "Unlimited"
+					if budget != 0 {
+						name = fmt.Sprintf("%d MB", budget)
+					}
+					if imgui.MenuItemV(name, "", f.settings.TextureBudget == budget, true) {
+						f.SetTextureBudget(budget)
+					}
+				}
+				imgui.EndMenu()
+			}
 			if imgui.Checkbox("Overlay", &f.showInfoOverlay) {
 			}
 			imgui.EndMenu()
 		}
 
+		if imgui.BeginMenu("Tools") {
+			if imgui.MenuItem("Replace Textures") {
+				f.showReplaceTextures = true
+			}
+			if imgui.MenuItem("Instances") {
+				f.showInstances = true
+			}
+			if imgui.MenuItemV("Check for problems", "", false, f.documentLoaded) {
+				f.CheckForProblems()
+				f.showProblems = true
+			}
+			if imgui.MenuItemV("Pack map...", "", false, f.documentLoaded) {
+				f.PackDryRun()
+				f.showPack = true
+			}
+			imgui.Separator()
+			if imgui.MenuItemV("Import texture...", "", false, f.filesystem != nil) {
+				f.showImportTexture = true
+			}
+			if imgui.MenuItemV("Edit material...", "", false, f.filesystem != nil && f.selectedTexture != "") {
+				f.materialEditorWindow.Open(f.selectedTexture)
+				f.showMaterialEditor = true
+			}
+			imgui.EndMenu()
+		}
+
 		if imgui.BeginMenu("About") {
 			if imgui.MenuItem("Show demo window") {
 				f.showDemoWindow = true
@@ -214,8 +391,53 @@ func (f *ForgeryContext) RenderUI() {
 		imgui.EndMainMenuBar()
 	}
 
-	if f.showMaterialsWindow {
-		windows.RenderMaterialsWindow(f.filesystem, &f.showMaterialsWindow, f.ChangeSelectedTexture)
+	if f.showConfigure {
+		f.configureWindow.Render(&f.showConfigure, f.ActivateProfile)
+	}
+
+	if f.showMaterialsWindow && f.filesystem != nil {
+		f.materialsWindow.Render(&f.showMaterialsWindow, f.ChangeSelectedTexture)
+	}
+
+	if f.showFilesystem {
+		f.filesystemWindow.Render(&f.showFilesystem)
+	}
+
+	if f.showReplaceTextures && f.documentLoaded {
+		f.replaceTexturesWindow.Render(f.filesystem, &f.showReplaceTextures, f.activeMap, f.scene, f.SelectedSolids(), f.SelectedEntities())
+	}
+
+	if f.showInstances && f.documentLoaded {
+		showContent := f.showInstanceContent
+		windows.RenderInstancesWindow(&f.showInstances, f.instances, f.instancesError, &showContent,
+			f.OpenInstance, f.CollapseInstance)
+
+		if showContent != f.showInstanceContent {
+			f.showInstanceContent = showContent
+			f.LoadInstances()
+		}
+	}
+
+	if f.showProblems && f.documentLoaded {
+		windows.RenderProblemsWindow(&f.showProblems, f.problems, f.CheckForProblems, f.SelectProblem)
+	}
+
+	if f.showPack && f.documentLoaded {
+		f.packWindow.Render(f.filesystem, &f.showPack, f.PackDryRun)
+	}
+
+	if f.showImportTexture && f.filesystem != nil && f.settings.Active() != nil {
+		f.importTextureWindow.Render(f.settings.Active().GameDir, &f.showImportTexture, f.ImportedTexture)
+	}
+
+	if f.showMaterialEditor && f.filesystem != nil && f.settings.Active() != nil {
+		f.materialEditorWindow.Render(f.settings.Active().GameDir, &f.showMaterialEditor, f.SavedMaterial)
+	}
+
+	if f.showPasteSpecial && f.documentLoaded {
+		if options, ok := f.pasteSpecialWindow.Render(&f.showPasteSpecial); ok {
+			f.Paste(options)
+		}
 	}
 
 	// TODO: factorise out
@@ -279,6 +501,15 @@ func (f *ForgeryContext) RenderUI() {
 			imgui.Text(fmt.Sprintf("Average FPS: %f", totalFps/float64(len(f.fpsHistory))))
 			imgui.Separator()
 
+			residency := cache.TextureResidency()
+			if residency.Budget != 0 {
+				imgui.Text(fmt.Sprintf("Texture memory: %.1f / %.0f MB", float64(residency.Bytes)/(1<<20), float64(residency.Budget)/(1<<20)))
+			} else {
+				imgui.Text(fmt.Sprintf("Texture memory: %.1f MB", float64(residency.Bytes)/(1<<20)))
+			}
+			imgui.Text(fmt.Sprintf("Textures: %d resident, %d evicted, %d streaming", residency.Resident, residency.Evicted, cache.StreamingCount()))
+			imgui.Separator()
+
 			imgui.PushTextWrapPosV(128)
 			imgui.Text(fmt.Sprintf("Selected Texture: %s", f.selectedTexture))
 			imgui.PopTextWrapPos()
@@ -344,6 +575,409 @@ func (f *ForgeryContext) CleanupWindows() {
 
 func (f *ForgeryContext) ChangeSelectedTexture(newTex string) {
 	f.selectedTexture = newTex
+	f.replaceTexturesWindow.SetReplace(newTex)
+}
+
+// SelectedSolids returns the solids that are selected in any scene window
+func (f *ForgeryContext) SelectedSolids() map[int]bool {
+	selection := map[int]bool{}
+
+	for _, w := range f.sceneWindows {
+		for _, id := range w.SelectedSolids() {
+			selection[id] = true
+		}
+	}
+
+	return selection
+}
+
+// SelectedEntities returns the indices of the brush entities that own a selected solid
+// along with any entities that were selected from elsewhere
+func (f *ForgeryContext) SelectedEntities() map[int]bool {
+	selection := map[int]bool{}
+
+	for index := range f.selectedEntities {
+		selection[index] = true
+	}
+
+	for id := range f.SelectedSolids() {
+		if index := f.activeMap.EntityForSolid(id); index != -1 {
+			selection[index] = true
+		}
+	}
+
+	return selection
+}
+
+func (f *ForgeryContext) selectedSolidIds() []int {
+	ids := make([]int, 0)
+	for id := range f.SelectedSolids() {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// ClearSelection deselects everything in all of the scene windows
+func (f *ForgeryContext) ClearSelection() {
+	f.selectedEntities = nil
+
+	for _, w := range f.sceneWindows {
+		w.ClearSelection()
+	}
+}
+
+// selectionChanged is called when the selection is changed by clicking in a scene window
+func (f *ForgeryContext) selectionChanged() {
+	f.selectedEntities = nil
+}
+
+// expandSelection finds everything that should be selected when a solid is clicked on
+func (f *ForgeryContext) expandSelection(id int) []int {
+	if !f.selectGroups {
+		return []int{id}
+	}
+
+	// Brush entities are selected as a whole
+	if index := f.activeMap.EntityForSolid(id); index != -1 {
+		ids := make([]int, 0)
+		for _, s := range f.activeMap.EntitySolids(index) {
+			ids = append(ids, s.Id)
+		}
+		return ids
+	}
+
+	return f.activeMap.Worldspawn().GroupSolids(id)
+}
+
+// Group groups the selected solids together
+func (f *ForgeryContext) Group() {
+	if _, err := f.activeMap.Group(f.selectedSolidIds()); err != nil {
+		logger.Error("Unable to group: %s", err)
+	}
+}
+
+// Ungroup removes the groups that the selected solids are in
+func (f *ForgeryContext) Ungroup() {
+	f.activeMap.Ungroup(f.selectedSolidIds())
+}
+
+// HideSelected hides the selected solids and takes them out of the scene
+func (f *ForgeryContext) HideSelected() {
+	// Hiding part of a brush entity hides the rest of it as well
+	for _, id := range f.activeMap.HideSolids(f.selectedSolidIds()) {
+		f.scene.RebuildSolid(id)
+	}
+
+	f.ClearSelection()
+}
+
+// UnhideAll shows everything that has been hidden
+func (f *ForgeryContext) UnhideAll() {
+	for _, id := range f.activeMap.UnhideAll() {
+		f.scene.RebuildSolid(id)
+	}
+}
+
+// SetTextureQuality changes how many mips are left out of textures and uploads them all again
+func (f *ForgeryContext) SetTextureQuality(quality int) {
+	f.settings.TextureQuality = quality
+	if err := f.settings.Save(); err != nil {
+		logger.Error("Unable to save settings: %s", err)
+	}
+
+	cache.SetTextureQuality(quality)
+	if f.filesystem != nil {
+		cache.RebindTextures(f.filesystem)
+	}
+}
+
+// SetTextureBudget changes how many megabytes of GL memory textures can use
+func (f *ForgeryContext) SetTextureBudget(budget int) {
+	f.settings.TextureBudget = budget
+	if err := f.settings.Save(); err != nil {
+		logger.Error("Unable to save settings: %s", err)
+	}
+
+	cache.SetTextureBudget(int64(budget) << 20)
+}
+
+// CheckForProblems finds the assets that the active map refers to that the filesystem does not have
+func (f *ForgeryContext) CheckForProblems() {
+	f.problems = f.activeMap.MissingAssets(func(path string) bool {
+		_, err := f.filesystem.GetFile(path)
+		return err == nil
+	})
+
+	logger.Notice("Found %d missing assets", len(f.problems))
+}
+
+// PackDryRun works out which custom content the active map needs
+func (f *ForgeryContext) PackDryRun() {
+	f.packWindow.SetFiles(f.activeMap.PackFiles(f.filesystem, f.filesystem.IsStock))
+}
+
+// SelectProblem selects the solids and entities that refer to a missing asset
+func (f *ForgeryContext) SelectProblem(asset *formats.AssetReference) {
+	ids := append([]int{}, asset.Solids...)
+
+	f.selectedEntities = map[int]bool{}
+	for _, index := range asset.Entities {
+		f.selectedEntities[index] = true
+
+		for _, s := range f.activeMap.EntitySolids(index) {
+			ids = append(ids, s.Id)
+		}
+	}
+
+	for _, w := range f.sceneWindows {
+		w.SelectSolids(ids)
+	}
+}
+
+// OpenMap loads a vmf and makes it the active document
+func (f *ForgeryContext) OpenMap(filename string) {
+	newMap, err := formats.LoadVmf(filename)
+
+	if err != nil {
+		logger.Error("Unable to open %s: %s", filename, err)
+		return
+	}
+
+	// The old scene stops listening for materials and its meshes are freed
+	if f.scene != nil {
+		f.scene.Close()
+	}
+
+	f.activeMap = newMap
+	f.documentLoaded = true
+	f.findInstances()
+	f.PreloadMapMaterials()
+	f.scene = view.NewSceneFromVmf(f.filesystem, f.activeMap)
+
+	f.selectedEntities = nil
+	for _, w := range f.sceneWindows {
+		w.SetScene(f.scene)
+	}
+
+	f.addInstancesToScene()
+
+	f.problems = nil
+	if f.showProblems {
+		f.CheckForProblems()
+	}
+}
+
+// PreloadMapMaterials loads the materials that the active map and its instances use ahead of everything else
+func (f *ForgeryContext) PreloadMapMaterials() {
+	assets := f.activeMap.Assets()
+	for _, instance := range f.instances {
+		assets = append(assets, instance.Assets()...)
+	}
+
+	names := make([]string, 0)
+	seen := map[string]bool{}
+	for _, asset := range assets {
+		if asset.Kind == formats.AssetMaterial && !seen[asset.Path] {
+			seen[asset.Path] = true
+			names = append(names, asset.Name)
+		}
+	}
+
+	f.materialsWindow.SetMapMaterials(names)
+
+	f.texturesLoadedCount = 0
+	f.texturesLoadingCompleteChan, f.texturesLoadedExpected = cache.PreloadMaterials(f.filesystem, names)
+	f.texturesLoadingComplete = f.texturesLoadedExpected == 0
+}
+
+// LoadInstances (re)loads the func_instances in the active map and
+// adds their contents to the scene if they are being shown
+func (f *ForgeryContext) LoadInstances() {
+	f.findInstances()
+	f.addInstancesToScene()
+}
+
+// findInstances loads the vmfs of the func_instances in the active map
+func (f *ForgeryContext) findInstances() {
+	var err error
+
+	f.instancesError = ""
+
+	f.instances, err = f.activeMap.LoadInstances()
+	if err != nil {
+		logger.Warn("%s", err)
+		f.instancesError = err.Error()
+	}
+}
+
+// addInstancesToScene replaces the instances in the scene with the
+// ones that were last found if they are being shown
+func (f *ForgeryContext) addInstancesToScene() {
+	f.scene.ClearInstances()
+
+	if f.showInstanceContent {
+		for _, instance := range f.instances {
+			f.scene.AddInstance(instance)
+		}
+	}
+}
+
+// confirmCloseMap asks whether the active map can be closed to open filename
+// as only one map can be open at a time
+func (f *ForgeryContext) confirmCloseMap(filename string) bool {
+	if !f.documentLoaded {
+		return true
+	}
+
+	current := f.activeMap.Filepath()
+	if current == "" {
+		current = "the current map"
+	}
+
+	return dialog.Message("Opening %s will close %s and any unsaved changes to it will be lost.\n\nContinue?",
+		filepath.Base(filename), current).Title("Open map").YesNo()
+}
+
+// OpenInstance opens the vmf that an instance refers to for editing
+// in place of the active map
+func (f *ForgeryContext) OpenInstance(instance *formats.Instance) {
+	if !f.confirmCloseMap(instance.Path) {
+		return
+	}
+
+	f.OpenMap(instance.Path)
+}
+
+// CollapseInstance moves the contents of an instance into the active map
+func (f *ForgeryContext) CollapseInstance(instance *formats.Instance) {
+	solids, err := f.activeMap.CollapseInstance(instance)
+	if err != nil {
+		logger.Error("Unable to collapse instance: %s", err)
+		return
+	}
+
+	for _, solid := range solids {
+		f.scene.AddSolid(solid)
+	}
+
+	// Entity indices have changed so all the instances need to be found again
+	f.LoadInstances()
+}
+
+// Save writes the active map out, asking for where to save it if
+// it has not been saved before or saveAs is set
+func (f *ForgeryContext) Save(saveAs bool) {
+	filename := f.activeMap.Filepath()
+
+	if saveAs || filename == "" {
+		var err error
+		filename, err = dialog.File().Filter("Hammer map file", "vmf").Title("Save map").Save()
+		if err != nil {
+			return
+		}
+	}
+
+	if err := f.activeMap.Save(filename); err != nil {
+		logger.Error("Unable to save %s: %s", filename, err)
+	}
+}
+
+// copySelection puts the selected solids and entities on the clipboard.
+// Returns false if there was nothing selected to copy
+func (f *ForgeryContext) copySelection() (bool, error) {
+	solids := make([]*world.Solid, 0)
+	for id := range f.SelectedSolids() {
+		if solid := f.activeMap.Worldspawn().Solid(id); solid != nil {
+			solids = append(solids, solid)
+		}
+	}
+
+	indices := make([]int, 0)
+	for index := range f.SelectedEntities() {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	entities := make([]*formats.FragmentEntity, 0, len(indices))
+	for _, index := range indices {
+		entities = append(entities, f.activeMap.FragmentEntity(index))
+	}
+
+	if len(solids) == 0 && len(entities) == 0 {
+		return false, nil
+	}
+
+	text, err := formats.CopyToText(solids, entities)
+	if err != nil {
+		return false, err
+	}
+
+	f.platform.SetClipboard(text)
+	return true, nil
+}
+
+// Copy puts the selected solids and entities on the clipboard
+func (f *ForgeryContext) Copy() {
+	if _, err := f.copySelection(); err != nil {
+		logger.Error("Unable to copy selection: %s", err)
+	}
+}
+
+// Cut copies the selected solids and entities and then removes them from the map.
+// Nothing is removed unless it was copied
+func (f *ForgeryContext) Cut() {
+	copied, err := f.copySelection()
+	if err != nil {
+		logger.Error("Unable to cut selection: %s", err)
+		return
+	}
+	if !copied {
+		return
+	}
+
+	entities := f.SelectedEntities()
+
+	for id := range f.SelectedSolids() {
+		if f.activeMap.Worldspawn().RemoveSolid(id) != nil {
+			f.scene.RemoveSolid(id)
+		}
+	}
+
+	for _, id := range f.activeMap.RemoveEntities(entities) {
+		f.scene.RemoveSolid(id)
+	}
+
+	f.ClearSelection()
+
+	// Entity indices have changed so all the instances need to be found again
+	if len(entities) != 0 {
+		f.LoadInstances()
+	}
+}
+
+// Paste adds whatever map objects are on the clipboard to the map
+func (f *ForgeryContext) Paste(options *formats.PasteOptions) {
+	text, err := f.platform.Clipboard()
+	if err != nil {
+		logger.Error("Unable to read clipboard: %s", err)
+		return
+	}
+
+	solids, entities, err := f.activeMap.Paste(text, options)
+	if err != nil {
+		logger.Error("Unable to paste: %s", err)
+		return
+	}
+
+	for _, solid := range solids {
+		f.scene.AddSolid(solid)
+	}
+
+	// Pasted func_instances should show their contents too
+	if len(entities) != 0 {
+		f.LoadInstances()
+	}
 }
 
 func (f *ForgeryContext) Run() {
@@ -391,12 +1025,16 @@ func (f *ForgeryContext) NewSceneWindow() {
 		f.lastSceneWindowId,
 		f.platform)
 
+	newWindow.SetSelectionExpander(f.expandSelection)
+	newWindow.SetSelectionChanged(f.selectionChanged)
 	newWindow.Initialize()
 
 	f.sceneWindows = append(f.sceneWindows, newWindow)
 }
 
-func (f *ForgeryContext) NewApp() {
+// NewApp sets up the app using the settings at settingsPath
+// profile overrides the active game configuration if it is set
+func (f *ForgeryContext) NewApp(settingsPath string, profile string) {
 	f.context = imgui.CreateContext(nil)
 	io := imgui.CurrentIO()
 	io.SetConfigFlags(imgui.ConfigFlagNavEnableKeyboard)
@@ -423,42 +1061,163 @@ func (f *ForgeryContext) NewApp() {
 		panic(err)
 	}
 
-	// TODO We need to load our settings from a file somehow!
+	f.settings, err = settings.LoadOrDefault(settingsPath)
+	if err != nil {
+		logger.Error("%s", err)
+	}
+
+	if profile != "" {
+		f.settings.ActiveProfile = profile
+	}
 
 	f.cameraSens = 4
 	f.cameraMoveSens = 4
 
-	f.filesystem = valve.NewFileSystem("E:\\steam\\steamapps\\common\\Counter-Strike Global Offensive\\csgo")
-	valve.DumpAllKnownMaterials(f.filesystem)
-
 	f.adapter = &adapters.OpenGL{}
 	f.adapter.Init()
 
 	f.render = render.NewRenderer(f.adapter)
 
 	cache.InitTextureLookup()
-
-	f.texturesLoadingCompleteChan = make(chan struct{}, 1000)
-	f.texturesLoadedExpected = cache.LoadAllKnownMaterials(f.filesystem, f.texturesLoadingCompleteChan)
+	cache.SetTextureQuality(f.settings.TextureQuality)
+	cache.SetTextureBudget(int64(f.settings.TextureBudget) << 20)
 
 	f.platform = platform
 	f.imguiRenderer = imguiRenderer
 
-	// TODO: Dont just load this default
-	// TODO methods of handling multiple open docs at the same time!
-	{
-		newMap, err := formats.LoadVmf("assets/default_cs.vmf")
+	f.showInfoOverlay = true
+	f.selectGroups = true
+	f.showInstanceContent = true
+
+	f.replaceTexturesWindow = windows.NewReplaceTexturesWindow()
+	f.pasteSpecialWindow = windows.NewPasteSpecialWindow()
+	f.configureWindow = windows.NewConfigureWindow(f.settings)
+	f.filesystemWindow = windows.NewFileSystemWindow()
+	f.materialsWindow = windows.NewMaterialsWindow(f.settings)
+	f.packWindow = windows.NewPackWindow()
+	f.importTextureWindow = windows.NewImportTextureWindow()
+	f.materialEditorWindow = windows.NewMaterialEditorWindow(f.adapter, f.render)
+
+	// Nothing can be loaded until there is a filesystem
+	f.texturesLoadingComplete = true
+
+	// There is nothing to activate until a game directory has been set
+	if f.settings.FirstRun() {
+		f.configureWindow.SetStatus("Set the game directory for the profile (or import a GameConfig.txt) and then use it")
+		f.showConfigure = true
+		return
+	}
 
-		if err != nil {
-			panic(err)
+	config := f.settings.Active()
+	if config == nil {
+		err = fmt.Errorf("there is no profile called \"%s\"", f.settings.ActiveProfile)
+	} else {
+		err = f.ActivateProfile(config)
+	}
+
+	if err != nil {
+		logger.Error("%s", err)
+		f.configureWindow.SetStatus(err.Error())
+		f.showConfigure = true
+	}
+}
+
+// ActivateProfile sets up the filesystem for a game configuration and
+// loads the default map if there is not one open already
+func (f *ForgeryContext) ActivateProfile(config *settings.GameConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	fs, err := valve.NewFileSystem(config.GameDir)
+	if err != nil {
+		return err
+	}
+
+	f.filesystem = fs
+	f.filesystemWindow.SetFileSystem(fs)
+	f.materialsWindow.SetFileSystem(fs)
+	f.materialEditorWindow.SetFileSystem(fs)
+
+	if f.watcher != nil {
+		f.watcher.Close()
+	}
+	f.watcher = valve.NewWatcher(fs, "materials")
+	f.pendingReloads = map[string]struct{}{}
+
+	// Everything else in the game is found in the background
+	cache.StartIndexing(
+		fs,
+		filepath.Join(f.settings.Dir(), cache.DefaultMaterialIndexPath),
+		cache.ThumbnailDirectoryFor(f.settings.Dir(), config.GameDir))
+
+	if config.DefaultMaterial != "" {
+		f.ChangeSelectedTexture(config.DefaultMaterial)
+	}
+
+	if f.documentLoaded {
+		f.PreloadMapMaterials()
+	} else {
+		// TODO: Dont just load this default
+		// TODO methods of handling multiple open docs at the same time!
+		f.OpenMap("assets/default_cs.vmf")
+	}
+
+	return nil
+}
+
+// ImportedTexture makes a material that has just been imported show up straight away
+// instead of waiting for the watcher to notice it
+func (f *ForgeryContext) ImportedTexture(name string) {
+	for _, path := range []string{"materials/" + name + ".vtf", "materials/" + name + ".vmt"} {
+		for _, m := range cache.ReloadFile(f.filesystem, path) {
+			if f.scene != nil {
+				f.scene.MaterialChanged(m)
+			}
+		}
+	}
+
+	f.ChangeSelectedTexture(name)
+}
+
+// SavedMaterial reloads a material that was just saved by the material editor
+func (f *ForgeryContext) SavedMaterial(name string) {
+	for _, m := range cache.ReloadFile(f.filesystem, "materials/"+name+".vmt") {
+		if f.scene != nil {
+			f.scene.MaterialChanged(m)
 		}
+	}
+}
 
-		f.activeMap = newMap
-		f.documentLoaded = true
-		f.scene = view.NewSceneFromVmf(f.filesystem, f.activeMap)
+// HotReload reloads materials and textures that have changed on disk
+func (f *ForgeryContext) HotReload() {
+	if f.watcher == nil {
+		return
 	}
 
-	f.showInfoOverlay = true
+	done := false
+	for !done {
+		select {
+		case path := <-f.watcher.Changes():
+			f.pendingReloads[path] = struct{}{}
+		default:
+			done = true
+		}
+	}
+
+	if len(f.pendingReloads) == 0 {
+		return
+	}
+
+	for path := range f.pendingReloads {
+		for _, m := range cache.ReloadFile(f.filesystem, path) {
+			if f.scene != nil {
+				f.scene.MaterialChanged(m)
+			}
+		}
+	}
+
+	f.pendingReloads = map[string]struct{}{}
 }
 
 func (f *ForgeryContext) DestroyApp() {
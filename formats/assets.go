@@ -0,0 +1,232 @@
+package formats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/galaco/source-tools-common/entity"
+)
+
+const (
+	AssetMaterial = 0
+	AssetModel    = 1
+	AssetSound    = 2
+)
+
+var AssetKinds = [...]string{
+	"Material",
+	"Model",
+	"Sound",
+}
+
+// entitySoundKeys are the entity keyvalues that can refer to a sound file
+var entitySoundKeys = [...]string{
+	"message",
+	"startsound",
+	"stopsound",
+	"movesound",
+	"noise1",
+	"noise2",
+	"soundname",
+}
+
+// skyboxFaces are the suffixes of the materials that make up a skybox
+var skyboxFaces = [...]string{"up", "dn", "lf", "rt", "ft", "bk"}
+
+// soundPrefixes are the characters that can be put in front of a sound to change how it plays
+const soundPrefixes = "*#@<>^)(}$!?&~`+%"
+
+// AssetReference is an asset that the vmf refers to
+type AssetReference struct {
+	Kind int
+	Name string
+
+	// Path is the filesystem path that was looked for
+	Path string
+
+	// Count is the number of times the asset is referred to
+	Count int
+
+	// Solids are the ids of the world solids that refer to the asset
+	// and Entities are the indices of the entities that do
+	Solids   []int
+	Entities []int
+}
+
+// assetPath returns the filesystem path of an asset or "" if it is not a file
+func assetPath(kind int, name string) string {
+	name = strings.ToLower(strings.Replace(strings.TrimSpace(name), "\\", "/", -1))
+	if name == "" {
+		return ""
+	}
+
+	switch kind {
+	case AssetMaterial:
+		name = strings.TrimPrefix(name, "materials/")
+		name = strings.TrimSuffix(name, ".vmt")
+		return "materials/" + name + ".vmt"
+
+	case AssetModel:
+		// Brush entities use *n to refer to their own solids
+		if !strings.HasSuffix(name, ".mdl") {
+			return ""
+		}
+		return name
+
+	case AssetSound:
+		// Anything without an extension is a soundscript entry rather than a file
+		name = strings.TrimLeft(name, soundPrefixes)
+		switch {
+		case strings.HasSuffix(name, ".wav"), strings.HasSuffix(name, ".mp3"), strings.HasSuffix(name, ".ogg"):
+			return "sound/" + strings.TrimPrefix(name, "sound/")
+		}
+	}
+
+	return ""
+}
+
+type assetCollector struct {
+	assets map[string]*AssetReference
+}
+
+func (c *assetCollector) add(kind int, name string, solid int, entity int) {
+	path := assetPath(kind, name)
+	if path == "" {
+		return
+	}
+
+	asset, ok := c.assets[path]
+	if !ok {
+		asset = &AssetReference{Kind: kind, Name: name, Path: path}
+		c.assets[path] = asset
+	}
+
+	asset.Count++
+
+	if solid != -1 && (len(asset.Solids) == 0 || asset.Solids[len(asset.Solids)-1] != solid) {
+		asset.Solids = append(asset.Solids, solid)
+	}
+	if entity != -1 && (len(asset.Entities) == 0 || asset.Entities[len(asset.Entities)-1] != entity) {
+		asset.Entities = append(asset.Entities, entity)
+	}
+}
+
+func (c *assetCollector) addSolid(s *world.Solid, entity int) {
+	solid := s.Id
+	if entity != -1 {
+		solid = -1
+	}
+
+	for _, side := range s.Sides {
+		c.add(AssetMaterial, side.Material, solid, entity)
+	}
+}
+
+func (c *assetCollector) addEntity(e *entity.Entity, index int) {
+	for _, key := range entityMaterialKeys {
+		c.add(AssetMaterial, e.ValueForKey(key), -1, index)
+	}
+
+	model := e.ValueForKey("model")
+	switch {
+	case strings.HasSuffix(strings.ToLower(model), ".vmt"), strings.HasSuffix(strings.ToLower(model), ".spr"):
+		// Sprites refer to materials through their model
+		c.add(AssetMaterial, strings.TrimSuffix(model, ".spr"), -1, index)
+	default:
+		c.add(AssetModel, model, -1, index)
+	}
+
+	for _, key := range entitySoundKeys {
+		c.add(AssetSound, e.ValueForKey(key), -1, index)
+	}
+}
+
+// Assets returns all the materials, models and sounds that the vmf refers to
+func (vmf *Vmf) Assets() []*AssetReference {
+	c := &assetCollector{assets: map[string]*AssetReference{}}
+
+	if vmf.world.Keyvalues != nil {
+		if sky := vmf.world.Keyvalues.ValueForKey("skyname"); sky != "" {
+			for _, face := range skyboxFaces {
+				c.add(AssetMaterial, "skybox/"+sky+face, -1, -1)
+			}
+		}
+		c.add(AssetMaterial, vmf.world.Keyvalues.ValueForKey("detailmaterial"), -1, -1)
+	}
+
+	vmf.collectAssets(c)
+
+	return c.sorted()
+}
+
+// collectAssets adds the assets of the solids and entities in the vmf to c
+func (vmf *Vmf) collectAssets(c *assetCollector) {
+	for _, s := range vmf.world.Solids {
+		c.addSolid(s, -1)
+	}
+
+	for i := 0; i < vmf.entities.Length(); i++ {
+		c.addEntity(vmf.entities.Get(i), i)
+
+		for _, s := range vmf.entitySolids[i] {
+			c.addSolid(s, i)
+		}
+	}
+}
+
+// Assets returns the assets that the contents of an instance (and instances inside of it) refer to
+// once its material replacements have been made. They are all referred to by the func_instance.
+// The sky and detail material of the instance are not used by the map that it is in
+func (instance *Instance) Assets() []*AssetReference {
+	contents := &assetCollector{assets: map[string]*AssetReference{}}
+	instance.Vmf.collectAssets(contents)
+
+	assets := contents.sorted()
+	for _, child := range instance.Children {
+		assets = append(assets, child.Assets()...)
+	}
+
+	c := &assetCollector{assets: map[string]*AssetReference{}}
+	for _, asset := range assets {
+		name := asset.Name
+		if replacement, ok := instance.MaterialReplacements[strings.ToLower(name)]; ok && asset.Kind == AssetMaterial {
+			name = replacement
+		}
+
+		for i := 0; i < asset.Count; i++ {
+			c.add(asset.Kind, name, -1, instance.Index)
+		}
+	}
+
+	return c.sorted()
+}
+
+// sorted returns the collected assets by kind and then by path
+func (c *assetCollector) sorted() []*AssetReference {
+	assets := make([]*AssetReference, 0, len(c.assets))
+	for _, asset := range c.assets {
+		assets = append(assets, asset)
+	}
+
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].Kind != assets[j].Kind {
+			return assets[i].Kind < assets[j].Kind
+		}
+		return assets[i].Path < assets[j].Path
+	})
+
+	return assets
+}
+
+// MissingAssets returns the assets that exists says cannot be found. Each asset is only checked once
+func (vmf *Vmf) MissingAssets(exists func(path string) bool) []*AssetReference {
+	missing := make([]*AssetReference, 0)
+	for _, asset := range vmf.Assets() {
+		if !exists(asset.Path) {
+			missing = append(missing, asset)
+		}
+	}
+
+	return missing
+}
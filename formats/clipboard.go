@@ -0,0 +1,310 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/galaco/source-tools-common/entity"
+	"github.com/galaco/vmf"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// entityNameKeys are keys that other entities can use to refer to an entity by name
+var entityNameKeys = [...]string{
+	"target",
+	"parentname",
+	"filtername",
+	"damagefilter",
+	"lightingorigin",
+}
+
+// PasteOptions control how a fragment is pasted into a vmf
+type PasteOptions struct {
+	// Copies is the number of times to paste the fragment
+	Copies int
+	// Offset and Rotation (in degrees around x, y, z) are applied
+	// once for every copy
+	Offset   mgl32.Vec3
+	Rotation mgl32.Vec3
+
+	// UniqueNames renames pasted targetnames that already exist in the map
+	UniqueNames bool
+}
+
+// DefaultPasteOptions is a single paste with no changes
+func DefaultPasteOptions() *PasteOptions {
+	return &PasteOptions{
+		Copies: 1,
+	}
+}
+
+// FragmentEntity is an entity that is copied along with its brushes and child blocks
+type FragmentEntity struct {
+	Entity *entity.Entity
+	Solids []*world.Solid
+
+	// Child blocks like connections that are kept as they are
+	blocks []vmf.Node
+}
+
+// FragmentEntity returns the entity at index with everything that belongs to it
+func (vmf *Vmf) FragmentEntity(index int) *FragmentEntity {
+	return &FragmentEntity{
+		Entity: vmf.entities.Get(index),
+		Solids: vmf.entitySolids[index],
+		blocks: vmf.entityBlocks[index],
+	}
+}
+
+// RemoveEntities removes the entities at indices along with their brushes.
+// Returns the ids of the solids that went with them
+func (vmf *Vmf) RemoveEntities(indices map[int]bool) []int {
+	order := make([]int, 0, len(indices))
+	for index := range indices {
+		order = append(order, index)
+	}
+
+	// Later entities go first so that the earlier indices stay the same
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+
+	removed := make([]int, 0)
+	for _, index := range order {
+		for _, s := range vmf.entitySolids[index] {
+			removed = append(removed, s.Id)
+		}
+		vmf.removeEntity(index)
+	}
+
+	return removed
+}
+
+// CopyToText serialises solids and entities into vmf text that can be
+// put on the clipboard
+func CopyToText(solids []*world.Solid, entities []*FragmentEntity) (string, error) {
+	buf := &bytes.Buffer{}
+
+	if err := WriteFragment(buf, solids, entities); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// ReadFragment reads solids and entities from vmf text
+func ReadFragment(text string) ([]*world.Solid, []*FragmentEntity, error) {
+	reader := vmf.NewReader(strings.NewReader(text))
+	importable, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	solids := make([]*world.Solid, 0)
+	for _, solidNode := range importable.World.GetChildrenByKey("solid") {
+		solid, err := loadSolid(&solidNode)
+		if err != nil {
+			return nil, nil, err
+		}
+		solids = append(solids, solid)
+	}
+
+	entities := make([]*FragmentEntity, 0)
+	for _, n := range *importable.Entities.GetAllValues() {
+		entityNode := n.(vmf.Node)
+		e := entity.FromVmfNode(&entityNode)
+
+		blocks, entitySolids, err := loadEntityChildren(&entityNode)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entities = append(entities, &FragmentEntity{Entity: &e, Solids: entitySolids, blocks: blocks})
+	}
+
+	if len(solids) == 0 && len(entities) == 0 {
+		return nil, nil, errors.New("clipboard does not contain any map objects")
+	}
+
+	return solids, entities, nil
+}
+
+// Paste reads a fragment and adds copies of it to the vmf, allocating new ids.
+// Returns the solids (including those of brush entities) and the indices of the entities that were added
+func (vmf *Vmf) Paste(text string, options *PasteOptions) ([]*world.Solid, []int, error) {
+	solids, entities, err := ReadFragment(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if options == nil {
+		options = DefaultPasteOptions()
+	}
+
+	// Everything is rotated around the center of the whole fragment
+	center := mgl32.Vec3{}
+	count := 0
+	for _, s := range solids {
+		center = center.Add(s.Center())
+		count++
+	}
+	for _, e := range entities {
+		if e.Entity.ValueForKey("origin") != "" {
+			center = center.Add(e.Entity.VectorForKey("origin"))
+			count++
+		}
+		for _, s := range e.Solids {
+			center = center.Add(s.Center())
+			count++
+		}
+	}
+	if count != 0 {
+		center = center.Mul(1 / float32(count))
+	}
+
+	newSolids := make([]*world.Solid, 0, len(solids)*options.Copies)
+	newEntities := make([]int, 0, len(entities)*options.Copies)
+
+	for copyIdx := 1; copyIdx <= options.Copies; copyIdx++ {
+		n := float32(copyIdx)
+		offset := options.Offset.Mul(n)
+		rotation := world.RotationFromAngles(options.Rotation.Mul(n))
+
+		names := map[string]string{}
+		if options.UniqueNames {
+			names = vmf.uniqueNamesFor(entities)
+		}
+
+		pasteSolid := func(s *world.Solid) *world.Solid {
+			solid := s.Clone()
+			solid.Rotate(center, rotation)
+			solid.Translate(offset)
+
+			// Groups are not copied so pasted solids start out ungrouped
+			vmf.renumberSolid(solid)
+			newSolids = append(newSolids, solid)
+
+			return solid
+		}
+
+		for _, s := range solids {
+			vmf.world.AddSolid(pasteSolid(s))
+		}
+
+		for _, e := range entities {
+			ent := cloneEntity(e.Entity)
+			transformEntity(ent, center, rotation, offset)
+
+			setKeyValue(ent, "id", fmt.Sprintf("%d", vmf.NextObjectId()))
+			for _, key := range append([]string{"targetname"}, entityNameKeys[:]...) {
+				if newName, ok := names[ent.ValueForKey(key)]; ok {
+					setKeyValue(ent, key, newName)
+				}
+			}
+
+			// Outputs follow any entities that were renamed
+			blocks := cloneBlocks(e.blocks, func(output string) string {
+				return renameOutputTarget(output, func(name string) string {
+					if newName, ok := names[name]; ok {
+						return newName
+					}
+					return name
+				})
+			})
+
+			entitySolids := make([]*world.Solid, 0, len(e.Solids))
+			for _, s := range e.Solids {
+				entitySolids = append(entitySolids, pasteSolid(s))
+			}
+
+			index := vmf.entities.Add(ent)
+			vmf.entityBlocks[index] = blocks
+			vmf.entitySolids[index] = entitySolids
+			newEntities = append(newEntities, index)
+		}
+	}
+
+	return newSolids, newEntities, nil
+}
+
+// uniqueNamesFor finds new names for all of the targetnames in entities that
+// already exist in the vmf
+func (vmf *Vmf) uniqueNamesFor(entities []*FragmentEntity) map[string]string {
+	existing := map[string]bool{}
+	for i := 0; i < vmf.entities.Length(); i++ {
+		existing[vmf.entities.Get(i).ValueForKey("targetname")] = true
+	}
+
+	names := map[string]string{}
+	for _, e := range entities {
+		name := e.Entity.ValueForKey("targetname")
+		if name == "" || !existing[name] {
+			continue
+		}
+
+		if _, ok := names[name]; ok {
+			continue
+		}
+
+		for i := 1; ; i++ {
+			newName := fmt.Sprintf("%s_%d", name, i)
+			if !existing[newName] {
+				names[name] = newName
+				existing[newName] = true
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+func cloneEntity(e *entity.Entity) *entity.Entity {
+	newEntity := &entity.Entity{
+		Origin:     e.Origin,
+		FirstBrush: e.FirstBrush,
+		NumBrushes: e.NumBrushes,
+	}
+
+	// Keep the same (reversed) order
+	var last *entity.EPair
+	for ep := e.EPairs; ep != nil; ep = ep.Next {
+		pair := &entity.EPair{Key: ep.Key, Value: ep.Value}
+		if last == nil {
+			newEntity.EPairs = pair
+		} else {
+			last.Next = pair
+		}
+		last = pair
+	}
+
+	return newEntity
+}
+
+func setKeyValue(e *entity.Entity, key string, value string) {
+	for ep := e.EPairs; ep != nil; ep = ep.Next {
+		if ep.Key == key {
+			ep.Value = value
+			return
+		}
+	}
+
+	e.EPairs = &entity.EPair{Next: e.EPairs, Key: key, Value: value}
+}
+
+// transformEntity rotates an entity around center and then moves it by offset
+func transformEntity(e *entity.Entity, center mgl32.Vec3, rotation mgl32.Mat3, offset mgl32.Vec3) {
+	if e.ValueForKey("origin") != "" {
+		origin := e.VectorForKey("origin")
+		origin = rotation.Mul3x1(origin.Sub(center)).Add(center).Add(offset)
+		setKeyValue(e, "origin", formatVec3(origin))
+	}
+
+	if e.ValueForKey("angles") != "" {
+		angles := e.VectorForKey("angles")
+		angles = world.EntityAnglesFromMatrix(rotation.Mul3(world.MatrixFromEntityAngles(angles)))
+		setKeyValue(e, "angles", formatVec3(angles))
+	}
+}
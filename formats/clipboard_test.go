@@ -0,0 +1,178 @@
+package formats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// saveAndLoad writes a vmf out and reads it back in
+func saveAndLoad(t *testing.T, v *Vmf) *Vmf {
+	dir, err := ioutil.TempDir("", "forgery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "map.vmf")
+	if err := v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadVmf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loaded
+}
+
+// dispProperty returns a property of the dispinfo on a side, or of one of its child blocks
+func dispProperty(side *world.Side, block string, key string) string {
+	dispinfo := &side.Blocks[0]
+	if block == "" {
+		return dispinfo.GetProperty(key)
+	}
+
+	child := dispinfo.GetChildrenByKey(block)[0]
+	return child.GetProperty(key)
+}
+
+func TestCopyPasteRoundTrip(t *testing.T) {
+	v, err := LoadVmf("testdata/edit.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both world solids, the func_detail and the info_target
+	text, err := CopyToText(v.Worldspawn().Solids, []*FragmentEntity{v.FragmentEntity(0), v.FragmentEntity(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultPasteOptions()
+	options.Copies = 2
+	options.Offset = mgl32.Vec3{256, 0, 0}
+	options.UniqueNames = true
+
+	solids, entities, err := v.Paste(text, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(solids) != 8 || len(entities) != 4 {
+		t.Fatalf("expected 8 solids and 4 entities, got %d and %d", len(solids), len(entities))
+	}
+
+	// Every id in the map has to be unique after pasting
+	ids := map[int]bool{1: true}
+	sideIds := map[int]bool{}
+	addSolids := func(solids []*world.Solid) {
+		for _, s := range solids {
+			if ids[s.Id] {
+				t.Errorf("solid id %d is used twice", s.Id)
+			}
+			ids[s.Id] = true
+
+			for _, side := range s.Sides {
+				if sideIds[side.Id] {
+					t.Errorf("side id %d is used twice", side.Id)
+				}
+				sideIds[side.Id] = true
+			}
+		}
+	}
+
+	addSolids(v.Worldspawn().Solids)
+	for i := 0; i < v.Entities().Length(); i++ {
+		id := v.Entities().Get(i).IntForKey("id")
+		if ids[id] {
+			t.Errorf("entity id %d is used twice", id)
+		}
+		ids[id] = true
+
+		addSolids(v.EntitySolids(i))
+	}
+
+	// Each copy is moved by the offset again
+	if p := solids[0].Sides[0].Plane[0]; p != (mgl32.Vec3{256, 64, 64}) {
+		t.Errorf("expected the first copy to be moved to 256 64 64, got %v", p)
+	}
+	if p := solids[4].Sides[0].Plane[0]; p != (mgl32.Vec3{512, 64, 64}) {
+		t.Errorf("expected the second copy to be moved to 512 64 64, got %v", p)
+	}
+
+	// Names that are taken get a new suffix for every copy
+	for i, expected := range map[int]string{1: "spot_1", 3: "spot_2"} {
+		if name := v.Entities().Get(entities[i]).ValueForKey("targetname"); name != expected {
+			t.Errorf("expected pasted entity %d to be named %s, got %s", i, expected, name)
+		}
+	}
+
+	loaded := saveAndLoad(t, v)
+	if len(loaded.Worldspawn().Solids) != 6 || loaded.Entities().Length() != 7 {
+		t.Fatalf("expected 6 world solids and 7 entities after saving, got %d and %d",
+			len(loaded.Worldspawn().Solids), loaded.Entities().Length())
+	}
+	if len(loaded.EntitySolids(entities[0])) != 2 || loaded.Entities().Get(entities[0]).ValueForKey("classname") != "func_detail" {
+		t.Error("expected the pasted func_detail to keep its solids after saving")
+	}
+}
+
+func TestPasteMovesDisplacement(t *testing.T) {
+	v, err := LoadVmf("testdata/displacement.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := CopyToText(v.Worldspawn().Solids, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultPasteOptions()
+	options.Copies = 2
+	options.Offset = mgl32.Vec3{0, 0, 128}
+
+	solids, _, err := v.Paste(text, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each copy has its own dispinfo that is moved along with it
+	for i, expected := range []string{"[-64 -64 128]", "[-64 -64 256]"} {
+		if start := dispProperty(&solids[i].Sides[0], "", "startposition"); start != expected {
+			t.Errorf("expected copy %d of the displacement to start at %s, got %s", i, expected, start)
+		}
+	}
+}
+
+func TestRotateDisplacement(t *testing.T) {
+	v, err := LoadVmf("testdata/displacement.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solid := v.Worldspawn().Solids[0].Clone()
+	solid.Rotate(mgl32.Vec3{}, world.RotationFromAngles(mgl32.Vec3{90, 0, 0}))
+
+	side := &solid.Sides[0]
+	start := dispProperty(side, "", "startposition")
+	if world.NewVec3FromString(start).Sub(mgl32.Vec3{-64, 0, -64}).Len() > 0.001 {
+		t.Errorf("expected the rotated displacement to start at [-64 0 -64], got %s", start)
+	}
+	if row := dispProperty(side, "normals", "row0"); row != "0 -1 0 0 -1 0 0 -1 0 0 -1 0 0 -1 0" {
+		t.Errorf("expected the normals to be rotated, got %s", row)
+	}
+	if row := dispProperty(side, "distances", "row0"); row != "0 8 16 8 0" {
+		t.Errorf("expected the distances to stay the same, got %s", row)
+	}
+
+	if row := dispProperty(&v.Worldspawn().Solids[0].Sides[0], "normals", "row0"); row != "0 0 1 0 0 1 0 0 1 0 0 1 0 0 1" {
+		t.Errorf("expected the original normals to stay the same, got %s", row)
+	}
+}
@@ -0,0 +1,123 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/emily33901/go-forgery/settings"
+)
+
+// cmdSeqSignature is at the start of every CmdSeq.wc
+const cmdSeqSignature = "Worldcraft Command Sequences\r\n\x1a"
+
+// cmdSeqCommand is a command as it is laid out on disk.
+// Files from version 0.2 on have a NoWait int32 after it
+type cmdSeqCommand struct {
+	Enabled       int32
+	Special       int32
+	Run           [260]byte
+	Params        [260]byte
+	LongFilenames int32 // obsolete but still in the file
+	EnsureCheck   int32
+	EnsureFile    [260]byte
+	UseProcWnd    int32
+}
+
+// cString converts a fixed size nul terminated string
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// ImportCmdSeq reads the compile sequences from a Hammer CmdSeq.wc
+func ImportCmdSeq(filePath string) ([]*settings.CompileSequence, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadCmdSeq(file)
+}
+
+// ReadCmdSeq reads compile sequences from a CmdSeq.wc stream
+func ReadCmdSeq(r io.Reader) ([]*settings.CompileSequence, error) {
+	signature := make([]byte, len(cmdSeqSignature))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return nil, err
+	}
+	if string(signature) != cmdSeqSignature {
+		return nil, errors.New("not a command sequence file")
+	}
+
+	var version float32
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, errors.New("bad sequence count")
+	}
+
+	sequences := make([]*settings.CompileSequence, 0, count)
+	for i := int32(0); i < count; i++ {
+		var name [128]byte
+		var commandCount int32
+
+		if err := binary.Read(r, binary.LittleEndian, &name); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &commandCount); err != nil {
+			return nil, err
+		}
+		if commandCount < 0 {
+			return nil, errors.New("bad command count")
+		}
+
+		sequence := &settings.CompileSequence{
+			Name:     cString(name[:]),
+			Commands: make([]*settings.CompileCommand, 0, commandCount),
+		}
+
+		for j := int32(0); j < commandCount; j++ {
+			var c cmdSeqCommand
+			if err := binary.Read(r, binary.LittleEndian, &c); err != nil {
+				return nil, err
+			}
+
+			command := &settings.CompileCommand{
+				Enabled:          c.Enabled != 0,
+				Special:          int(c.Special),
+				Run:              cString(c.Run[:]),
+				Params:           cString(c.Params[:]),
+				EnsureCheck:      c.EnsureCheck != 0,
+				EnsureFile:       cString(c.EnsureFile[:]),
+				UseProcessWindow: c.UseProcWnd != 0,
+			}
+
+			// No wait was added in version 0.2
+			if version >= 0.2 {
+				var noWait int32
+				if err := binary.Read(r, binary.LittleEndian, &noWait); err != nil {
+					return nil, err
+				}
+				command.NoWait = noWait != 0
+			}
+
+			sequence.Commands = append(sequence.Commands, command)
+		}
+
+		sequences = append(sequences, sequence)
+	}
+
+	return sequences, nil
+}
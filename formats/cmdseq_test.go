@@ -0,0 +1,82 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/emily33901/go-forgery/settings"
+)
+
+func TestImportCmdSeq(t *testing.T) {
+	sequences, err := ImportCmdSeq("testdata/CmdSeq.wc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sequences) != 2 {
+		t.Fatalf("expected 2 sequences, got %d", len(sequences))
+	}
+	if sequences[0].Name != "Default" || sequences[1].Name != "Only entities" {
+		t.Errorf("unexpected sequence names %q %q", sequences[0].Name, sequences[1].Name)
+	}
+	if len(sequences[0].Commands) != 5 || len(sequences[1].Commands) != 1 {
+		t.Fatalf("unexpected command counts %d %d", len(sequences[0].Commands), len(sequences[1].Commands))
+	}
+
+	expected := []settings.CompileCommand{
+		{Enabled: true, Run: "$bsp_exe", Params: "-game $gamedir $path\\$file", UseProcessWindow: true},
+		{Enabled: true, Run: "$vis_exe", Params: "-game $gamedir $path\\$file", UseProcessWindow: true},
+		{Enabled: false, Run: "$light_exe", Params: "-game $gamedir $path\\$file", UseProcessWindow: true},
+		{Enabled: true, Special: settings.SpecialCopyFile, Params: "$path\\$file.bsp $bspdir\\$file.bsp",
+			EnsureCheck: true, EnsureFile: "$bspdir\\$file.bsp"},
+		{Enabled: true, Run: "$game_exe", Params: "-game $gamedir +map $file", NoWait: true},
+	}
+
+	for i, c := range sequences[0].Commands {
+		if *c != expected[i] {
+			t.Errorf("command %d: expected %+v, got %+v", i, expected[i], *c)
+		}
+	}
+}
+
+func TestReadCmdSeqVersion01(t *testing.T) {
+	// Files from before 0.2 do not have NoWait after each command
+	var buf bytes.Buffer
+	buf.WriteString(cmdSeqSignature)
+	binary.Write(&buf, binary.LittleEndian, float32(0.1))
+	binary.Write(&buf, binary.LittleEndian, int32(1))
+
+	var name [128]byte
+	copy(name[:], "Old")
+	binary.Write(&buf, binary.LittleEndian, name)
+	binary.Write(&buf, binary.LittleEndian, int32(2))
+
+	for _, run := range []string{"first", "second"} {
+		c := cmdSeqCommand{Enabled: 1, LongFilenames: 1, UseProcWnd: 1}
+		copy(c.Run[:], run)
+		binary.Write(&buf, binary.LittleEndian, &c)
+	}
+
+	sequences, err := ReadCmdSeq(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sequences) != 1 || len(sequences[0].Commands) != 2 {
+		t.Fatalf("expected 1 sequence with 2 commands")
+	}
+
+	for i, run := range []string{"first", "second"} {
+		c := sequences[0].Commands[i]
+		if c.Run != run || !c.Enabled || !c.UseProcessWindow || c.NoWait {
+			t.Errorf("command %d: unexpected %+v", i, *c)
+		}
+	}
+}
+
+func TestReadCmdSeqBadSignature(t *testing.T) {
+	if _, err := ReadCmdSeq(bytes.NewReader([]byte("Not a command sequence file at all"))); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,107 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/emily33901/go-forgery/settings"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// findString finds a child of kv and returns its value or "" if it does not exist
+func findString(kv *keyvalues.KeyValue, key string) string {
+	child, err := kv.Find(key)
+	if err != nil {
+		return ""
+	}
+
+	return KeyValueString(child)
+}
+
+// keySpace stands in for spaces in block names while they are being parsed
+const keySpace = "\x1f"
+
+// escapeBlockNames replaces the spaces in lines that are only a quoted name
+// (e.g. "Counter-Strike: Global Offensive") as the keyvalues reader would
+// otherwise split them into a key and a value
+func escapeBlockNames(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) > 1 && strings.Count(trimmed, "\"") == 2 &&
+			strings.HasPrefix(trimmed, "\"") && strings.HasSuffix(trimmed, "\"") {
+			lines[i] = strings.Replace(line, " ", keySpace, -1)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// ImportGameConfig reads the games from a Hammer GameConfig.txt
+func ImportGameConfig(filePath string) ([]*settings.GameConfig, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ReadKeyValuesFromReader(bytes.NewReader(escapeBlockNames(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	return gameConfigsFromKeyValues(root)
+}
+
+func gameConfigsFromKeyValues(root *keyvalues.KeyValue) ([]*settings.GameConfig, error) {
+	// The root is normally "Configs" but older files can have "Games" at the top
+	games := root
+	if !strings.EqualFold(root.Key(), "games") {
+		var err error
+		games, err = root.Find("Games")
+		if err != nil {
+			return nil, errors.New("file does not contain any games")
+		}
+	}
+
+	children, err := games.Children()
+	if err != nil {
+		return nil, errors.New("file does not contain any games")
+	}
+
+	configs := make([]*settings.GameConfig, 0, len(children))
+	for _, game := range children {
+		if !game.HasChildren() {
+			continue
+		}
+
+		config := &settings.GameConfig{
+			Name:    strings.Replace(game.Key(), keySpace, " ", -1),
+			GameDir: findString(game, "GameDir"),
+		}
+
+		if hammer, err := game.Find("Hammer"); err == nil {
+			// FGDs are numbered GameData0, GameData1...
+			for i := 0; ; i++ {
+				fgd := findString(hammer, "GameData"+strconv.Itoa(i))
+				if fgd == "" {
+					break
+				}
+				config.FGDs = append(config.FGDs, fgd)
+			}
+
+			config.GameExe = findString(hammer, "GameExe")
+			config.BSP = findString(hammer, "BSP")
+			config.VIS = findString(hammer, "Vis")
+			config.RAD = findString(hammer, "Light")
+			config.MapDir = findString(hammer, "BSPDir")
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,53 @@
+package formats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportGameConfig(t *testing.T) {
+	configs, err := ImportGameConfig("testdata/GameConfig.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(configs))
+	}
+
+	const steam = "C:\\Steam\\steamapps\\common\\Counter-Strike Global Offensive"
+
+	csgo := configs[0]
+	if csgo.Name != "Counter-Strike: Global Offensive" {
+		t.Errorf("unexpected name %q", csgo.Name)
+	}
+	if csgo.GameDir != steam+"\\csgo" {
+		t.Errorf("unexpected game directory %q", csgo.GameDir)
+	}
+
+	fgds := []string{steam + "\\bin\\csgo.fgd", steam + "\\bin\\extra.fgd"}
+	if !reflect.DeepEqual(csgo.FGDs, fgds) {
+		t.Errorf("expected fgds %q, got %q", fgds, csgo.FGDs)
+	}
+
+	tools := map[string][2]string{
+		"GameExe": {csgo.GameExe, steam + "\\csgo.exe"},
+		"BSP":     {csgo.BSP, steam + "\\bin\\vbsp.exe"},
+		"Vis":     {csgo.VIS, steam + "\\bin\\vvis.exe"},
+		"Light":   {csgo.RAD, steam + "\\bin\\vrad.exe"},
+		"BSPDir":  {csgo.MapDir, steam + "\\csgo\\maps"},
+	}
+	for key, values := range tools {
+		if values[0] != values[1] {
+			t.Errorf("%s: expected %q, got %q", key, values[1], values[0])
+		}
+	}
+
+	hl2 := configs[1]
+	if hl2.Name != "Half-Life 2" || hl2.GameDir != "C:\\Steam\\steamapps\\common\\Half-Life 2\\hl2" {
+		t.Errorf("unexpected second game %+v", *hl2)
+	}
+	if len(hl2.FGDs) != 0 || hl2.BSP != "" {
+		t.Errorf("expected the second game to have no hammer settings, got %+v", *hl2)
+	}
+}
@@ -0,0 +1,132 @@
+package formats
+
+import (
+	"errors"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Group puts the solids with ids (or the groups that they are already in)
+// into a new group
+func (vmf *Vmf) Group(ids []int) (*world.Group, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("nothing to group")
+	}
+
+	group := world.NewGroup(vmf.NextObjectId(), world.NewEditor(mgl32.Vec3{220, 220, 220}, true, true))
+
+	for _, id := range ids {
+		solid := vmf.world.Solid(id)
+		if solid == nil {
+			continue
+		}
+
+		// Solids that are already grouped bring their whole group with them
+		if root := vmf.world.SolidRootGroup(solid); root != nil {
+			if root.Editor == nil {
+				root.Editor = world.NewEditor(mgl32.Vec3{220, 220, 220}, true, true)
+			}
+			root.Editor.GroupId = group.Id
+		} else {
+			if solid.Editor == nil {
+				solid.Editor = world.NewEditor(mgl32.Vec3{0, 255, 0}, true, true)
+			}
+			solid.Editor.GroupId = group.Id
+		}
+	}
+
+	vmf.world.AddGroup(group)
+
+	return group, nil
+}
+
+// Ungroup removes the outermost groups of the solids with ids
+// Anything that was directly in those groups is no longer grouped
+// Returns the number of groups that were removed
+func (vmf *Vmf) Ungroup(ids []int) int {
+	roots := map[int]bool{}
+	for _, id := range ids {
+		if solid := vmf.world.Solid(id); solid != nil {
+			if root := vmf.world.SolidRootGroup(solid); root != nil {
+				roots[root.Id] = true
+			}
+		}
+	}
+
+	for _, s := range vmf.world.Solids {
+		if s.Editor != nil && roots[s.Editor.GroupId] {
+			s.Editor.GroupId = 0
+		}
+	}
+
+	for _, g := range vmf.world.Groups {
+		if g.Editor != nil && roots[g.Editor.GroupId] {
+			g.Editor.GroupId = 0
+		}
+	}
+
+	for id := range roots {
+		vmf.world.RemoveGroup(id)
+	}
+
+	return len(roots)
+}
+
+// HideSolids marks the solids with ids as hidden. Brush entities
+// that own any of the solids are hidden as a whole
+// Returns the ids of every solid that was hidden
+func (vmf *Vmf) HideSolids(ids []int) []int {
+	hidden := make([]int, 0, len(ids))
+
+	for _, id := range ids {
+		if solid := vmf.world.Solid(id); solid != nil {
+			if !solid.Hidden {
+				solid.Hidden = true
+				hidden = append(hidden, id)
+			}
+		} else if index := vmf.EntityForSolid(id); index != -1 && !vmf.hiddenEntities[index] {
+			hidden = append(hidden, vmf.hideEntity(index)...)
+		}
+	}
+
+	return hidden
+}
+
+// hideEntity hides an entity along with its solids
+// Returns the ids of the solids
+func (vmf *Vmf) hideEntity(index int) []int {
+	vmf.hiddenEntities[index] = true
+
+	ids := make([]int, 0, len(vmf.entitySolids[index]))
+	for _, s := range vmf.entitySolids[index] {
+		s.Hidden = true
+		ids = append(ids, s.Id)
+	}
+
+	return ids
+}
+
+// UnhideAll shows everything that was hidden
+// Returns the ids of the solids that are no longer hidden
+func (vmf *Vmf) UnhideAll() []int {
+	shown := make([]int, 0)
+
+	for _, s := range vmf.world.Solids {
+		if s.Hidden {
+			s.Hidden = false
+			shown = append(shown, s.Id)
+		}
+	}
+
+	for index := range vmf.hiddenEntities {
+		for _, s := range vmf.entitySolids[index] {
+			s.Hidden = false
+			shown = append(shown, s.Id)
+		}
+	}
+
+	vmf.hiddenEntities = map[int]bool{}
+
+	return shown
+}
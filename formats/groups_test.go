@@ -0,0 +1,152 @@
+package formats
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedIds(ids []int) []int {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+	return sorted
+}
+
+func TestGroupRoundTrip(t *testing.T) {
+	v, err := LoadVmf("testdata/edit.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(v *Vmf) error
+
+		// What each world solid is grouped with after saving
+		groups map[int][]int
+	}{
+		{
+			name:   "ungrouped",
+			edit:   func(v *Vmf) error { return nil },
+			groups: map[int][]int{2: {2}, 9: {9}},
+		},
+		{
+			name: "grouped separately",
+			edit: func(v *Vmf) error {
+				if _, err := v.Group([]int{2}); err != nil {
+					return err
+				}
+				_, err := v.Group([]int{9})
+				return err
+			},
+			groups: map[int][]int{2: {2}, 9: {9}},
+		},
+		{
+			name: "groups grouped together",
+			edit: func(v *Vmf) error {
+				_, err := v.Group([]int{2, 9})
+				return err
+			},
+			groups: map[int][]int{2: {2, 9}, 9: {2, 9}},
+		},
+		{
+			name: "outer group removed",
+			edit: func(v *Vmf) error {
+				if removed := v.Ungroup([]int{9}); removed != 1 {
+					t.Errorf("expected 1 group to be removed, got %d", removed)
+				}
+				return nil
+			},
+			groups: map[int][]int{2: {2}, 9: {9}},
+		},
+		{
+			name: "inner groups removed",
+			edit: func(v *Vmf) error {
+				if removed := v.Ungroup([]int{2, 9}); removed != 2 {
+					t.Errorf("expected 2 groups to be removed, got %d", removed)
+				}
+				return nil
+			},
+			groups: map[int][]int{2: {2}, 9: {9}},
+		},
+	}
+
+	// Each step carries on from the map that the last one saved
+	groupCounts := []int{0, 2, 3, 2, 0}
+	for i, test := range tests {
+		if err := test.edit(v); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		v = saveAndLoad(t, v)
+
+		if len(v.Worldspawn().Groups) != groupCounts[i] {
+			t.Errorf("%s: expected %d groups after saving, got %d", test.name, groupCounts[i], len(v.Worldspawn().Groups))
+		}
+
+		for id, expected := range test.groups {
+			if got := sortedIds(v.Worldspawn().GroupSolids(id)); !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: expected solid %d to be grouped with %v, got %v", test.name, id, expected, got)
+			}
+		}
+	}
+}
+
+func TestGroupNothing(t *testing.T) {
+	v, err := LoadVmf("testdata/edit.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Group(nil); err == nil {
+		t.Error("expected an error grouping nothing")
+	}
+}
+
+func TestHideRoundTrip(t *testing.T) {
+	v, err := LoadVmf("testdata/edit.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hiding one solid of the func_detail hides all of it
+	if hidden := sortedIds(v.HideSolids([]int{2, 17})); !reflect.DeepEqual(hidden, []int{2, 17, 26}) {
+		t.Errorf("expected solids [2 17 26] to be hidden, got %v", hidden)
+	}
+	if hidden := v.HideSolids([]int{2, 26}); len(hidden) != 0 {
+		t.Errorf("expected nothing more to be hidden, got %v", hidden)
+	}
+
+	v = saveAndLoad(t, v)
+
+	if !v.Worldspawn().Solid(2).Hidden || v.Worldspawn().Solid(9).Hidden {
+		t.Error("expected only solid 2 of the world to be hidden after saving")
+	}
+
+	detail := v.EntityForSolid(17)
+	if detail == -1 || !v.EntityHidden(detail) || v.Entities().Get(detail).ValueForKey("classname") != "func_detail" {
+		t.Fatal("expected the func_detail to be hidden after saving")
+	}
+	for _, s := range v.EntitySolids(detail) {
+		if !s.Hidden {
+			t.Errorf("expected solid %d of the func_detail to be hidden", s.Id)
+		}
+	}
+
+	if shown := sortedIds(v.UnhideAll()); !reflect.DeepEqual(shown, []int{2, 17, 26}) {
+		t.Errorf("expected solids [2 17 26] to be shown, got %v", shown)
+	}
+
+	v = saveAndLoad(t, v)
+
+	for _, s := range v.Worldspawn().Solids {
+		if s.Hidden {
+			t.Errorf("expected solid %d to be shown after saving", s.Id)
+		}
+	}
+	for i := 0; i < v.Entities().Length(); i++ {
+		if v.EntityHidden(i) {
+			t.Errorf("expected entity %d to be shown after saving", i)
+		}
+	}
+}
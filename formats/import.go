@@ -0,0 +1,127 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Shaders that imported materials can use
+const (
+	ShaderLightmappedGeneric = "LightmappedGeneric"
+	ShaderVertexLitGeneric   = "VertexLitGeneric"
+)
+
+// TextureImportOptions are how an image is turned into a texture and material
+type TextureImportOptions struct {
+	VtfImportOptions
+
+	// Shader is ShaderLightmappedGeneric for brushes or ShaderVertexLitGeneric for models
+	Shader      string
+	SurfaceProp string
+	Translucent bool
+
+	// Overwrite replaces a texture or material that is already there
+	Overwrite bool
+}
+
+// ReadImage reads a png or tga
+func ReadImage(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png":
+		return png.Decode(file)
+	case ".tga":
+		return ReadTga(file)
+	}
+
+	return nil, fmt.Errorf("%s is not a png or tga", filepath.Base(filename))
+}
+
+// looseMaterialName turns anything from "materials/x/y.vmt" to "x/y" into the name of a material
+func looseMaterialName(name string) string {
+	name = strings.ToLower(strings.Trim(filepath.ToSlash(strings.TrimSpace(name)), "/"))
+	name = strings.TrimPrefix(name, "materials/")
+
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".vmt"), ".vtf")
+}
+
+// writeLooseFile writes a file under gameDir, making any directories that it needs
+func writeLooseFile(gameDir string, path string, data []byte) error {
+	dest := filepath.Join(gameDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(dest, data, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// ImportTexture turns an image into a vtf and a vmt named name (like custom/wall)
+// in the materials directory of gameDir. Returns the paths that were written relative to gameDir
+func ImportTexture(gameDir string, name string, img image.Image, options TextureImportOptions) ([]string, error) {
+	name = looseMaterialName(name)
+	if name == "" {
+		return nil, errors.New("the material needs a name")
+	}
+
+	switch options.Shader {
+	case ShaderLightmappedGeneric, ShaderVertexLitGeneric:
+	default:
+		return nil, fmt.Errorf("materials cannot be made with %s", options.Shader)
+	}
+
+	vtfPath := "materials/" + name + ".vtf"
+	vmtPath := "materials/" + name + ".vmt"
+	if !options.Overwrite {
+		for _, p := range []string{vtfPath, vmtPath} {
+			if _, err := os.Stat(filepath.Join(gameDir, filepath.FromSlash(p))); err == nil {
+				return nil, fmt.Errorf("%s already exists", p)
+			}
+		}
+	}
+
+	v, err := NewVtfFromImage(img, options.VtfImportOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	vtfData := &bytes.Buffer{}
+	if err := WriteVtf(v, vtfData); err != nil {
+		return nil, err
+	}
+
+	// The vtf goes first so that the material never points at a texture that is not there
+	if err := writeLooseFile(gameDir, vtfPath, vtfData.Bytes()); err != nil {
+		return nil, err
+	}
+
+	vmt := &EditableVmt{Shader: options.Shader}
+	vmt.Set("$basetexture", name)
+	if options.SurfaceProp != "" {
+		vmt.Set("$surfaceprop", options.SurfaceProp)
+	}
+	if options.Translucent {
+		vmt.Set("$translucent", "1")
+	}
+
+	if _, err := SaveVmt(gameDir, name, vmt); err != nil {
+		return nil, err
+	}
+
+	return []string{vtfPath, vmtPath}, nil
+}
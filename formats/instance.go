@@ -0,0 +1,400 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/galaco/source-tools-common/entity"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	FixupPrefix  = 0
+	FixupPostfix = 1
+	FixupNone    = 2
+)
+
+// maxInstanceDepth stops instances that include themselves from loading forever
+const maxInstanceDepth = 8
+
+// Instance is a func_instance and the vmf that it refers to
+type Instance struct {
+	// Index of the func_instance in the entities of the vmf that it is in
+	Index int
+
+	// File is the file key of the func_instance and Path is where it was found on disk
+	File string
+	Path string
+	Vmf  *Vmf
+
+	Origin mgl32.Vec3
+	Angles mgl32.Vec3
+
+	Name       string
+	FixupStyle int
+
+	// Replacements maps $parameters to their values
+	Replacements map[string]string
+	// MaterialReplacements maps materials to what they should be replaced with
+	MaterialReplacements map[string]string
+
+	// Instances inside of this instance
+	Children []*Instance
+}
+
+// LoadInstances loads the vmfs for all the func_instances in the vmf
+// Instances that cannot be loaded (including those nested inside of others)
+// are reported in the error but do not stop the rest from loading
+func (vmf *Vmf) LoadInstances() ([]*Instance, error) {
+	return vmf.loadInstances(0)
+}
+
+func (vmf *Vmf) loadInstances(depth int) ([]*Instance, error) {
+	instances := make([]*Instance, 0)
+	failed := make([]string, 0)
+
+	if depth >= maxInstanceDepth {
+		return instances, errors.New("instances are nested too deeply")
+	}
+
+	for i := 0; i < vmf.entities.Length(); i++ {
+		e := vmf.entities.Get(i)
+		if e.ValueForKey("classname") != "func_instance" || e.ValueForKey("file") == "" {
+			continue
+		}
+
+		// An instance can still be returned when only its children failed
+		instance, err := vmf.loadInstance(i, depth)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", e.ValueForKey("file"), err))
+		}
+
+		if instance != nil {
+			instances = append(instances, instance)
+		}
+	}
+
+	if len(failed) > 0 {
+		return instances, fmt.Errorf("unable to load instances: %s", strings.Join(failed, ", "))
+	}
+
+	return instances, nil
+}
+
+func (vmf *Vmf) loadInstance(index int, depth int) (*Instance, error) {
+	e := vmf.entities.Get(index)
+
+	instance := &Instance{
+		Index:                index,
+		File:                 e.ValueForKey("file"),
+		Origin:               e.VectorForKey("origin"),
+		Angles:               e.VectorForKey("angles"),
+		Name:                 e.ValueForKey("targetname"),
+		FixupStyle:           e.IntForKey("fixup_style"),
+		Replacements:         map[string]string{},
+		MaterialReplacements: map[string]string{},
+	}
+
+	// This matches what vbsp does for unnamed instances
+	if instance.Name == "" {
+		instance.Name = fmt.Sprintf("InstanceAuto%d", index)
+	}
+
+	for ep := e.EPairs; ep != nil; ep = ep.Next {
+		if !strings.HasPrefix(strings.ToLower(ep.Key), "replace") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSpace(ep.Value), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(parts[0], "$"):
+			instance.Replacements[parts[0]] = parts[1]
+		case strings.HasPrefix(parts[0], "#"):
+			instance.MaterialReplacements[strings.ToLower(parts[0][1:])] = parts[1]
+		}
+	}
+
+	path, err := vmf.ResolveInstancePath(instance.File)
+	if err != nil {
+		return nil, err
+	}
+	instance.Path = path
+
+	instance.Vmf, err = LoadVmf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Children that did load are kept along with the error for the ones that did not
+	instance.Children, err = instance.Vmf.loadInstances(depth + 1)
+
+	return instance, err
+}
+
+// ResolveInstancePath finds an instance file on disk. Instances are relative to
+// the map, or to a parent directory of the map (usually the maps root)
+func (vmf *Vmf) ResolveInstancePath(file string) (string, error) {
+	if vmf.filepath == "" {
+		return "", errors.New("map has not been saved so instances cannot be found")
+	}
+
+	file = filepath.FromSlash(strings.Replace(file, "\\", "/", -1))
+	if filepath.Ext(file) == "" {
+		file += ".vmf"
+	}
+
+	dir := filepath.Dir(vmf.filepath)
+	for {
+		candidate := filepath.Join(dir, file)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return "", fmt.Errorf("unable to find %s", file)
+}
+
+func (instance *Instance) rotation() mgl32.Mat3 {
+	return world.MatrixFromEntityAngles(instance.Angles)
+}
+
+// FixupName applies the instances name fixup to an entity name
+func (instance *Instance) FixupName(name string) string {
+	// Names starting with these are global and not fixed up
+	if name == "" || name[0] == '@' || name[0] == '!' {
+		return name
+	}
+
+	switch instance.FixupStyle {
+	case FixupPrefix:
+		return instance.Name + "-" + name
+	case FixupPostfix:
+		return name + "-" + instance.Name
+	}
+
+	return name
+}
+
+// ReplaceParameters replaces all the $parameters in value
+func (instance *Instance) ReplaceParameters(value string) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+
+	// Longer parameters first so that $a does not replace part of $ab
+	params := make([]string, 0, len(instance.Replacements))
+	for k := range instance.Replacements {
+		params = append(params, k)
+	}
+	sort.Slice(params, func(i, j int) bool { return len(params[i]) > len(params[j]) })
+
+	for _, param := range params {
+		value = strings.Replace(value, param, instance.Replacements[param], -1)
+	}
+
+	return value
+}
+
+// transformSolid moves a solid from instance space into the space of the parent map
+func (instance *Instance) transformSolid(s *world.Solid) *world.Solid {
+	solid := s.Clone()
+
+	for i := range solid.Sides {
+		if replacement, ok := instance.MaterialReplacements[strings.ToLower(solid.Sides[i].Material)]; ok {
+			solid.Sides[i].Material = replacement
+		}
+	}
+
+	solid.Rotate(mgl32.Vec3{}, instance.rotation())
+	solid.Translate(instance.Origin)
+
+	return solid
+}
+
+// Solids returns all the visible solids in the instance (and instances inside of it)
+// transformed into the space of the parent map
+func (instance *Instance) Solids() []*world.Solid {
+	solids := make([]*world.Solid, 0)
+
+	for _, s := range instance.Vmf.world.Solids {
+		if !s.Hidden {
+			solids = append(solids, instance.transformSolid(s))
+		}
+	}
+
+	for i := 0; i < instance.Vmf.entities.Length(); i++ {
+		if instance.Vmf.hiddenEntities[i] {
+			continue
+		}
+
+		for _, s := range instance.Vmf.entitySolids[i] {
+			solids = append(solids, instance.transformSolid(s))
+		}
+	}
+
+	for _, child := range instance.Children {
+		for _, s := range child.Solids() {
+			solids = append(solids, instance.transformSolid(s))
+		}
+	}
+
+	return solids
+}
+
+// fixupEntity applies parameters, name fixups and the instance transform to an entity
+func (instance *Instance) fixupEntity(e *entity.Entity) *entity.Entity {
+	ent := cloneEntity(e)
+
+	for ep := ent.EPairs; ep != nil; ep = ep.Next {
+		ep.Value = instance.ReplaceParameters(ep.Value)
+	}
+
+	for _, key := range append([]string{"targetname"}, entityNameKeys[:]...) {
+		if value := ent.ValueForKey(key); value != "" {
+			setKeyValue(ent, key, instance.FixupName(value))
+		}
+	}
+
+	for _, key := range entityMaterialKeys {
+		if replacement, ok := instance.MaterialReplacements[strings.ToLower(ent.ValueForKey(key))]; ok {
+			setKeyValue(ent, key, replacement)
+		}
+	}
+
+	transformEntity(ent, mgl32.Vec3{}, instance.rotation(), instance.Origin)
+
+	return ent
+}
+
+// fixupConnection applies parameters and name fixups to an output
+func (instance *Instance) fixupConnection(value string) string {
+	return renameOutputTarget(instance.ReplaceParameters(value), instance.FixupName)
+}
+
+// renameOutputTarget passes the name of the entity that an output fires at through rename
+func renameOutputTarget(value string, rename func(string) string) string {
+	// Newer files seperate with escape characters and older ones with commas
+	separator := ","
+	if strings.Contains(value, "\x1b") {
+		separator = "\x1b"
+	}
+
+	parts := strings.Split(value, separator)
+	parts[0] = rename(parts[0])
+
+	return strings.Join(parts, separator)
+}
+
+// CollapseInstance copies everything inside of an instance into the vmf and then
+// removes the func_instance. Instances from LoadInstances are no longer valid after this
+// Returns the solids that were added to the world and to brush entities
+func (vmf *Vmf) CollapseInstance(instance *Instance) ([]*world.Solid, error) {
+	e := vmf.entities.Get(instance.Index)
+	if e == nil || e.ValueForKey("classname") != "func_instance" {
+		return nil, errors.New("instance is out of date")
+	}
+
+	newSolids := make([]*world.Solid, 0)
+
+	for _, s := range instance.Vmf.world.Solids {
+		solid := instance.transformSolid(s)
+		vmf.renumberSolid(solid)
+
+		vmf.world.AddSolid(solid)
+		newSolids = append(newSolids, solid)
+	}
+
+	for i := 0; i < instance.Vmf.entities.Length(); i++ {
+		ent := instance.fixupEntity(instance.Vmf.entities.Get(i))
+		setKeyValue(ent, "id", fmt.Sprintf("%d", vmf.NextObjectId()))
+
+		// Instances inside of this one need to be found from the parent map now
+		if ent.ValueForKey("classname") == "func_instance" {
+			for _, child := range instance.Children {
+				if child.Index != i {
+					continue
+				}
+
+				if rel, err := filepath.Rel(filepath.Dir(vmf.filepath), child.Path); err == nil {
+					setKeyValue(ent, "file", filepath.ToSlash(rel))
+				}
+			}
+		}
+
+		blocks := cloneBlocks(instance.Vmf.entityBlocks[i], instance.fixupConnection)
+
+		solids := make([]*world.Solid, 0)
+		for _, s := range instance.Vmf.entitySolids[i] {
+			solid := instance.transformSolid(s)
+			vmf.renumberSolid(solid)
+			solids = append(solids, solid)
+		}
+
+		if !instance.Vmf.hiddenEntities[i] {
+			newSolids = append(newSolids, solids...)
+		}
+
+		index := vmf.entities.Add(ent)
+		vmf.entityBlocks[index] = blocks
+		vmf.entitySolids[index] = solids
+		if instance.Vmf.hiddenEntities[i] {
+			vmf.hideEntity(index)
+		}
+	}
+
+	vmf.removeEntity(instance.Index)
+
+	return newSolids, nil
+}
+
+// renumberSolid gives a solid and its sides new ids
+func (vmf *Vmf) renumberSolid(solid *world.Solid) {
+	solid.Id = vmf.NextObjectId()
+	for i := range solid.Sides {
+		solid.Sides[i].Id = vmf.NextSideId()
+	}
+
+	// Groups are not brought across
+	if solid.Editor != nil {
+		solid.Editor.GroupId = 0
+	}
+}
+
+// removeEntity removes the entity at index and moves everything after it down
+func (vmf *Vmf) removeEntity(index int) {
+	count := vmf.entities.Length()
+	entities := make([]entity.Entity, 0, count)
+
+	for i := 0; i < count; i++ {
+		if i != index {
+			entities = append(entities, *vmf.entities.Get(i))
+		}
+	}
+
+	for i := index; i < count-1; i++ {
+		vmf.entityBlocks[i] = vmf.entityBlocks[i+1]
+		vmf.entitySolids[i] = vmf.entitySolids[i+1]
+		vmf.hiddenEntities[i] = vmf.hiddenEntities[i+1]
+	}
+
+	delete(vmf.entityBlocks, count-1)
+	delete(vmf.entitySolids, count-1)
+	delete(vmf.hiddenEntities, count-1)
+
+	vmf.entities = entity.NewEntityList(entities)
+}
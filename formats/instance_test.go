@@ -0,0 +1,117 @@
+package formats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestLoadInstances(t *testing.T) {
+	v, err := LoadVmf("testdata/instance.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := v.LoadInstances()
+
+	// The missing instance and the one missing from inside of outer are both reported
+	if err == nil || !strings.Contains(err.Error(), "missing.vmf") || !strings.Contains(err.Error(), "nothere.vmf") {
+		t.Errorf("expected an error for both missing instances, got %v", err)
+	}
+
+	names := make([]string, 0)
+	for _, instance := range instances {
+		names = append(names, instance.Name)
+	}
+	if strings.Join(names, " ") != "outer disp" {
+		t.Fatalf("expected instances outer and disp, got %v", names)
+	}
+
+	outer := instances[0]
+	if len(outer.Children) != 1 || outer.Children[0].Name != "inner" {
+		t.Fatalf("expected outer to keep the instance inside of it that loaded, got %d children", len(outer.Children))
+	}
+
+	// The box in outer and the displacement inside of inner
+	if solids := outer.Solids(); len(solids) != 2 {
+		t.Errorf("expected 2 solids in outer, got %d", len(solids))
+	}
+}
+
+func TestInstanceAssets(t *testing.T) {
+	v, err := LoadVmf("testdata/instance.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ := v.LoadInstances()
+	if len(instances) == 0 || instances[0].Name != "outer" {
+		t.Fatal("expected outer to load")
+	}
+
+	// The sky and detail material of the instances are left out
+	expected := map[string]int{
+		"materials/concrete/concretefloat001.vmt": 1,
+		"materials/dev/dev_blendmeasure.vmt":      1,
+		"materials/tools/toolsnodraw.vmt":         10,
+	}
+
+	assets := instances[0].Assets()
+	if len(assets) != len(expected) {
+		t.Errorf("expected %d assets, got %d", len(expected), len(assets))
+	}
+
+	for _, asset := range assets {
+		if count, ok := expected[asset.Path]; !ok || asset.Count != count {
+			t.Errorf("expected %s to be used %d times, got %d", asset.Path, count, asset.Count)
+		}
+		if len(asset.Entities) != 1 || asset.Entities[0] != instances[0].Index {
+			t.Errorf("expected %s to be referred to by the func_instance, got %v", asset.Path, asset.Entities)
+		}
+	}
+}
+
+func TestInstanceMovesDisplacement(t *testing.T) {
+	v, err := LoadVmf("testdata/instance.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ := v.LoadInstances()
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(instances))
+	}
+	outer, disp := instances[0], instances[1]
+
+	// inner is moved up by 64 inside of outer, which is moved along by 256
+	solids := outer.Solids()
+	if start := dispProperty(&solids[1].Sides[0], "", "startposition"); start != "[192 -64 64]" {
+		t.Errorf("expected the displacement in inner to start at [192 -64 64], got %s", start)
+	}
+
+	// disp is turned around z and moved up by 128
+	solids, err = v.CollapseInstance(disp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solids) != 1 {
+		t.Fatalf("expected 1 collapsed solid, got %d", len(solids))
+	}
+
+	side := &solids[0].Sides[0]
+	start := dispProperty(side, "", "startposition")
+	if world.NewVec3FromString(start).Sub(mgl32.Vec3{64, -64, 128}).Len() > 0.001 {
+		t.Errorf("expected the collapsed displacement to start at [64 -64 128], got %s", start)
+	}
+	if row := dispProperty(side, "normals", "row0"); row != "0 0 1 0 0 1 0 0 1 0 0 1 0 0 1" {
+		t.Errorf("expected the normals to stay pointing up, got %s", row)
+	}
+
+	// The instance is left as it was
+	original := &disp.Vmf.Worldspawn().Solids[0].Sides[0]
+	if start := dispProperty(original, "", "startposition"); start != "[-64 -64 0]" {
+		t.Errorf("expected the displacement in the instance to stay at [-64 -64 0], got %s", start)
+	}
+}
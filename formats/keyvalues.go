@@ -1,6 +1,10 @@
 package formats
 
 import (
+	"io"
+	"os"
+	"strconv"
+
 	keyvalues "github.com/galaco/KeyValues"
 	"github.com/emily33901/lambda-core/core/filesystem"
 )
@@ -14,8 +18,39 @@ func ReadKeyValues(filePath string, fs filesystem.FileSystem) (*keyvalues.KeyVal
 		return nil, err
 	}
 
+	return ReadKeyValuesFromReader(stream)
+}
+
+// ReadKeyValuesFromDisk loads a keyvalues file that is not part of the game filesystem
+func ReadKeyValuesFromDisk(filePath string) (*keyvalues.KeyValue, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadKeyValuesFromReader(file)
+}
+
+// ReadKeyValuesFromReader loads keyvalues from a stream
+func ReadKeyValuesFromReader(stream io.Reader) (*keyvalues.KeyValue, error) {
 	reader := keyvalues.NewReader(stream)
 	kvs, err := reader.Read()
 
 	return &kvs, err
 }
+
+// KeyValueString returns the value of a keyvalue as a string whatever type it was parsed as
+func KeyValueString(kv *keyvalues.KeyValue) string {
+	if s, err := kv.AsString(); err == nil {
+		return s
+	}
+	if i, err := kv.AsInt(); err == nil {
+		return strconv.Itoa(int(i))
+	}
+	if f, err := kv.AsFloat(); err == nil {
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+
+	return ""
+}
@@ -0,0 +1,97 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Offsets into studiohdr_t, these are the same for all the mdl versions that we care about
+const (
+	mdlTextureCountOffset   = 204
+	mdlTextureIndexOffset   = 208
+	mdlCdTextureCountOffset = 212
+	mdlCdTextureIndexOffset = 216
+	mdlTextureSize          = 64
+)
+
+// ModelMaterials are the material names and the directories to look for them in from an mdl
+type ModelMaterials struct {
+	Names []string
+	Dirs  []string
+}
+
+func readMdlInt(data []byte, offset int) (int, error) {
+	if offset < 0 || offset+4 > len(data) {
+		return 0, errors.New("mdl is truncated")
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(data[offset:]))), nil
+}
+
+func readMdlString(data []byte, offset int) (string, error) {
+	if offset < 0 || offset >= len(data) {
+		return "", errors.New("mdl is truncated")
+	}
+
+	end := bytes.IndexByte(data[offset:], 0)
+	if end == -1 {
+		return "", errors.New("mdl is truncated")
+	}
+
+	return string(data[offset : offset+end]), nil
+}
+
+// ReadModelMaterials reads just the materials from an mdl without the rest of the model
+func ReadModelMaterials(r io.Reader) (*ModelMaterials, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 4 || string(data[:4]) != "IDST" {
+		return nil, errors.New("not an mdl")
+	}
+
+	header := make([]int, 4)
+	for i, offset := range []int{mdlTextureCountOffset, mdlTextureIndexOffset, mdlCdTextureCountOffset, mdlCdTextureIndexOffset} {
+		if header[i], err = readMdlInt(data, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ModelMaterials{}
+
+	for i := 0; i < header[0]; i++ {
+		texture := header[1] + i*mdlTextureSize
+
+		// The name is relative to the start of the texture
+		nameOffset, err := readMdlInt(data, texture)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := readMdlString(data, texture+nameOffset)
+		if err != nil {
+			return nil, err
+		}
+		result.Names = append(result.Names, name)
+	}
+
+	for i := 0; i < header[2]; i++ {
+		dirOffset, err := readMdlInt(data, header[3]+i*4)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := readMdlString(data, dirOffset)
+		if err != nil {
+			return nil, err
+		}
+		result.Dirs = append(result.Dirs, dir)
+	}
+
+	return result, nil
+}
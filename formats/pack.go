@@ -0,0 +1,348 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emily33901/lambda-core/core/filesystem"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// vmtTextureKeys are the material parameters that refer to a vtf
+var vmtTextureKeys = map[string]bool{
+	"$basetexture":          true,
+	"$basetexture2":         true,
+	"$bumpmap":              true,
+	"$bumpmap2":             true,
+	"$normalmap":            true,
+	"$normalmap2":           true,
+	"$detail":               true,
+	"$detail2":              true,
+	"$envmap":               true,
+	"$envmapmask":           true,
+	"$selfillummask":        true,
+	"$phongexponenttexture": true,
+	"$phongwarptexture":     true,
+	"$lightwarptexture":     true,
+	"$blendmodulatetexture": true,
+	"$texture2":             true,
+	"$dudvmap":              true,
+	"$refracttexture":       true,
+	"$reflecttexture":       true,
+	"$flowmap":              true,
+	"$flow_noise_texture":   true,
+	"$iris":                 true,
+	"$corneatexture":        true,
+	"$ambientoccltexture":   true,
+}
+
+// vmtMaterialKeys are the material parameters that refer to another vmt
+var vmtMaterialKeys = map[string]bool{
+	"include":             true,
+	"$bottommaterial":     true,
+	"$underwateroverlay":  true,
+	"$crackmaterial":      true,
+	"$fallbackmaterial":   true,
+	"$bottommaterial2":    true,
+	"$underwateroverlay2": true,
+}
+
+// modelFileExtensions are the files that go along with an mdl
+var modelFileExtensions = [...]string{
+	".vvd",
+	".phy",
+	".ani",
+	".vtx",
+	".dx90.vtx",
+	".dx80.vtx",
+	".sw.vtx",
+}
+
+// PackFile is a file that a map needs to be shipped with
+type PackFile struct {
+	Path string
+
+	// Stock files are part of the game and do not need packing
+	Stock   bool
+	Missing bool
+
+	// ReferencedBy is the asset or file that needs this one
+	ReferencedBy string
+}
+
+// Packer works out which files a map depends on
+type Packer struct {
+	fs      filesystem.IFileSystem
+	isStock func(path string) bool
+
+	files map[string]*PackFile
+}
+
+func NewPacker(fs filesystem.IFileSystem, isStock func(path string) bool) *Packer {
+	return &Packer{
+		fs:      fs,
+		isStock: isStock,
+		files:   map[string]*PackFile{},
+	}
+}
+
+// add adds a file to the pack and returns it, or nil if it has already been added
+func (p *Packer) add(filePath string, referencedBy string, optional bool) *PackFile {
+	filePath = strings.ToLower(filesystem.NormalisePath(filePath))
+	if _, ok := p.files[filePath]; ok {
+		return nil
+	}
+
+	f := &PackFile{
+		Path:         filePath,
+		ReferencedBy: referencedBy,
+	}
+
+	if _, err := p.fs.GetFile(filePath); err != nil {
+		// Optional files (like .ani) are left out when they dont exist
+		if optional {
+			return nil
+		}
+		f.Missing = true
+	} else {
+		f.Stock = p.isStock(filePath)
+	}
+
+	p.files[filePath] = f
+
+	// Stock files can only depend on other stock files
+	if f.Missing || f.Stock {
+		return nil
+	}
+
+	return f
+}
+
+func (p *Packer) read(filePath string) ([]byte, error) {
+	stream, err := p.fs.GetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(stream)
+}
+
+// addMaterial adds a vmt and then everything that it refers to
+func (p *Packer) addMaterial(filePath string, referencedBy string) {
+	f := p.add(filePath, referencedBy, false)
+	if f == nil {
+		return
+	}
+
+	data, err := p.read(f.Path)
+	if err != nil {
+		return
+	}
+
+	kv, err := ReadKeyValuesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	p.addMaterialParameters(kv, f.Path)
+}
+
+func (p *Packer) addMaterialParameters(kv *keyvalues.KeyValue, referencedBy string) {
+	children, _ := kv.Children()
+
+	for _, child := range children {
+		if child.HasChildren() {
+			// Patch materials and proxies keep parameters in sub blocks
+			p.addMaterialParameters(child, referencedBy)
+			continue
+		}
+
+		key := strings.ToLower(child.Key())
+		value := strings.ToLower(strings.TrimSpace(KeyValueString(child)))
+		if value == "" {
+			continue
+		}
+
+		switch {
+		case vmtTextureKeys[key]:
+			// env_cubemap comes from the bsp rather than a file
+			if value == "env_cubemap" {
+				continue
+			}
+			p.add(materialFilePath(value, ".vtf"), referencedBy, false)
+
+		case vmtMaterialKeys[key]:
+			p.addMaterial(materialFilePath(value, ".vmt"), referencedBy)
+		}
+	}
+}
+
+// materialFilePath turns a material parameter into a path in the materials folder
+func materialFilePath(name string, extension string) string {
+	name = strings.Replace(name, "\\", "/", -1)
+	name = strings.TrimPrefix(name, "/")
+	name = strings.TrimPrefix(name, "materials/")
+	name = strings.TrimSuffix(name, extension)
+
+	return "materials/" + name + extension
+}
+
+// addModel adds an mdl, the files that go with it and its materials
+func (p *Packer) addModel(filePath string, referencedBy string) {
+	f := p.add(filePath, referencedBy, false)
+	if f == nil {
+		return
+	}
+
+	base := strings.TrimSuffix(f.Path, ".mdl")
+	for _, ext := range modelFileExtensions {
+		p.add(base+ext, f.Path, true)
+	}
+
+	stream, err := p.fs.GetFile(f.Path)
+	if err != nil {
+		return
+	}
+
+	materials, err := ReadModelMaterials(stream)
+	if err != nil {
+		return
+	}
+
+	for _, name := range materials.Names {
+		// Models look for their materials in each of their directories in turn
+		found := ""
+		for _, dir := range materials.Dirs {
+			candidate := materialFilePath(path.Join(filesystem.NormalisePath(dir), name), ".vmt")
+			if _, err := p.fs.GetFile(candidate); err == nil {
+				found = candidate
+				break
+			}
+		}
+
+		if found == "" && len(materials.Dirs) > 0 {
+			found = materialFilePath(path.Join(filesystem.NormalisePath(materials.Dirs[0]), name), ".vmt")
+		}
+
+		if found != "" {
+			p.addMaterial(found, f.Path)
+		}
+	}
+}
+
+// AddAsset adds an asset and everything that it depends on
+func (p *Packer) AddAsset(asset *AssetReference) {
+	switch asset.Kind {
+	case AssetMaterial:
+		p.addMaterial(asset.Path, asset.Name)
+	case AssetModel:
+		p.addModel(asset.Path, asset.Name)
+	case AssetSound:
+		p.add(asset.Path, asset.Name, false)
+	}
+}
+
+// Files returns everything that has been added sorted by path
+func (p *Packer) Files() []*PackFile {
+	files := make([]*PackFile, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files
+}
+
+// PackFiles works out all the files that the vmf depends on
+// isStock decides which files are part of the game already
+func (vmf *Vmf) PackFiles(fs filesystem.IFileSystem, isStock func(path string) bool) []*PackFile {
+	p := NewPacker(fs, isStock)
+
+	for _, asset := range vmf.Assets() {
+		p.AddAsset(asset)
+	}
+
+	return p.Files()
+}
+
+// shouldPack returns whether a file needs to be written to the pack
+func (f *PackFile) shouldPack() bool {
+	return !f.Stock && !f.Missing
+}
+
+// WritePackDirectory copies the files that need packing into a directory tree
+// Returns the number of files that were written
+func WritePackDirectory(fs filesystem.IFileSystem, files []*PackFile, dir string) (int, error) {
+	count := 0
+
+	for _, f := range files {
+		if !f.shouldPack() {
+			continue
+		}
+
+		stream, err := fs.GetFile(f.Path)
+		if err != nil {
+			return count, fmt.Errorf("unable to read %s: %s", f.Path, err)
+		}
+
+		dest := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return count, err
+		}
+
+		file, err := os.Create(dest)
+		if err != nil {
+			return count, err
+		}
+
+		_, err = io.Copy(file, stream)
+		file.Close()
+		if err != nil {
+			return count, fmt.Errorf("unable to write %s: %s", dest, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// WritePackZip writes the files that need packing into a zip
+// Returns the number of files that were written
+func WritePackZip(fs filesystem.IFileSystem, files []*PackFile, w io.Writer) (int, error) {
+	archive := zip.NewWriter(w)
+	count := 0
+
+	for _, f := range files {
+		if !f.shouldPack() {
+			continue
+		}
+
+		stream, err := fs.GetFile(f.Path)
+		if err != nil {
+			return count, fmt.Errorf("unable to read %s: %s", f.Path, err)
+		}
+
+		entry, err := archive.Create(f.Path)
+		if err != nil {
+			return count, err
+		}
+
+		if _, err := io.Copy(entry, stream); err != nil {
+			return count, fmt.Errorf("unable to write %s: %s", f.Path, err)
+		}
+
+		count++
+	}
+
+	return count, archive.Close()
+}
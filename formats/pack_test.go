@@ -0,0 +1,173 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emily33901/lambda-core/core/filesystem"
+)
+
+// memoryFileSystem is a filesystem of files that are held in memory
+type memoryFileSystem struct {
+	filesystem.IFileSystem
+	files map[string]string
+}
+
+func (fs *memoryFileSystem) GetFile(filename string) (io.Reader, error) {
+	data, ok := fs.files[strings.ToLower(filesystem.NormalisePath(filename))]
+	if !ok {
+		return nil, filesystem.NewFileNotFoundError(filename)
+	}
+
+	return strings.NewReader(data), nil
+}
+
+var packFiles = map[string]string{
+	"materials/brick/brickwall001a.vmt": `"LightmappedGeneric"
+{
+	"$basetexture" "custom/brick"
+	"$bumpmap" "custom\brick_normal"
+	"$envmap" "env_cubemap"
+	"$detail" "dev/stock_detail"
+}`,
+	"materials/custom/brick.vtf":     "VTF",
+	"materials/dev/stock_detail.vtf": "VTF",
+	"materials/dev/dev_measurepatch.vmt": `"patch"
+{
+	"include" "materials/custom/base.vmt"
+	"insert"
+	{
+		"$basetexture" "custom/patched"
+	}
+}`,
+	"materials/custom/base.vmt": `"LightmappedGeneric"
+{
+	"$basetexture" "custom/brick"
+}`,
+	"materials/custom/patched.vtf": "VTF",
+	"materials/tools/toolsnodraw.vmt": `"LightmappedGeneric"
+{
+	"$basetexture" "tools/toolsnodraw"
+}`,
+}
+
+// packFileStates describes each file as its path and whether it is packed, stock or missing
+func packFileStates(files []*PackFile) []string {
+	states := make([]string, 0, len(files))
+	for _, f := range files {
+		state := "pack"
+		switch {
+		case f.Stock:
+			state = "stock"
+		case f.Missing:
+			state = "missing"
+		}
+
+		states = append(states, f.Path+" "+state)
+	}
+
+	return states
+}
+
+func TestPacker(t *testing.T) {
+	fs := &memoryFileSystem{files: packFiles}
+	isStock := func(path string) bool {
+		return strings.HasPrefix(path, "materials/dev/") || strings.HasPrefix(path, "materials/tools/")
+	}
+
+	tests := []struct {
+		name     string
+		material string
+		files    []string
+	}{
+		{
+			name:     "custom vmt with custom vtfs",
+			material: "BRICK/BRICKWALL001A",
+			files: []string{
+				"materials/brick/brickwall001a.vmt pack",
+				"materials/custom/brick.vtf pack",
+				"materials/custom/brick_normal.vtf missing",
+				"materials/dev/stock_detail.vtf stock",
+			},
+		},
+		{
+			name:     "stock vmt",
+			material: "tools/toolsnodraw",
+			files:    []string{"materials/tools/toolsnodraw.vmt stock"},
+		},
+		{
+			// Stock vmts can only refer to stock files so their patches are not followed
+			name:     "stock patch vmt",
+			material: "dev/dev_measurepatch",
+			files:    []string{"materials/dev/dev_measurepatch.vmt stock"},
+		},
+		{
+			name:     "missing vmt",
+			material: "custom/nothing",
+			files:    []string{"materials/custom/nothing.vmt missing"},
+		},
+	}
+
+	for _, test := range tests {
+		p := NewPacker(fs, isStock)
+		p.AddAsset(&AssetReference{Kind: AssetMaterial, Name: test.material, Path: assetPath(AssetMaterial, test.material)})
+
+		if files := packFileStates(p.Files()); !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.files, files)
+		}
+	}
+}
+
+func TestPackerCustomPatch(t *testing.T) {
+	fs := &memoryFileSystem{files: packFiles}
+	p := NewPacker(fs, func(path string) bool { return false })
+	p.AddAsset(&AssetReference{Kind: AssetMaterial, Name: "dev/dev_measurepatch", Path: "materials/dev/dev_measurepatch.vmt"})
+
+	// The patch, what it includes and the textures of both
+	expected := []string{
+		"materials/custom/base.vmt pack",
+		"materials/custom/brick.vtf pack",
+		"materials/custom/patched.vtf pack",
+		"materials/dev/dev_measurepatch.vmt pack",
+	}
+
+	files := p.Files()
+	if states := packFileStates(files); !reflect.DeepEqual(states, expected) {
+		t.Fatalf("expected %v, got %v", expected, states)
+	}
+	if files[1].ReferencedBy != "materials/custom/base.vmt" {
+		t.Errorf("expected the vtf to be referenced by the vmt that included it, got %s", files[1].ReferencedBy)
+	}
+}
+
+func TestWritePackZip(t *testing.T) {
+	fs := &memoryFileSystem{files: packFiles}
+	p := NewPacker(fs, func(path string) bool { return strings.HasPrefix(path, "materials/dev/") })
+	p.AddAsset(&AssetReference{Kind: AssetMaterial, Name: "brick/brickwall001a", Path: "materials/brick/brickwall001a.vmt"})
+
+	var buf bytes.Buffer
+	count, err := WritePackZip(fs, p.Files(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stock and missing files are left out
+	names := make([]string, 0)
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+
+	expected := []string{"materials/brick/brickwall001a.vmt", "materials/custom/brick.vtf"}
+	if count != len(expected) || !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v to be written, got %d files %v", expected, count, names)
+	}
+}
@@ -0,0 +1,108 @@
+package formats
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// PngExportOptions choose which images of a vtf are written out.
+// Only the first frame, face and mip are written when nothing is set
+type PngExportOptions struct {
+	AllFrames bool
+	AllFaces  bool
+	AllMips   bool
+
+	// CompositeAlpha bakes how a material uses the alpha of its base texture into the alpha
+	// of the png. Without it the alpha is written as it is in the vtf
+	CompositeAlpha bool
+}
+
+// RgbaToImage wraps decoded RGBA8888 data in an image
+func RgbaToImage(data []byte, width int, height int) *image.NRGBA {
+	return &image.NRGBA{
+		Pix:    data,
+		Stride: width * 4,
+		Rect:   image.Rect(0, 0, width, height),
+	}
+}
+
+// WritePng writes an image to a png file, making any directories that it needs
+func WritePng(filename string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("unable to write %s: %s", filename, err)
+	}
+
+	return file.Close()
+}
+
+// pngName is the name of the png for an image of a vtf.
+// Only the parts that can be more than one are added to the name
+func pngName(name string, options PngExportOptions, frame int, face int, mip int) string {
+	if options.AllFrames {
+		name += fmt.Sprintf("_frame%d", frame)
+	}
+	if options.AllFaces {
+		name += fmt.Sprintf("_face%d", face)
+	}
+	if options.AllMips {
+		name += fmt.Sprintf("_mip%d", mip)
+	}
+
+	return name + ".png"
+}
+
+// ExportVtfPngs decodes the images of a vtf and writes them to dir as pngs named after name.
+// composite is called on every decoded image before it is written and can be nil.
+// Returns the files that were written
+func ExportVtfPngs(v *Vtf, dir string, name string, options PngExportOptions, composite func(rgba []byte)) ([]string, error) {
+	frames, faces, mips := 1, 1, 1
+	if options.AllFrames {
+		frames = v.Frames
+	}
+	if options.AllFaces {
+		faces = v.Faces
+	}
+	if options.AllMips {
+		mips = len(v.Mips)
+	}
+
+	written := make([]string, 0, frames*faces*mips)
+
+	for frame := 0; frame < frames; frame++ {
+		for face := 0; face < faces; face++ {
+			for mip := 0; mip < mips; mip++ {
+				data, err := v.DecodeImage(mip, frame, face)
+				if err != nil {
+					return written, err
+				}
+
+				if composite != nil {
+					composite(data)
+				}
+
+				m := v.Mips[mip]
+				filename := filepath.Join(dir, pngName(name, options, frame, face, mip))
+				if err := WritePng(filename, RgbaToImage(data, m.Width, m.Height)); err != nil {
+					return written, err
+				}
+
+				written = append(written, filename)
+			}
+		}
+	}
+
+	return written, nil
+}
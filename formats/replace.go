@@ -0,0 +1,206 @@
+package formats
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/emily33901/go-forgery/valve/world"
+)
+
+const (
+	MatchExact    = 0
+	MatchWildcard = 1
+	MatchRegex    = 2
+)
+
+var MatchModes = [...]string{
+	"Exact",
+	"Wildcard",
+	"Regex",
+}
+
+// entityMaterialKeys are the entity keyvalues that refer to a material
+var entityMaterialKeys = [...]string{
+	"material",
+	"texture",
+	"overlaymaterial",
+	"ropematerial",
+}
+
+// MaterialReplacement describes a find and replace over the materials in a vmf
+type MaterialReplacement struct {
+	Find    string
+	Replace string
+	Mode    int
+
+	// Solids limits the replacement to these solid ids
+	// If this is nil then the whole vmf is used
+	Solids map[int]bool
+
+	// Entities limits the replacement of entity keys to these entity indices
+	// when Solids is set. Solids of brush entities are picked by Solids
+	Entities map[int]bool
+
+	// IncludeEntities also replaces material keys on entities
+	IncludeEntities bool
+
+	// RescaleUVs keeps the texel density the same if the new material
+	// has different dimensions to the old one
+	RescaleUVs bool
+
+	// TextureSize returns the dimensions of a material
+	// It is required if RescaleUVs is set
+	TextureSize func(name string) (width int, height int, found bool)
+}
+
+// ReplaceResult holds what was changed by ReplaceMaterials
+type ReplaceResult struct {
+	Sides    int
+	Entities int
+
+	// Ids of all the solids that had a side changed
+	ChangedSolids []int
+}
+
+// compile builds a matching regexp from the replacement find string
+func (r *MaterialReplacement) compile() (*regexp.Regexp, error) {
+	if r.Find == "" {
+		return nil, errors.New("nothing to find")
+	}
+
+	switch r.Mode {
+	case MatchExact:
+		return regexp.Compile("(?i)^" + regexp.QuoteMeta(r.Find) + "$")
+	case MatchWildcard:
+		pattern := regexp.QuoteMeta(r.Find)
+		pattern = strings.Replace(pattern, `\*`, ".*", -1)
+		pattern = strings.Replace(pattern, `\?`, ".", -1)
+		return regexp.Compile("(?i)^" + pattern + "$")
+	case MatchRegex:
+		return regexp.Compile("(?i)" + r.Find)
+	}
+
+	return nil, errors.New("unknown match mode")
+}
+
+// replacementFor returns the new name for a material or false if it doesnt match
+func (r *MaterialReplacement) replacementFor(matcher *regexp.Regexp, name string) (string, bool) {
+	if !matcher.MatchString(name) {
+		return "", false
+	}
+
+	if r.Mode == MatchRegex {
+		return matcher.ReplaceAllString(name, r.Replace), true
+	}
+
+	return r.Replace, true
+}
+
+// ReplaceMaterials replaces materials on sides (and optionally entities) in the vmf
+func (vmf *Vmf) ReplaceMaterials(r *MaterialReplacement) (*ReplaceResult, error) {
+	matcher, err := r.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.RescaleUVs && r.TextureSize == nil {
+		return nil, errors.New("rescaling uvs requires texture sizes")
+	}
+
+	result := &ReplaceResult{}
+
+	solids := append([]*world.Solid{}, vmf.world.Solids...)
+	for i := 0; i < vmf.entities.Length(); i++ {
+		solids = append(solids, vmf.entitySolids[i]...)
+	}
+
+	for _, solid := range solids {
+		if r.Solids != nil && !r.Solids[solid.Id] {
+			continue
+		}
+
+		changed := false
+		for j := range solid.Sides {
+			side := &solid.Sides[j]
+
+			newMaterial, ok := r.replacementFor(matcher, side.Material)
+			if !ok || newMaterial == side.Material {
+				continue
+			}
+
+			if r.RescaleUVs {
+				oldWidth, oldHeight, oldFound := r.TextureSize(side.Material)
+				newWidth, newHeight, newFound := r.TextureSize(newMaterial)
+
+				if oldFound && newFound {
+					rescaleUVTransform(&side.UAxis, oldWidth, newWidth)
+					rescaleUVTransform(&side.VAxis, oldHeight, newHeight)
+				}
+			}
+
+			side.Material = newMaterial
+			result.Sides++
+			changed = true
+		}
+
+		if changed {
+			result.ChangedSolids = append(result.ChangedSolids, solid.Id)
+		}
+	}
+
+	if r.IncludeEntities {
+		for i := 0; i < vmf.entities.Length(); i++ {
+			if r.Solids != nil && !r.Entities[i] {
+				continue
+			}
+
+			changed := false
+
+			for ep := vmf.entities.Get(i).EPairs; ep != nil; ep = ep.Next {
+				if !isEntityMaterialKey(ep.Key) {
+					continue
+				}
+
+				newMaterial, ok := r.replacementFor(matcher, ep.Value)
+				if !ok || newMaterial == ep.Value {
+					continue
+				}
+
+				ep.Value = newMaterial
+				changed = true
+			}
+
+			if changed {
+				result.Entities++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// rescaleUVTransform keeps a texture the same size on a face when it is
+// replaced by one that is newSize texels across instead of oldSize
+func rescaleUVTransform(uv *world.UVTransform, oldSize int, newSize int) {
+	if oldSize == 0 || newSize == 0 {
+		return
+	}
+
+	uv.Scale *= float32(oldSize) / float32(newSize)
+
+	// The shift is in texels so it goes the other way to land in the same place
+	uv.Transform[3] *= float32(newSize) / float32(oldSize)
+}
+
+func isEntityMaterialKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, k := range entityMaterialKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+package formats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emily33901/go-forgery/valve/world"
+)
+
+// findSide returns the side with id from the world or a brush entity
+func findSide(v *Vmf, id int) *world.Side {
+	solids := append([]*world.Solid{}, v.Worldspawn().Solids...)
+	for i := 0; i < v.Entities().Length(); i++ {
+		solids = append(solids, v.EntitySolids(i)...)
+	}
+
+	for _, s := range solids {
+		for j := range s.Sides {
+			if s.Sides[j].Id == id {
+				return &s.Sides[j]
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestReplaceMaterials(t *testing.T) {
+	sizes := map[string][2]int{
+		"DEV/DEV_MEASUREGENERIC01":  {128, 128},
+		"concrete/concretefloat001": {512, 256},
+	}
+	textureSize := func(name string) (int, int, bool) {
+		size, ok := sizes[name]
+		return size[0], size[1], ok
+	}
+
+	tests := []struct {
+		name        string
+		replacement MaterialReplacement
+
+		sides    int
+		entities int
+		changed  []int
+
+		// Materials of sides after the replacement
+		materials map[int]string
+		overlay   string
+
+		// Scale and shift of the u and v axes of side 3, which start at 0.25 and 16
+		uScale, uShift float32
+		vScale, vShift float32
+	}{
+		{
+			name:        "exact",
+			replacement: MaterialReplacement{Find: "dev/dev_measuregeneric01", Replace: "concrete/concretefloat001", Mode: MatchExact},
+			sides:       2, changed: []int{2, 17},
+			materials: map[int]string{3: "concrete/concretefloat001", 4: "TOOLS/TOOLSNODRAW", 18: "concrete/concretefloat001"},
+			overlay:   "DEV/DEV_MEASUREGENERIC01",
+			uScale:    0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+		{
+			name: "rescaled",
+			replacement: MaterialReplacement{Find: "dev/dev_measuregeneric01", Replace: "concrete/concretefloat001", Mode: MatchExact,
+				RescaleUVs: true, TextureSize: textureSize},
+			sides: 2, changed: []int{2, 17},
+			materials: map[int]string{3: "concrete/concretefloat001", 18: "concrete/concretefloat001"},
+			overlay:   "DEV/DEV_MEASUREGENERIC01",
+			uScale:    0.0625, uShift: 64, vScale: 0.125, vShift: 32,
+		},
+		{
+			name: "rescaled to an unknown size",
+			replacement: MaterialReplacement{Find: "dev/dev_measuregeneric01", Replace: "dev/unknown", Mode: MatchExact,
+				RescaleUVs: true, TextureSize: textureSize},
+			sides: 2, changed: []int{2, 17},
+			materials: map[int]string{3: "dev/unknown"},
+			overlay:   "DEV/DEV_MEASUREGENERIC01",
+			uScale:    0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+		{
+			name:        "wildcard with entities",
+			replacement: MaterialReplacement{Find: "dev/*", Replace: "dev/dev_measurewall01a", Mode: MatchWildcard, IncludeEntities: true},
+			sides:       2, entities: 1, changed: []int{2, 17},
+			materials: map[int]string{3: "dev/dev_measurewall01a", 10: "BRICK/BRICKWALL001A", 18: "dev/dev_measurewall01a"},
+			overlay:   "dev/dev_measurewall01a",
+			uScale:    0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+		{
+			name:        "regex",
+			replacement: MaterialReplacement{Find: "^brick/(.*)$", Replace: "stone/$1", Mode: MatchRegex},
+			sides:       6, changed: []int{9},
+			materials: map[int]string{3: "DEV/DEV_MEASUREGENERIC01", 10: "stone/BRICKWALL001A", 15: "stone/BRICKWALL001A"},
+			overlay:   "DEV/DEV_MEASUREGENERIC01",
+			uScale:    0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+		{
+			name: "selected brush entity",
+			replacement: MaterialReplacement{Find: "dev/dev_measuregeneric01", Replace: "concrete/concretefloat001", Mode: MatchExact,
+				Solids: map[int]bool{17: true}, Entities: map[int]bool{}, IncludeEntities: true},
+			sides: 1, changed: []int{17},
+			materials: map[int]string{3: "DEV/DEV_MEASUREGENERIC01", 18: "concrete/concretefloat001"},
+			overlay:   "DEV/DEV_MEASUREGENERIC01",
+			uScale:    0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+		{
+			name:        "no match",
+			replacement: MaterialReplacement{Find: "nothing/here", Replace: "dev/dev_measurewall01a", Mode: MatchExact, IncludeEntities: true},
+			materials:   map[int]string{3: "DEV/DEV_MEASUREGENERIC01", 18: "DEV/DEV_MEASUREGENERIC01"},
+			overlay:     "DEV/DEV_MEASUREGENERIC01",
+			uScale:      0.25, uShift: 16, vScale: 0.25, vShift: 16,
+		},
+	}
+
+	for _, test := range tests {
+		v, err := LoadVmf("testdata/edit.vmf")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		side := findSide(v, 3)
+		side.UAxis.Transform[3] = 16
+		side.VAxis.Transform[3] = 16
+
+		result, err := v.ReplaceMaterials(&test.replacement)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if result.Sides != test.sides || result.Entities != test.entities || !reflect.DeepEqual(result.ChangedSolids, test.changed) {
+			t.Errorf("%s: expected %d sides, %d entities and solids %v, got %d, %d and %v", test.name,
+				test.sides, test.entities, test.changed, result.Sides, result.Entities, result.ChangedSolids)
+		}
+
+		for id, material := range test.materials {
+			if got := findSide(v, id).Material; got != material {
+				t.Errorf("%s: expected side %d to be %s, got %s", test.name, id, material, got)
+			}
+		}
+
+		if got := v.Entities().Get(1).ValueForKey("material"); got != test.overlay {
+			t.Errorf("%s: expected the overlay to be %s, got %s", test.name, test.overlay, got)
+		}
+
+		if side.UAxis.Scale != test.uScale || side.UAxis.Transform[3] != test.uShift ||
+			side.VAxis.Scale != test.vScale || side.VAxis.Transform[3] != test.vShift {
+			t.Errorf("%s: expected u %v %v and v %v %v, got %v %v and %v %v", test.name,
+				test.uScale, test.uShift, test.vScale, test.vShift,
+				side.UAxis.Scale, side.UAxis.Transform[3], side.VAxis.Scale, side.VAxis.Transform[3])
+		}
+	}
+}
+
+func TestReplaceMaterialsErrors(t *testing.T) {
+	v, err := LoadVmf("testdata/edit.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.ReplaceMaterials(&MaterialReplacement{Replace: "dev/dev_measurewall01a"}); err == nil {
+		t.Error("expected an error with nothing to find")
+	}
+	if _, err := v.ReplaceMaterials(&MaterialReplacement{Find: "dev/*", Mode: MatchWildcard, RescaleUVs: true}); err == nil {
+		t.Error("expected an error rescaling without texture sizes")
+	}
+}
@@ -0,0 +1,125 @@
+package formats
+
+import (
+	"strconv"
+	"strings"
+
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// SurfaceFlags are what vbsp does with the faces that use a material
+type SurfaceFlags uint32
+
+const (
+	SurfaceNoDraw SurfaceFlags = 1 << iota
+	SurfaceSky
+	SurfaceWater
+	SurfaceTranslucent
+	SurfaceClip
+	SurfaceTrigger
+	SurfaceHint
+
+	// SurfaceTool is any material that is only there to tell vbsp something
+	SurfaceTool
+)
+
+// The %compile keywords that set each flag
+var vmtCompileFlags = map[string]SurfaceFlags{
+	"%compilenodraw":      SurfaceNoDraw | SurfaceTool,
+	"%compilesky":         SurfaceSky | SurfaceTool,
+	"%compile2dsky":       SurfaceSky | SurfaceTool,
+	"%compilewater":       SurfaceWater,
+	"%compileslime":       SurfaceWater,
+	"%compiletrigger":     SurfaceTrigger | SurfaceTool,
+	"%compileclip":        SurfaceClip | SurfaceTool,
+	"%compileplayerclip":  SurfaceClip | SurfaceTool,
+	"%compilenpcclip":     SurfaceClip | SurfaceTool,
+	"%compilegrenadeclip": SurfaceClip | SurfaceTool,
+	"%compiledroneclip":   SurfaceClip | SurfaceTool,
+	"%compilehint":        SurfaceHint | SurfaceTool,
+	"%compileskip":        SurfaceHint | SurfaceTool,
+	"%compileorigin":      SurfaceTool,
+	"%compileareaportal":  SurfaceTool,
+	"%compileoccluder":    SurfaceTool,
+	"%compileinvisible":   SurfaceTool,
+	"%compilenonsolid":    SurfaceTool,
+	"%compileladder":      SurfaceTool,
+	"%compilefog":         SurfaceTool,
+}
+
+// Has checks whether any of flags are set
+func (s SurfaceFlags) Has(flags SurfaceFlags) bool {
+	return s&flags != 0
+}
+
+// String lists the flags that are set, like "nodraw tool"
+func (s SurfaceFlags) String() string {
+	names := []string{}
+	for i, name := range []string{"nodraw", "sky", "water", "translucent", "clip", "trigger", "hint", "tool"} {
+		if s&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// VmtSurfaceFlags works out the surface flags of a resolved vmt from its
+// %compile keywords, its shader and whether it is see through
+func VmtSurfaceFlags(kv *keyvalues.KeyValue) SurfaceFlags {
+	flags := SurfaceFlags(0)
+
+	children, _ := kv.Children()
+	for _, child := range children {
+		if child.HasChildren() {
+			continue
+		}
+
+		key := strings.ToLower(child.Key())
+		value := strings.TrimSpace(KeyValueString(child))
+		set := value != "" && value != "0"
+
+		switch key {
+		case "$translucent", "$additive":
+			if set {
+				flags |= SurfaceTranslucent
+			}
+		case "$alpha":
+			if alpha, err := strconv.ParseFloat(value, 32); err == nil && alpha < 1 {
+				flags |= SurfaceTranslucent
+			}
+		default:
+			if f, ok := vmtCompileFlags[key]; ok && set {
+				flags |= f
+			}
+		}
+	}
+
+	if strings.EqualFold(kv.Key(), "water") {
+		flags |= SurfaceWater
+	}
+
+	return flags
+}
+
+// MaterialSurfaceFlags guesses the flags of a material that has not been read from its name
+func MaterialSurfaceFlags(name string) SurfaceFlags {
+	name = strings.TrimPrefix(strings.ToLower(name), "materials/")
+
+	switch {
+	case !strings.HasPrefix(name, "tools/"):
+		return 0
+	case strings.Contains(name, "nodraw"):
+		return SurfaceNoDraw | SurfaceTool
+	case strings.Contains(name, "skybox"), strings.Contains(name, "2dsky"):
+		return SurfaceSky | SurfaceTool
+	case strings.Contains(name, "trigger"):
+		return SurfaceTrigger | SurfaceTool
+	case strings.Contains(name, "clip"):
+		return SurfaceClip | SurfaceTool
+	case strings.Contains(name, "hint"), strings.Contains(name, "skip"):
+		return SurfaceHint | SurfaceTool
+	}
+
+	return SurfaceTool
+}
@@ -0,0 +1,149 @@
+package formats
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// Tga image types that can be read
+const (
+	tgaTrueColour    = 2
+	tgaGrey          = 3
+	tgaTrueColourRle = 10
+	tgaGreyRle       = 11
+)
+
+// Bits of the descriptor in the header
+const (
+	tgaTopToBottom = 0x20
+	tgaRightToLeft = 0x10
+)
+
+const tgaHeaderSize = 18
+
+// readTgaPixels reads count pixels of bpp bytes each, expanding run length encoded packets
+func readTgaPixels(data []byte, count int, bpp int, rle bool) ([]byte, error) {
+	out := make([]byte, 0, count*bpp)
+
+	if !rle {
+		if len(data) < count*bpp {
+			return nil, errors.New("tga image data is truncated")
+		}
+		return append(out, data[:count*bpp]...), nil
+	}
+
+	for len(out) < count*bpp {
+		if len(data) < 1 {
+			return nil, errors.New("tga image data is truncated")
+		}
+
+		packet := data[0]
+		length := int(packet&0x7f) + 1
+		data = data[1:]
+
+		if packet&0x80 != 0 {
+			// A run of the same pixel
+			if len(data) < bpp {
+				return nil, errors.New("tga image data is truncated")
+			}
+			for i := 0; i < length; i++ {
+				out = append(out, data[:bpp]...)
+			}
+			data = data[bpp:]
+		} else {
+			if len(data) < length*bpp {
+				return nil, errors.New("tga image data is truncated")
+			}
+			out = append(out, data[:length*bpp]...)
+			data = data[length*bpp:]
+		}
+	}
+
+	// Runs are allowed to go past the end of the image
+	return out[:count*bpp], nil
+}
+
+// ReadTga reads an uncompressed or run length encoded true colour or grey tga
+func ReadTga(stream io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < tgaHeaderSize {
+		return nil, errors.New("tga is truncated")
+	}
+
+	idLength := int(data[0])
+	imageType := data[2]
+	bits := int(data[16])
+	descriptor := data[17]
+
+	if data[1] != 0 {
+		return nil, errors.New("colour mapped tgas are not supported")
+	}
+
+	grey := false
+	rle := false
+	switch imageType {
+	case tgaTrueColour:
+	case tgaTrueColourRle:
+		rle = true
+	case tgaGrey:
+		grey = true
+	case tgaGreyRle:
+		grey, rle = true, true
+	default:
+		return nil, fmt.Errorf("tga image type %d is not supported", imageType)
+	}
+
+	bpp := bits / 8
+	switch {
+	case grey && bpp != 1 && bpp != 2:
+		return nil, fmt.Errorf("%d bit grey tgas are not supported", bits)
+	case !grey && bpp != 3 && bpp != 4:
+		return nil, fmt.Errorf("%d bit tgas are not supported", bits)
+	}
+
+	width := int(binary.LittleEndian.Uint16(data[12:]))
+	height := int(binary.LittleEndian.Uint16(data[14:]))
+	if width == 0 || height == 0 {
+		return nil, errors.New("tga has no size")
+	}
+
+	pixels, err := readTgaPixels(data[tgaHeaderSize+idLength:], width*height, bpp, rle)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		// Tgas start at the bottom left unless they say otherwise
+		x, y := i%width, i/width
+		if descriptor&tgaRightToLeft != 0 {
+			x = width - 1 - x
+		}
+		if descriptor&tgaTopToBottom == 0 {
+			y = height - 1 - y
+		}
+
+		p := pixels[i*bpp : (i+1)*bpp]
+		out := img.Pix[y*img.Stride+x*4:]
+
+		switch bpp {
+		case 1:
+			out[0], out[1], out[2], out[3] = p[0], p[0], p[0], 255
+		case 2:
+			out[0], out[1], out[2], out[3] = p[0], p[0], p[0], p[1]
+		case 3:
+			out[0], out[1], out[2], out[3] = p[2], p[1], p[0], 255
+		case 4:
+			out[0], out[1], out[2], out[3] = p[2], p[1], p[0], p[3]
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,128 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// buildTga writes a tga header with an image id of id followed by data
+func buildTga(imageType byte, width int, height int, bits int, descriptor byte, id string, data []byte) []byte {
+	header := make([]byte, tgaHeaderSize)
+	header[0] = byte(len(id))
+	header[2] = imageType
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+	header[16] = byte(bits)
+	header[17] = descriptor
+
+	return append(append(header, id...), data...)
+}
+
+func TestReadTga(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	green := color.NRGBA{0, 255, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 128}
+	grey := color.NRGBA{64, 64, 64, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+
+	tests := []struct {
+		name string
+		data []byte
+
+		// Pixels from the top left, row by row
+		width  int
+		pixels []color.NRGBA
+	}{
+		{
+			name: "true colour from the bottom",
+			data: buildTga(tgaTrueColour, 2, 2, 24, 0, "", []byte{
+				0, 0, 255, 0, 255, 0,
+				255, 255, 255, 64, 64, 64,
+			}),
+			width:  2,
+			pixels: []color.NRGBA{white, grey, red, green},
+		},
+		{
+			name: "true colour from the top right with an id",
+			data: buildTga(tgaTrueColour, 2, 1, 32, tgaTopToBottom|tgaRightToLeft, "forgery", []byte{
+				0, 0, 255, 255, 255, 0, 0, 128,
+			}),
+			width:  2,
+			pixels: []color.NRGBA{blue, red},
+		},
+		{
+			name: "run length encoded",
+			data: buildTga(tgaTrueColourRle, 3, 2, 32, tgaTopToBottom, "", []byte{
+				// A run of 4 reds, then 2 raw pixels
+				0x83, 0, 0, 255, 255,
+				0x01, 0, 255, 0, 255, 255, 0, 0, 128,
+			}),
+			width:  3,
+			pixels: []color.NRGBA{red, red, red, red, green, blue},
+		},
+		{
+			name: "run past the end of the image",
+			data: buildTga(tgaTrueColourRle, 3, 1, 24, tgaTopToBottom, "", []byte{
+				// 1 raw pixel and then a run of 4 greens where only 2 fit
+				0x00, 0, 0, 255,
+				0x83, 0, 255, 0,
+			}),
+			width:  3,
+			pixels: []color.NRGBA{red, green, green},
+		},
+		{
+			name: "run length encoded grey with alpha",
+			data: buildTga(tgaGreyRle, 2, 2, 16, tgaTopToBottom, "", []byte{
+				0x81, 64, 255,
+				0x81, 0, 128,
+			}),
+			width:  2,
+			pixels: []color.NRGBA{grey, grey, {0, 0, 0, 128}, {0, 0, 0, 128}},
+		},
+	}
+
+	for _, test := range tests {
+		img, err := ReadTga(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		height := len(test.pixels) / test.width
+		if img.Bounds() != image.Rect(0, 0, test.width, height) {
+			t.Errorf("%s: expected %dx%d, got %v", test.name, test.width, height, img.Bounds())
+			continue
+		}
+
+		for i, expected := range test.pixels {
+			x, y := i%test.width, i/test.width
+			if got := img.(*image.NRGBA).NRGBAAt(x, y); got != expected {
+				t.Errorf("%s: expected %d, %d to be %v, got %v", test.name, x, y, expected, got)
+			}
+		}
+	}
+}
+
+func TestReadTgaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated header", data: []byte{0, 0, tgaTrueColour}},
+		{name: "truncated pixels", data: buildTga(tgaTrueColour, 2, 2, 24, 0, "", make([]byte, 9))},
+		{name: "truncated run", data: buildTga(tgaTrueColourRle, 2, 2, 24, 0, "", []byte{0x81, 0, 0, 255, 0x81, 0})},
+		{name: "truncated raw packet", data: buildTga(tgaTrueColourRle, 2, 2, 24, 0, "", []byte{0x03, 0, 0, 255})},
+		{name: "colour mapped", data: append([]byte{0, 1}, make([]byte, tgaHeaderSize)...)},
+		{name: "16 bit colour", data: buildTga(tgaTrueColour, 1, 1, 16, 0, "", make([]byte, 2))},
+		{name: "no size", data: buildTga(tgaTrueColour, 0, 1, 24, 0, "", nil)},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadTga(bytes.NewReader(test.data)); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
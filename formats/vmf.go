@@ -20,6 +20,22 @@ type Vmf struct {
 	entities     entity.List
 	cameras      Cameras
 	cordon       Cordon
+
+	// Where the vmf was loaded from or last saved to
+	filepath string
+
+	// Blocks that we do not understand yet, kept so that they can be written back out
+	rawBlocks []vmf.Node
+	// Child blocks (editor, connections) and solids of entities keyed by entity index
+	entityBlocks map[int][]vmf.Node
+	entitySolids map[int][]*world.Solid
+	// Indices of entities that were in hidden blocks
+	hiddenEntities map[int]bool
+
+	// Highest ids that have been used so far
+	idsKnown     bool
+	lastObjectId int
+	lastSideId   int
 }
 
 func (vmf *Vmf) VersionInfo() *VersionInfo {
@@ -50,6 +66,102 @@ func (vmf *Vmf) Cordons() *Cordon {
 	return &vmf.cordon
 }
 
+// Filepath is where the vmf was loaded from or last saved to
+func (vmf *Vmf) Filepath() string {
+	return vmf.filepath
+}
+
+// EntityHidden returns whether the entity at index is hidden
+func (vmf *Vmf) EntityHidden(index int) bool {
+	return vmf.hiddenEntities[index]
+}
+
+// EntitySolids returns the solids of the brush entity at index
+func (vmf *Vmf) EntitySolids(index int) []*world.Solid {
+	return vmf.entitySolids[index]
+}
+
+// EntityForSolid returns the index of the brush entity that a solid belongs to
+// or -1 if the solid is part of the world
+func (vmf *Vmf) EntityForSolid(id int) int {
+	for index, solids := range vmf.entitySolids {
+		for _, s := range solids {
+			if s.Id == id {
+				return index
+			}
+		}
+	}
+
+	return -1
+}
+
+// findLastIds finds the highest ids that are in use in the vmf
+func (vmf *Vmf) findLastIds() {
+	vmf.idsKnown = true
+
+	for _, s := range vmf.world.Solids {
+		if s.Id > vmf.lastObjectId {
+			vmf.lastObjectId = s.Id
+		}
+
+		for _, side := range s.Sides {
+			if side.Id > vmf.lastSideId {
+				vmf.lastSideId = side.Id
+			}
+		}
+	}
+
+	for _, g := range vmf.world.Groups {
+		if g.Id > vmf.lastObjectId {
+			vmf.lastObjectId = g.Id
+		}
+	}
+
+	for i := 0; i < vmf.entities.Length(); i++ {
+		if id := vmf.entities.Get(i).IntForKey("id"); id > vmf.lastObjectId {
+			vmf.lastObjectId = id
+		}
+
+		for _, s := range vmf.entitySolids[i] {
+			if s.Id > vmf.lastObjectId {
+				vmf.lastObjectId = s.Id
+			}
+
+			for _, side := range s.Sides {
+				if side.Id > vmf.lastSideId {
+					vmf.lastSideId = side.Id
+				}
+			}
+		}
+	}
+
+	if vmf.world.Keyvalues != nil {
+		if id := vmf.world.Keyvalues.IntForKey("id"); id > vmf.lastObjectId {
+			vmf.lastObjectId = id
+		}
+	}
+}
+
+// NextObjectId allocates a new id for a solid or entity
+func (vmf *Vmf) NextObjectId() int {
+	if !vmf.idsKnown {
+		vmf.findLastIds()
+	}
+
+	vmf.lastObjectId++
+	return vmf.lastObjectId
+}
+
+// NextSideId allocates a new id for a side
+func (vmf *Vmf) NextSideId() int {
+	if !vmf.idsKnown {
+		vmf.findLastIds()
+	}
+
+	vmf.lastSideId++
+	return vmf.lastSideId
+}
+
 type VersionInfo struct {
 	EditorVersion int
 	EditorBuild   int
@@ -116,6 +228,10 @@ func NewVmf(version *VersionInfo, visgroups *VisGroups, worldSpawn *world.World,
 		world:       *worldSpawn,
 		entities:    *entities,
 		cameras:     *cameras,
+
+		entityBlocks:   map[int][]vmf.Node{},
+		entitySolids:   map[int][]*world.Solid{},
+		hiddenEntities: map[int]bool{},
 	}
 }
 
@@ -156,7 +272,111 @@ func LoadVmf(filepath string) (*Vmf, error) {
 
 	entities := loadEntities(&importable.Entities)
 
-	return NewVmf(versionInfo, visGroups, worldspawn, entities, cameras), nil
+	result := NewVmf(versionInfo, visGroups, worldspawn, entities, cameras)
+	result.filepath = filepath
+
+	for i, n := range *importable.Entities.GetAllValues() {
+		entityNode := n.(vmf.Node)
+		result.entityBlocks[i], result.entitySolids[i], err = loadEntityChildren(&entityNode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Hidden entities are wrapped in a hidden block at the top level
+	for _, hiddenNode := range importable.Unclassified.GetChildrenByKey("hidden") {
+		for _, entityNode := range hiddenNode.GetChildrenByKey("entity") {
+			e := entity.FromVmfNode(&entityNode)
+			index := result.entities.Add(&e)
+
+			result.entityBlocks[index], result.entitySolids[index], err = loadEntityChildren(&entityNode)
+			if err != nil {
+				return nil, err
+			}
+			result.hideEntity(index)
+		}
+	}
+
+	// Keep everything that we dont load so that saving does not lose it
+	for _, n := range *importable.VisGroup.GetAllValues() {
+		result.rawBlocks = append(result.rawBlocks, n.(vmf.Node))
+	}
+	for _, n := range []*vmf.Node{&importable.ViewSettings, &importable.Cordon, &importable.Cordons} {
+		if *n.GetKey() != "" {
+			result.rawBlocks = append(result.rawBlocks, *n)
+		}
+	}
+	for _, n := range *importable.Unclassified.GetAllValues() {
+		if node := n.(vmf.Node); *node.GetKey() != "hidden" {
+			result.rawBlocks = append(result.rawBlocks, node)
+		}
+	}
+
+	return result, nil
+}
+
+// isBlock returns whether a node is a block rather than a key value pair
+func isBlock(node *vmf.Node) bool {
+	values := *node.GetAllValues()
+	if len(values) != 1 {
+		return true
+	}
+
+	_, isString := values[0].(string)
+	return !isString
+}
+
+// loadEntityChildren loads the solids of a brush entity and keeps
+// the rest of its child blocks as they are
+func loadEntityChildren(node *vmf.Node) ([]vmf.Node, []*world.Solid, error) {
+	blocks := make([]vmf.Node, 0)
+	solids := make([]*world.Solid, 0)
+
+	for _, n := range *node.GetAllValues() {
+		child, ok := n.(vmf.Node)
+		if !ok || !isBlock(&child) {
+			continue
+		}
+
+		if *child.GetKey() == "solid" {
+			solid, err := loadSolid(&child)
+			if err != nil {
+				return nil, nil, err
+			}
+			solids = append(solids, solid)
+			continue
+		}
+
+		blocks = append(blocks, child)
+	}
+
+	return blocks, solids, nil
+}
+
+// cloneBlocks copies entity child blocks, passing the outputs in
+// connections blocks through fixup
+func cloneBlocks(blocks []vmf.Node, fixup func(string) string) []vmf.Node {
+	clones := make([]vmf.Node, 0, len(blocks))
+
+	for i := range blocks {
+		clone := world.CloneNode(&blocks[i])
+
+		if *clone.GetKey() == "connections" {
+			for _, v := range *clone.GetAllValues() {
+				output, ok := v.(vmf.Node)
+				if !ok || isBlock(&output) {
+					continue
+				}
+
+				values := output.GetAllValues()
+				(*values)[0] = fixup((*values)[0].(string))
+			}
+		}
+
+		clones = append(clones, clone)
+	}
+
+	return clones
 }
 
 // loadVersionInfo creates a VersionInfo model
@@ -199,20 +419,76 @@ func loadWorld(root *vmf.Node) (*world.World, error) {
 	solidNodes := root.GetChildrenByKey("solid")
 	worldSpawn := entity.FromVmfNode(root)
 
-	solids := make([]world.Solid, len(solidNodes))
+	solids := make([]*world.Solid, len(solidNodes))
 	for idx, solidNode := range solidNodes {
 		solid, err := loadSolid(&solidNode)
 		if err != nil {
 			return nil, err
 		}
-		solids[idx] = *solid
+		solids[idx] = solid
+	}
+
+	// Hidden solids are wrapped in a hidden block
+	for _, hiddenNode := range root.GetChildrenByKey("hidden") {
+		for _, solidNode := range hiddenNode.GetChildrenByKey("solid") {
+			solid, err := loadSolid(&solidNode)
+			if err != nil {
+				return nil, err
+			}
+			solid.Hidden = true
+			solids = append(solids, solid)
+		}
 	}
 
-	return world.NewWorld(&worldSpawn, solids), nil
+	groups := make([]*world.Group, 0)
+	for _, groupNode := range root.GetChildrenByKey("group") {
+		id, err := strconv.ParseInt(groupNode.GetProperty("id"), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, world.NewGroup(int(id), loadEditor(&groupNode)))
+	}
+
+	result := world.NewWorld(&worldSpawn, solids, groups)
+	result.Blocks = unknownBlocks(root, "solid", "hidden", "group")
+
+	return result, nil
+}
+
+// unknownBlocks returns the child blocks of node that are not one of known
+func unknownBlocks(node *vmf.Node, known ...string) []vmf.Node {
+	blocks := make([]vmf.Node, 0)
+
+	for _, n := range *node.GetAllValues() {
+		child, ok := n.(vmf.Node)
+		if !ok || !isBlock(&child) {
+			continue
+		}
+
+		isKnown := false
+		for _, key := range known {
+			if *child.GetKey() == key {
+				isKnown = true
+				break
+			}
+		}
+
+		if !isKnown {
+			blocks = append(blocks, child)
+		}
+	}
+
+	return blocks
 }
 
 func loadEditor(solidNode *vmf.Node) *world.Editor {
-	e := solidNode.GetChildrenByKey("editor")[0]
+	editors := solidNode.GetChildrenByKey("editor")
+	if len(editors) == 0 {
+		// Fragments from other places might not have an editor block
+		return world.NewEditor(mgl32.Vec3{0, 255, 0}, true, true)
+	}
+	e := editors[0]
 
 	var x, y, z float32
 
@@ -226,7 +502,12 @@ func loadEditor(solidNode *vmf.Node) *world.Editor {
 	visGroup = visGroupInt == 1
 	visGroupAuto = visGroupAutoInt == 1
 
-	return world.NewEditor(mgl32.Vec3{x, y, z}, visGroup, visGroupAuto)
+	editor := world.NewEditor(mgl32.Vec3{x, y, z}, visGroup, visGroupAuto)
+
+	groupId, _ := strconv.ParseInt(e.GetProperty("groupid"), 10, 32)
+	editor.GroupId = int(groupId)
+
+	return editor
 }
 
 // loadSolid takes a vmf node tree that represents a solid and turns
@@ -273,11 +554,15 @@ func loadSolid(node *vmf.Node) (*world.Solid, error) {
 		}
 
 		sides[idx] = *world.NewSide(int(id), plane, material, u, v, float32(rotation), float32(lmScale), smoothing)
+		sides[idx].Blocks = unknownBlocks(&sideNode)
 	}
 
 	editor := loadEditor(node)
 
-	return world.NewSolid(int(id), sides, editor), nil
+	solid := world.NewSolid(int(id), sides, editor)
+	solid.Blocks = unknownBlocks(node, "side", "editor")
+
+	return solid, nil
 }
 
 // loadEntities creates models from the entity data block
@@ -0,0 +1,61 @@
+package formats
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestVmfRoundTripDisplacement(t *testing.T) {
+	const path = "testdata/displacement.vmf"
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadVmf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	side := &v.Worldspawn().Solids[0].Sides[0]
+	if len(side.Blocks) != 1 || *side.Blocks[0].GetKey() != "dispinfo" {
+		t.Fatalf("expected the first side to keep its dispinfo, got %d blocks", len(side.Blocks))
+	}
+
+	var written bytes.Buffer
+	if err := v.Write(&written); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(written.Bytes(), expected) {
+		t.Errorf("written vmf differs from %s:\n%s", path, written.String())
+	}
+}
+
+func TestVmfFragmentKeepsDisplacement(t *testing.T) {
+	v, err := LoadVmf("testdata/displacement.vmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := CopyToText(v.Worldspawn().Solids, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solids, _, err := v.Paste(text, DefaultPasteOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(solids) != 1 {
+		t.Fatalf("expected 1 pasted solid, got %d", len(solids))
+	}
+
+	side := &solids[0].Sides[0]
+	if len(side.Blocks) != 1 || *side.Blocks[0].GetKey() != "dispinfo" {
+		t.Fatalf("expected the pasted side to keep its dispinfo, got %d blocks", len(side.Blocks))
+	}
+}
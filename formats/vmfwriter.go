@@ -0,0 +1,307 @@
+package formats
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/emily33901/go-forgery/valve/world"
+	"github.com/galaco/source-tools-common/entity"
+	"github.com/galaco/vmf"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// vmfWriter writes out vmf blocks and properties with the
+// same indentation that hammer uses
+type vmfWriter struct {
+	w     io.Writer
+	depth int
+	err   error
+}
+
+func newVmfWriter(w io.Writer) *vmfWriter {
+	return &vmfWriter{w: w}
+}
+
+func (writer *vmfWriter) line(text string) {
+	if writer.err != nil {
+		return
+	}
+
+	_, writer.err = io.WriteString(writer.w, strings.Repeat("\t", writer.depth)+text+"\r\n")
+}
+
+func (writer *vmfWriter) beginBlock(name string) {
+	writer.line(name)
+	writer.line("{")
+	writer.depth++
+}
+
+func (writer *vmfWriter) endBlock() {
+	writer.depth--
+	writer.line("}")
+}
+
+func (writer *vmfWriter) property(key string, value string) {
+	writer.line(fmt.Sprintf("\"%s\" \"%s\"", key, value))
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+func formatVec3(v mgl32.Vec3) string {
+	return formatFloat(v[0]) + " " + formatFloat(v[1]) + " " + formatFloat(v[2])
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func formatPlane(plane *world.Plane) string {
+	return fmt.Sprintf("(%s) (%s) (%s)", formatVec3(plane[0]), formatVec3(plane[1]), formatVec3(plane[2]))
+}
+
+func formatUVTransform(uv *world.UVTransform) string {
+	return fmt.Sprintf("[%s %s %s %s] %s",
+		formatFloat(uv.Transform[0]), formatFloat(uv.Transform[1]), formatFloat(uv.Transform[2]), formatFloat(uv.Transform[3]),
+		formatFloat(uv.Scale))
+}
+
+func (writer *vmfWriter) writeEditor(editor *world.Editor) {
+	writer.beginBlock("editor")
+	writer.property("color", fmt.Sprintf("%d %d %d", int(editor.Color[0]), int(editor.Color[1]), int(editor.Color[2])))
+	if editor.GroupId != 0 {
+		writer.property("groupid", strconv.Itoa(editor.GroupId))
+	}
+	writer.property("visgroupshown", formatBool(editor.VisgroupShown()))
+	writer.property("visgroupautoshown", formatBool(editor.VisgroupAutoShown()))
+	writer.endBlock()
+}
+
+func (writer *vmfWriter) writeSolid(solid *world.Solid) {
+	writer.beginBlock("solid")
+	writer.property("id", strconv.Itoa(solid.Id))
+
+	for i := range solid.Sides {
+		side := &solid.Sides[i]
+
+		writer.beginBlock("side")
+		writer.property("id", strconv.Itoa(side.Id))
+		writer.property("plane", formatPlane(&side.Plane))
+		writer.property("material", side.Material)
+		writer.property("uaxis", formatUVTransform(&side.UAxis))
+		writer.property("vaxis", formatUVTransform(&side.VAxis))
+		writer.property("rotation", formatFloat(side.Rotation))
+		writer.property("lightmapscale", formatFloat(side.LightmapScale))
+		writer.property("smoothing_groups", formatBool(side.SmoothingGroups))
+		for j := range side.Blocks {
+			writer.writeNode(&side.Blocks[j])
+		}
+		writer.endBlock()
+	}
+
+	for i := range solid.Blocks {
+		writer.writeNode(&solid.Blocks[i])
+	}
+
+	if solid.Editor != nil {
+		writer.writeEditor(solid.Editor)
+	}
+
+	writer.endBlock()
+}
+
+// writeKeyvalues writes out entity keyvalues in the order they
+// appeared in the original file
+func (writer *vmfWriter) writeKeyvalues(ent *entity.Entity) {
+	pairs := make([]*entity.EPair, 0)
+	for ep := ent.EPairs; ep != nil; ep = ep.Next {
+		pairs = append(pairs, ep)
+	}
+
+	// EPairs are stored in reverse
+	for i := len(pairs) - 1; i >= 0; i-- {
+		writer.property(pairs[i].Key, pairs[i].Value)
+	}
+}
+
+func (writer *vmfWriter) writeGroup(group *world.Group) {
+	writer.beginBlock("group")
+	writer.property("id", strconv.Itoa(group.Id))
+	if group.Editor != nil {
+		writer.writeEditor(group.Editor)
+	}
+	writer.endBlock()
+}
+
+// writeNode writes out a block that was read in but not understood
+func (writer *vmfWriter) writeNode(node *vmf.Node) {
+	if !isBlock(node) {
+		writer.property(*node.GetKey(), (*node.GetAllValues())[0].(string))
+		return
+	}
+
+	writer.beginBlock(*node.GetKey())
+	for _, n := range *node.GetAllValues() {
+		if child, ok := n.(vmf.Node); ok {
+			writer.writeNode(&child)
+		}
+	}
+	writer.endBlock()
+}
+
+func (writer *vmfWriter) writeEntity(ent *entity.Entity, blocks []vmf.Node, solids []*world.Solid) {
+	writer.beginBlock("entity")
+	writer.writeKeyvalues(ent)
+
+	// Hammer writes connections before solids and everything else after
+	for i := range blocks {
+		if *blocks[i].GetKey() == "connections" {
+			writer.writeNode(&blocks[i])
+		}
+	}
+	for _, s := range solids {
+		writer.writeSolid(s)
+	}
+	for i := range blocks {
+		if *blocks[i].GetKey() != "connections" {
+			writer.writeNode(&blocks[i])
+		}
+	}
+
+	writer.endBlock()
+}
+
+func (writer *vmfWriter) writeVersionInfo(info *VersionInfo) {
+	writer.beginBlock("versioninfo")
+	writer.property("editorversion", strconv.Itoa(info.EditorVersion))
+	writer.property("editorbuild", strconv.Itoa(info.EditorBuild))
+	writer.property("mapversion", strconv.Itoa(info.MapVersion))
+	writer.property("formatversion", strconv.Itoa(info.FormatVersion))
+	writer.property("prefab", formatBool(info.Prefab))
+	writer.endBlock()
+}
+
+func (writer *vmfWriter) writeWorld(w *world.World) {
+	writer.beginBlock("world")
+	if w.Keyvalues != nil {
+		writer.writeKeyvalues(w.Keyvalues)
+	}
+
+	for _, s := range w.Solids {
+		if !s.Hidden {
+			writer.writeSolid(s)
+		}
+	}
+
+	for _, s := range w.Solids {
+		if s.Hidden {
+			writer.beginBlock("hidden")
+			writer.writeSolid(s)
+			writer.endBlock()
+		}
+	}
+
+	for _, g := range w.Groups {
+		writer.writeGroup(g)
+	}
+
+	for i := range w.Blocks {
+		writer.writeNode(&w.Blocks[i])
+	}
+	writer.endBlock()
+}
+
+func (writer *vmfWriter) writeCameras(cameras *Cameras) {
+	writer.beginBlock("cameras")
+	writer.property("activecamera", strconv.Itoa(cameras.ActiveCamera))
+	for _, c := range cameras.CameraList {
+		writer.beginBlock("camera")
+		writer.property("position", "["+formatVec3(c.Position)+"]")
+		writer.property("look", "["+formatVec3(c.Look)+"]")
+		writer.endBlock()
+	}
+	writer.endBlock()
+}
+
+// WriteFragment writes solids and entities out as a vmf fragment
+// that can be read back with ReadFragment
+func WriteFragment(w io.Writer, solids []*world.Solid, entities []*FragmentEntity) error {
+	writer := newVmfWriter(w)
+
+	if len(solids) > 0 {
+		writer.beginBlock("world")
+		for _, s := range solids {
+			writer.writeSolid(s)
+		}
+		writer.endBlock()
+	}
+
+	for _, e := range entities {
+		writer.writeEntity(e.Entity, e.blocks, e.Solids)
+	}
+
+	return writer.err
+}
+
+// Write writes out the whole vmf
+func (vmf *Vmf) Write(w io.Writer) error {
+	writer := newVmfWriter(w)
+
+	writer.writeVersionInfo(&vmf.versionInfo)
+
+	// These come before the world in files that hammer writes
+	for i := range vmf.rawBlocks {
+		if key := *vmf.rawBlocks[i].GetKey(); key == "visgroups" || key == "viewsettings" {
+			writer.writeNode(&vmf.rawBlocks[i])
+		}
+	}
+
+	writer.writeWorld(&vmf.world)
+
+	for i := 0; i < vmf.entities.Length(); i++ {
+		if !vmf.hiddenEntities[i] {
+			writer.writeEntity(vmf.entities.Get(i), vmf.entityBlocks[i], vmf.entitySolids[i])
+		}
+	}
+
+	for i := 0; i < vmf.entities.Length(); i++ {
+		if vmf.hiddenEntities[i] {
+			writer.beginBlock("hidden")
+			writer.writeEntity(vmf.entities.Get(i), vmf.entityBlocks[i], vmf.entitySolids[i])
+			writer.endBlock()
+		}
+	}
+
+	writer.writeCameras(&vmf.cameras)
+
+	for i := range vmf.rawBlocks {
+		if key := *vmf.rawBlocks[i].GetKey(); key != "visgroups" && key != "viewsettings" {
+			writer.writeNode(&vmf.rawBlocks[i])
+		}
+	}
+
+	return writer.err
+}
+
+// Save writes the vmf out to filepath
+func (vmf *Vmf) Save(filepath string) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := vmf.Write(file); err != nil {
+		return err
+	}
+
+	vmf.filepath = filepath
+	return nil
+}
@@ -0,0 +1,237 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/emily33901/lambda-core/core/filesystem"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// The hardware that conditional vmt blocks are checked against.
+// Forgery draws like a dx9 card without hdr
+const (
+	vmtDxLevel  = 95
+	vmtGpuLevel = 3
+)
+
+var (
+	vmtDxCondition       = regexp.MustCompile(`^(>=|<=|>|<)?dx(\d+)(_20b)?$`)
+	vmtGpuCondition      = regexp.MustCompile(`^gpu(>=|<=|>|<)(\d+)$`)
+	vmtFallbackCondition = regexp.MustCompile(`^dx(\d+)$`)
+)
+
+// ReadVmt reads a vmt and resolves any patches, includes and conditional blocks in it
+func ReadVmt(filePath string, fs filesystem.IFileSystem) (*keyvalues.KeyValue, error) {
+	stream, err := fs.GetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := ReadKeyValuesFromReader(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveVmt(kv, fs, map[string]bool{materialFilePath(strings.ToLower(filePath), ".vmt"): true})
+}
+
+// ResolveVmt resolves the patches, includes and conditional blocks in a vmt that has already been read
+func ResolveVmt(kv *keyvalues.KeyValue, fs filesystem.IFileSystem) (*keyvalues.KeyValue, error) {
+	return resolveVmt(kv, fs, map[string]bool{})
+}
+
+// VmtParameter returns the value of a parameter in a resolved vmt
+func VmtParameter(kv *keyvalues.KeyValue, key string) string {
+	children, _ := kv.Children()
+	for _, child := range children {
+		if !child.HasChildren() && strings.EqualFold(child.Key(), key) {
+			return strings.TrimSpace(KeyValueString(child))
+		}
+	}
+
+	return ""
+}
+
+func resolveVmt(kv *keyvalues.KeyValue, fs filesystem.IFileSystem, visited map[string]bool) (*keyvalues.KeyValue, error) {
+	if !kv.HasChildren() {
+		return nil, errors.New("vmt is empty")
+	}
+
+	if strings.EqualFold(kv.Key(), "patch") {
+		patched, err := resolvePatch(kv, fs, visited)
+		if err != nil {
+			return nil, err
+		}
+		kv = patched
+	}
+
+	applyVmtConditionals(kv)
+
+	return kv, nil
+}
+
+// resolvePatch reads the material that a patch includes and applies the patch on top of it.
+// Patches can include other patches so visited is used to find cycles
+func resolvePatch(patch *keyvalues.KeyValue, fs filesystem.IFileSystem, visited map[string]bool) (*keyvalues.KeyValue, error) {
+	include, err := patch.Find("include")
+	if err != nil || include.HasChildren() {
+		return nil, errors.New("patch has no include")
+	}
+
+	includePath := materialFilePath(strings.ToLower(strings.TrimSpace(KeyValueString(include))), ".vmt")
+	if visited[includePath] {
+		return nil, fmt.Errorf("%s is included by itself", includePath)
+	}
+	visited[includePath] = true
+
+	stream, err := fs.GetFile(includePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to include %s: %s", includePath, err)
+	}
+
+	base, err := ReadKeyValuesFromReader(stream)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", includePath, err)
+	}
+	if !base.HasChildren() {
+		return nil, fmt.Errorf("%s is empty", includePath)
+	}
+
+	if strings.EqualFold(base.Key(), "patch") {
+		if base, err = resolvePatch(base, fs, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	sections, _ := patch.Children()
+	for _, section := range sections {
+		if !section.HasChildren() {
+			continue
+		}
+
+		params, _ := section.Children()
+
+		switch strings.ToLower(section.Key()) {
+		case "insert":
+			// Insert adds parameters or overwrites them
+			for _, param := range params {
+				setVmtParameter(base, param)
+			}
+		case "replace":
+			// Replace only overwrites parameters that are already there
+			for _, param := range params {
+				if _, err := base.Find(param.Key()); err == nil {
+					setVmtParameter(base, param)
+				}
+			}
+		}
+	}
+
+	return base, nil
+}
+
+// setVmtParameter replaces every parameter with the same key as param with param
+func setVmtParameter(kv *keyvalues.KeyValue, param *keyvalues.KeyValue) {
+	for {
+		if err := kv.RemoveChild(param.Key()); err != nil {
+			break
+		}
+	}
+
+	kv.AddChild(param)
+}
+
+// compareVmtLevel checks a level against a condition like >= 90
+func compareVmtLevel(op string, have int, want int) bool {
+	switch op {
+	case ">=":
+		return have >= want
+	case "<=":
+		return have <= want
+	case ">":
+		return have > want
+	case "<":
+		return have < want
+	}
+
+	return have == want
+}
+
+// vmtLevel returns a dx level in the form that the material system uses (9 is 90)
+func vmtLevel(level string) int {
+	l, _ := strconv.Atoi(level)
+	if l < 10 {
+		l *= 10
+	}
+
+	return l
+}
+
+// vmtConditionApplies checks a block in the root of a vmt.
+// Conditional is false for blocks (like Proxies) that are not conditions at all
+func vmtConditionApplies(shader string, key string) (applies bool, conditional bool) {
+	// Fallback blocks are named after the shader and the dx level that they are for
+	if strings.HasPrefix(key, shader+"_") {
+		match := vmtFallbackCondition.FindStringSubmatch(strings.TrimPrefix(key, shader+"_"))
+		if match == nil {
+			// Other fallbacks (like hdr ones) never apply
+			return false, true
+		}
+
+		level := vmtLevel(match[1])
+		return level >= 90 && level <= vmtDxLevel, true
+	}
+
+	negate := strings.HasPrefix(key, "!")
+	key = strings.TrimPrefix(key, "!")
+
+	switch key {
+	case "ldr":
+		applies = true
+	case "hdr", "srgb", "360", "ps3", "gameconsole", "lowfill":
+		applies = false
+	default:
+		if match := vmtDxCondition.FindStringSubmatch(key); match != nil {
+			applies = compareVmtLevel(match[1], vmtDxLevel, vmtLevel(match[2]))
+		} else if match := vmtGpuCondition.FindStringSubmatch(key); match != nil {
+			want, _ := strconv.Atoi(match[2])
+			applies = compareVmtLevel(match[1], vmtGpuLevel, want)
+		} else {
+			return false, false
+		}
+	}
+
+	return applies != negate, true
+}
+
+// applyVmtConditionals takes the conditional blocks out of the root of a vmt
+// and moves the parameters of the ones that apply into the root
+func applyVmtConditionals(kv *keyvalues.KeyValue) {
+	shader := strings.ToLower(kv.Key())
+
+	children, _ := kv.Children()
+	for _, child := range children {
+		if !child.HasChildren() {
+			continue
+		}
+
+		applies, conditional := vmtConditionApplies(shader, strings.ToLower(child.Key()))
+		if !conditional {
+			continue
+		}
+
+		kv.RemoveChild(child.Key())
+		if !applies {
+			continue
+		}
+
+		params, _ := child.Children()
+		for _, param := range params {
+			setVmtParameter(kv, param)
+		}
+	}
+}
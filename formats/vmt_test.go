@@ -0,0 +1,136 @@
+package formats
+
+import "testing"
+
+var vmtFiles = map[string]string{
+	"materials/custom/base.vmt": `"LightmappedGeneric"
+{
+	"$basetexture" "custom/base"
+	"$surfaceprop" "concrete"
+}`,
+	"materials/custom/patch.vmt": `"patch"
+{
+	"include" "materials/custom/base.vmt"
+	"insert"
+	{
+		"$basetexture" "custom/inserted"
+		"$bumpmap" "custom/base_normal"
+	}
+	"replace"
+	{
+		"$surfaceprop" "metal"
+		"$detail" "custom/detail"
+	}
+}`,
+	"materials/custom/patchpatch.vmt": `"patch"
+{
+	"include" "custom\patch"
+	"insert"
+	{
+		"$selfillum" "1"
+	}
+}`,
+	"materials/custom/cycle.vmt": `"patch"
+{
+	"include" "materials/custom/cycle.vmt"
+}`,
+	"materials/custom/missing.vmt": `"patch"
+{
+	"include" "materials/custom/nothing.vmt"
+}`,
+	"materials/custom/conditional.vmt": `"LightmappedGeneric"
+{
+	"$basetexture" "custom/base"
+	"<dx90"
+	{
+		"$basetexture" "custom/old"
+	}
+	">=dx90"
+	{
+		"$bumpmap" "custom/base_normal"
+	}
+	"hdr"
+	{
+		"$detail" "custom/hdr"
+	}
+	"LightmappedGeneric_dx9"
+	{
+		"$surfaceprop" "metal"
+	}
+	"LightmappedGeneric_hdr_dx9"
+	{
+		"$selfillum" "1"
+	}
+}`,
+}
+
+func TestReadVmt(t *testing.T) {
+	fs := &memoryFileSystem{files: vmtFiles}
+
+	tests := []struct {
+		name string
+		path string
+		err  bool
+
+		// Parameters after resolving, "" for ones that should not be there
+		params map[string]string
+	}{
+		{
+			name: "insert and replace",
+			path: "materials/custom/patch.vmt",
+			params: map[string]string{
+				"$basetexture": "custom/inserted",
+				"$bumpmap":     "custom/base_normal",
+				"$surfaceprop": "metal",
+				"$detail":      "",
+			},
+		},
+		{
+			name: "patch of a patch",
+			path: "materials/custom/patchpatch.vmt",
+			params: map[string]string{
+				"$basetexture": "custom/inserted",
+				"$surfaceprop": "metal",
+				"$selfillum":   "1",
+			},
+		},
+		{
+			name: "conditional blocks",
+			path: "materials/custom/conditional.vmt",
+			params: map[string]string{
+				"$basetexture": "custom/base",
+				"$bumpmap":     "custom/base_normal",
+				"$surfaceprop": "metal",
+				"$detail":      "",
+				"$selfillum":   "",
+			},
+		},
+		{name: "included by itself", path: "materials/custom/cycle.vmt", err: true},
+		{name: "missing include", path: "materials/custom/missing.vmt", err: true},
+	}
+
+	for _, test := range tests {
+		kv, err := ReadVmt(test.path, fs)
+		if (err != nil) != test.err {
+			t.Errorf("%s: expected an error to be %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		for key, expected := range test.params {
+			if value := VmtParameter(kv, key); value != expected {
+				t.Errorf("%s: expected %s to be %q, got %q", test.name, key, expected, value)
+			}
+		}
+
+		// Conditional blocks are taken out once they have been applied
+		children, _ := kv.Children()
+		for _, child := range children {
+			if child.HasChildren() {
+				t.Errorf("%s: expected %s to be removed", test.name, child.Key())
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// How a vmt parameter is edited
+const (
+	VmtTypeString = iota
+	VmtTypeBool
+	VmtTypeInt
+	VmtTypeFloat
+	VmtTypeColour
+	VmtTypeVector
+	VmtTypeTexture
+)
+
+var vmtTextureParameters = map[string]bool{
+	"$basetexture": true, "$basetexture2": true, "$bumpmap": true, "$bumpmap2": true,
+	"$normalmap": true, "$detail": true, "$detail2": true, "$envmap": true, "$envmapmask": true,
+	"$selfillummask": true, "$lightwarptexture": true, "$iris": true, "$ambientoccltexture": true,
+}
+
+var vmtBoolParameters = map[string]bool{
+	"$translucent": true, "$alphatest": true, "$additive": true, "$nocull": true, "$selfillum": true,
+	"$model": true, "$nodecal": true, "$vertexcolor": true, "$vertexalpha": true, "$ignorez": true,
+	"$nofog": true, "$phong": true, "$halflambert": true, "$basealphaenvmapmask": true,
+	"$normalmapalphaenvmapmask": true, "$selfillum_envmapmask_alpha": true, "$decal": true,
+	"$no_fullbright": true, "$nolod": true, "$nomip": true, "$ssbump": true, "$seamless_base": true,
+	"$blendtintbybasealpha": true, "$allowalphatocoverage": true, "$distancealpha": true,
+}
+
+var vmtIntParameters = map[string]bool{
+	"$frame": true, "$bumpframe": true, "$detailframe": true, "$envmapframe": true,
+	"$detailblendmode": true, "$decalscale": true,
+}
+
+var vmtColourParameters = map[string]bool{
+	"$color": true, "$color2": true, "$envmaptint": true, "$selfillumtint": true,
+	"$phongtint": true, "$reflecttint": true, "$refracttint": true, "$fogcolor": true,
+	"$detailtint": true, "$rimlighttint": true,
+}
+
+// VmtParameterType works out how a parameter should be edited from its name and value
+func VmtParameterType(key string, value string) int {
+	key = strings.ToLower(key)
+	value = strings.TrimSpace(value)
+
+	switch {
+	case vmtTextureParameters[key] || strings.HasSuffix(key, "texture"):
+		return VmtTypeTexture
+	case vmtBoolParameters[key]:
+		return VmtTypeBool
+	case vmtIntParameters[key]:
+		return VmtTypeInt
+	case vmtColourParameters[key]:
+		return VmtTypeColour
+	}
+
+	if _, ok := ParseVmtVector(value); ok {
+		return VmtTypeVector
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return VmtTypeFloat
+	}
+
+	return VmtTypeString
+}
+
+// ParseVmtVector reads a vector like [1 0.5 0]. Vectors in {} are 0-255 and are scaled to 0-1
+func ParseVmtVector(value string) ([]float32, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return nil, false
+	}
+
+	scale := float32(1)
+	switch {
+	case value[0] == '[' && value[len(value)-1] == ']':
+	case value[0] == '{' && value[len(value)-1] == '}':
+		scale = 255
+	default:
+		return nil, false
+	}
+
+	fields := strings.Fields(value[1 : len(value)-1])
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	vector := make([]float32, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return nil, false
+		}
+		vector = append(vector, float32(v)/scale)
+	}
+
+	return vector, true
+}
+
+// FormatVmtVector writes a vector in the [] form
+func FormatVmtVector(vector []float32) string {
+	fields := make([]string, len(vector))
+	for i, v := range vector {
+		fields[i] = strconv.FormatFloat(float64(v), 'g', 4, 32)
+	}
+
+	return "[" + strings.Join(fields, " ") + "]"
+}
+
+// VmtParam is a parameter in the root of a vmt
+type VmtParam struct {
+	Key   string
+	Value string
+}
+
+// EditableVmt is a vmt flattened into its shader and parameters so that it can be edited
+type EditableVmt struct {
+	Shader string
+	Params []*VmtParam
+
+	// Blocks (like Proxies) are not edited and are written back out as they are
+	Blocks []*keyvalues.KeyValue
+}
+
+// NewEditableVmt splits a resolved vmt into its shader, parameters and blocks
+func NewEditableVmt(kv *keyvalues.KeyValue) *EditableVmt {
+	vmt := &EditableVmt{Shader: kv.Key()}
+
+	children, _ := kv.Children()
+	for _, child := range children {
+		if child.HasChildren() {
+			vmt.Blocks = append(vmt.Blocks, child)
+		} else {
+			vmt.Params = append(vmt.Params, &VmtParam{Key: child.Key(), Value: KeyValueString(child)})
+		}
+	}
+
+	return vmt
+}
+
+// Param returns a parameter or nil if the vmt does not have it
+func (vmt *EditableVmt) Param(key string) *VmtParam {
+	for _, p := range vmt.Params {
+		if strings.EqualFold(p.Key, key) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Set changes a parameter or adds it if the vmt does not have it
+func (vmt *EditableVmt) Set(key string, value string) {
+	if p := vmt.Param(key); p != nil {
+		p.Value = value
+		return
+	}
+
+	vmt.Params = append(vmt.Params, &VmtParam{Key: key, Value: value})
+}
+
+// Remove takes a parameter out of the vmt
+func (vmt *EditableVmt) Remove(key string) {
+	for i, p := range vmt.Params {
+		if strings.EqualFold(p.Key, key) {
+			vmt.Params = append(vmt.Params[:i], vmt.Params[i+1:]...)
+			return
+		}
+	}
+}
+
+// Parameters returns the parameters by their lowercase names
+func (vmt *EditableVmt) Parameters() map[string]string {
+	params := make(map[string]string, len(vmt.Params))
+	for _, p := range vmt.Params {
+		params[strings.ToLower(p.Key)] = p.Value
+	}
+
+	return params
+}
+
+func (writer *vmfWriter) writeKeyValues(kv *keyvalues.KeyValue) {
+	children, _ := kv.Children()
+	for _, child := range children {
+		if child.HasChildren() {
+			writer.beginBlock(fmt.Sprintf("\"%s\"", child.Key()))
+			writer.writeKeyValues(child)
+			writer.endBlock()
+		} else {
+			writer.property(child.Key(), KeyValueString(child))
+		}
+	}
+}
+
+// Write writes the vmt out as text
+func (vmt *EditableVmt) Write(w io.Writer) error {
+	writer := newVmfWriter(w)
+
+	writer.beginBlock(fmt.Sprintf("\"%s\"", vmt.Shader))
+	for _, p := range vmt.Params {
+		writer.property(p.Key, p.Value)
+	}
+	for _, block := range vmt.Blocks {
+		writer.beginBlock(fmt.Sprintf("\"%s\"", block.Key()))
+		writer.writeKeyValues(block)
+		writer.endBlock()
+	}
+	writer.endBlock()
+
+	return writer.err
+}
+
+// SaveVmt writes a vmt to a loose file in the materials directory of gameDir
+// where it overrides any vmt of the same name in a vpk. Returns the path relative to gameDir
+func SaveVmt(gameDir string, name string, vmt *EditableVmt) (string, error) {
+	name = looseMaterialName(name)
+	if name == "" {
+		return "", errors.New("the material needs a name")
+	}
+	if strings.TrimSpace(vmt.Shader) == "" {
+		return "", errors.New("the material needs a shader")
+	}
+
+	data := &bytes.Buffer{}
+	if err := vmt.Write(data); err != nil {
+		return "", err
+	}
+
+	path := "materials/" + name + ".vmt"
+	if err := writeLooseFile(gameDir, path, data.Bytes()); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
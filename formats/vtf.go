@@ -0,0 +1,335 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/emily33901/vtf"
+)
+
+// Vtf image formats
+const (
+	VtfFormatRGBA8888 = iota
+	VtfFormatABGR8888
+	VtfFormatRGB888
+	VtfFormatBGR888
+	VtfFormatRGB565
+	VtfFormatI8
+	VtfFormatIA88
+	VtfFormatP8
+	VtfFormatA8
+	VtfFormatRGB888Bluescreen
+	VtfFormatBGR888Bluescreen
+	VtfFormatARGB8888
+	VtfFormatBGRA8888
+	VtfFormatDXT1
+	VtfFormatDXT3
+	VtfFormatDXT5
+	VtfFormatBGRX8888
+	VtfFormatBGR565
+	VtfFormatBGRX5551
+	VtfFormatBGRA4444
+	VtfFormatDXT1OneBitAlpha
+	VtfFormatBGRA5551
+	VtfFormatUV88
+	VtfFormatUVWQ8888
+	VtfFormatRGBA16161616F
+	VtfFormatRGBA16161616
+	VtfFormatUVLX8888
+	VtfFormatR32F
+	VtfFormatRGB323232F
+	VtfFormatRGBA32323232F
+	VtfFormatNVDST16
+	VtfFormatNVDST24
+	VtfFormatNVINTZ
+	VtfFormatNVRAWZ
+	VtfFormatATIDST16
+	VtfFormatATIDST24
+	VtfFormatNVNULL
+	VtfFormatATI2N
+	VtfFormatATI1N
+)
+
+// VtfFormatNone is used when there is no low resolution image
+const VtfFormatNone = 0xffffffff
+
+// vtfFormatInfo is how a format is laid out in a vtf
+type vtfFormatInfo struct {
+	name string
+
+	// Uncompressed formats use bytesPerPixel, compressed ones use 4x4 blocks of blockSize
+	bytesPerPixel int
+	blockSize     int
+}
+
+var vtfFormats = [...]vtfFormatInfo{
+	VtfFormatRGBA8888:         {"RGBA8888", 4, 0},
+	VtfFormatABGR8888:         {"ABGR8888", 4, 0},
+	VtfFormatRGB888:           {"RGB888", 3, 0},
+	VtfFormatBGR888:           {"BGR888", 3, 0},
+	VtfFormatRGB565:           {"RGB565", 2, 0},
+	VtfFormatI8:               {"I8", 1, 0},
+	VtfFormatIA88:             {"IA88", 2, 0},
+	VtfFormatP8:               {"P8", 1, 0},
+	VtfFormatA8:               {"A8", 1, 0},
+	VtfFormatRGB888Bluescreen: {"RGB888_BLUESCREEN", 3, 0},
+	VtfFormatBGR888Bluescreen: {"BGR888_BLUESCREEN", 3, 0},
+	VtfFormatARGB8888:         {"ARGB8888", 4, 0},
+	VtfFormatBGRA8888:         {"BGRA8888", 4, 0},
+	VtfFormatDXT1:             {"DXT1", 0, 8},
+	VtfFormatDXT3:             {"DXT3", 0, 16},
+	VtfFormatDXT5:             {"DXT5", 0, 16},
+	VtfFormatBGRX8888:         {"BGRX8888", 4, 0},
+	VtfFormatBGR565:           {"BGR565", 2, 0},
+	VtfFormatBGRX5551:         {"BGRX5551", 2, 0},
+	VtfFormatBGRA4444:         {"BGRA4444", 2, 0},
+	VtfFormatDXT1OneBitAlpha:  {"DXT1_ONEBITALPHA", 0, 8},
+	VtfFormatBGRA5551:         {"BGRA5551", 2, 0},
+	VtfFormatUV88:             {"UV88", 2, 0},
+	VtfFormatUVWQ8888:         {"UVWQ8888", 4, 0},
+	VtfFormatRGBA16161616F:    {"RGBA16161616F", 8, 0},
+	VtfFormatRGBA16161616:     {"RGBA16161616", 8, 0},
+	VtfFormatUVLX8888:         {"UVLX8888", 4, 0},
+	VtfFormatR32F:             {"R32F", 4, 0},
+	VtfFormatRGB323232F:       {"RGB323232F", 12, 0},
+	VtfFormatRGBA32323232F:    {"RGBA32323232F", 16, 0},
+	VtfFormatNVDST16:          {"NV_DST16", 2, 0},
+	VtfFormatNVDST24:          {"NV_DST24", 4, 0},
+	VtfFormatNVINTZ:           {"NV_INTZ", 4, 0},
+	VtfFormatNVRAWZ:           {"NV_RAWZ", 4, 0},
+	VtfFormatATIDST16:         {"ATI_DST16", 2, 0},
+	VtfFormatATIDST24:         {"ATI_DST24", 4, 0},
+	VtfFormatNVNULL:           {"NV_NULL", 4, 0},
+	VtfFormatATI2N:            {"ATI2N", 0, 16},
+	VtfFormatATI1N:            {"ATI1N", 0, 8},
+}
+
+// Resource tags in 7.3+ vtfs
+var (
+	vtfResourceLowRes  = [3]byte{0x01, 0, 0}
+	vtfResourceHighRes = [3]byte{0x30, 0, 0}
+)
+
+// Where the resource dictionary starts in 7.3+ vtfs
+const vtfResourceOffset = 80
+
+// VtfFormatName returns the name of a vtf image format
+func VtfFormatName(format uint32) string {
+	if int(format) < len(vtfFormats) {
+		return vtfFormats[format].name
+	}
+
+	return fmt.Sprintf("Unknown (%d)", format)
+}
+
+// VtfImageSize returns the number of bytes that an image takes up in a vtf
+// or -1 if the format is not known
+func VtfImageSize(format uint32, width int, height int) int {
+	if int(format) >= len(vtfFormats) {
+		return -1
+	}
+
+	info := vtfFormats[format]
+	if info.blockSize != 0 {
+		return ((width + 3) / 4) * ((height + 3) / 4) * info.blockSize
+	}
+
+	return width * height * info.bytesPerPixel
+}
+
+// VtfMip is one mip level of every frame and face in a vtf
+type VtfMip struct {
+	Width  int
+	Height int
+
+	// Images are indexed by frame then face
+	Images [][][]byte
+}
+
+// Vtf is a texture with all of its mips, frames and faces.
+// Volume textures only keep their first slice
+type Vtf struct {
+	Header vtf.Header
+
+	Frames int
+	Faces  int
+
+	LowRes []byte
+
+	// Mips go from the largest to the smallest
+	Mips []VtfMip
+}
+
+// Format returns the format of the high resolution images
+func (v *Vtf) Format() uint32 {
+	return v.Header.HighResImageFormat
+}
+
+// Width returns the width of the largest mip
+func (v *Vtf) Width() int {
+	return v.Mips[0].Width
+}
+
+// Height returns the height of the largest mip
+func (v *Vtf) Height() int {
+	return v.Mips[0].Height
+}
+
+// Image returns the raw data for a mip, frame and face
+func (v *Vtf) Image(mip int, frame int, face int) []byte {
+	return v.Mips[mip].Images[frame][face]
+}
+
+// DecodeImage returns a mip, frame and face as RGBA8888
+func (v *Vtf) DecodeImage(mip int, frame int, face int) ([]byte, error) {
+	m := v.Mips[mip]
+	return DecodeVtfImage(v.Format(), m.Width, m.Height, m.Images[frame][face])
+}
+
+func readVtfHeader(data []byte) (*vtf.Header, error) {
+	header := &vtf.Header{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, header); err != nil {
+		return nil, errors.New("vtf is truncated")
+	}
+
+	if string(header.Signature[:]) != "VTF\x00" {
+		return nil, errors.New("not a vtf")
+	}
+
+	if header.Version[0] != 7 {
+		return nil, fmt.Errorf("unsupported vtf version %d.%d", header.Version[0], header.Version[1])
+	}
+
+	// Older headers are shorter so whatever was read past the end is image data
+	if header.Version[1] < 2 {
+		header.Depth = 1
+	}
+	if header.Version[1] < 3 {
+		header.NumResource = 0
+	}
+
+	return header, nil
+}
+
+// ReadVtf reads a vtf in any of the formats that Source uses
+func ReadVtf(stream io.Reader) (*Vtf, error) {
+	data, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := readVtfHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	width := int(header.Width)
+	height := int(header.Height)
+	if width == 0 || height == 0 {
+		return nil, errors.New("vtf has no size")
+	}
+	if VtfImageSize(header.HighResImageFormat, 1, 1) < 0 {
+		return nil, fmt.Errorf("unknown vtf format %d", header.HighResImageFormat)
+	}
+
+	v := &Vtf{
+		Header: *header,
+		Frames: int(header.Frames),
+		Faces:  1,
+	}
+	if v.Frames < 1 {
+		v.Frames = 1
+	}
+
+	if header.Flags&vtf.FlagEnvironmentMap != 0 {
+		v.Faces = 6
+
+		// Cubemaps before 7.5 have a spheremap after the six faces
+		if header.Version[1] < 5 && header.FirstFrame != 0xffff {
+			v.Faces = 7
+		}
+	}
+
+	lowResSize := 0
+	if header.LowResImageFormat != VtfFormatNone && header.LowResImageWidth > 0 && header.LowResImageHeight > 0 {
+		lowResSize = maxInt(VtfImageSize(header.LowResImageFormat, int(header.LowResImageWidth), int(header.LowResImageHeight)), 0)
+	}
+
+	lowResOffset := int(header.HeaderSize)
+	highResOffset := lowResOffset + lowResSize
+
+	// 7.3+ say where everything is in a resource dictionary
+	for i := 0; i < int(header.NumResource); i++ {
+		entry := vtfResourceOffset + i*8
+		if entry+8 > len(data) {
+			return nil, errors.New("vtf resources are truncated")
+		}
+
+		var tag [3]byte
+		copy(tag[:], data[entry:])
+		offset := int(binary.LittleEndian.Uint32(data[entry+4:]))
+
+		switch tag {
+		case vtfResourceLowRes:
+			lowResOffset = offset
+		case vtfResourceHighRes:
+			highResOffset = offset
+		}
+	}
+
+	if lowResSize > 0 && lowResOffset+lowResSize <= len(data) {
+		v.LowRes = data[lowResOffset : lowResOffset+lowResSize]
+	}
+
+	mipCount := int(header.MipmapCount)
+	if mipCount < 1 {
+		mipCount = 1
+	}
+
+	depth := int(header.Depth)
+	if depth < 1 {
+		depth = 1
+	}
+
+	v.Mips = make([]VtfMip, mipCount)
+	offset := highResOffset
+
+	// Mips are stored smallest first
+	for level := mipCount - 1; level >= 0; level-- {
+		m := VtfMip{
+			Width:  maxInt(width>>uint(level), 1),
+			Height: maxInt(height>>uint(level), 1),
+			Images: make([][][]byte, v.Frames),
+		}
+		slices := maxInt(depth>>uint(level), 1)
+		size := VtfImageSize(header.HighResImageFormat, m.Width, m.Height)
+
+		for frame := 0; frame < v.Frames; frame++ {
+			m.Images[frame] = make([][]byte, v.Faces)
+
+			for face := 0; face < v.Faces; face++ {
+				if offset+size*slices > len(data) {
+					return nil, errors.New("vtf image data is truncated")
+				}
+
+				m.Images[frame][face] = data[offset : offset+size]
+				offset += size * slices
+			}
+		}
+
+		v.Mips[level] = m
+	}
+
+	return v, nil
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
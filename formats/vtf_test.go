@@ -0,0 +1,286 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/emily33901/vtf"
+)
+
+// testVtf describes a vtf to build for a test
+type testVtf struct {
+	version uint32
+	width   int
+	height  int
+	format  uint32
+	flags   uint32
+	frames  int
+
+	// firstFrame defaults to 0, 0xffff marks a cubemap without a spheremap
+	firstFrame uint16
+	mips       int
+
+	lowResFormat uint32
+	lowResWidth  int
+	lowResHeight int
+
+	// resources writes a 7.3 resource dictionary with the high res images before the low res one
+	resources bool
+}
+
+// buildVtf writes out a vtf where every byte of an image is set to imageByte(mip, frame, face)
+// and every byte of the low res image is 0xee
+func buildVtf(t *testing.T, desc testVtf) []byte {
+	faces := 1
+	if desc.flags&vtf.FlagEnvironmentMap != 0 {
+		faces = 6
+		if desc.version < 5 && desc.firstFrame != 0xffff {
+			faces = 7
+		}
+	}
+
+	lowResFormat, lowResSize := uint32(VtfFormatNone), 0
+	if desc.lowResWidth > 0 {
+		lowResFormat = desc.lowResFormat
+		lowResSize = VtfImageSize(desc.lowResFormat, desc.lowResWidth, desc.lowResHeight)
+	}
+	lowRes := bytes.Repeat([]byte{0xee}, lowResSize)
+
+	images := &bytes.Buffer{}
+	for level := desc.mips - 1; level >= 0; level-- {
+		size := VtfImageSize(desc.format, maxInt(desc.width>>uint(level), 1), maxInt(desc.height>>uint(level), 1))
+		for frame := 0; frame < desc.frames; frame++ {
+			for face := 0; face < faces; face++ {
+				images.Write(bytes.Repeat([]byte{imageByte(level, frame, face)}, size))
+			}
+		}
+	}
+
+	headerSize := vtfResourceOffset
+	if desc.resources {
+		headerSize += 2 * 8
+	}
+
+	header := vtf.Header{
+		HeaderCommon: vtf.HeaderCommon{
+			Signature:          [4]byte{'V', 'T', 'F', 0},
+			Version:            [2]uint32{7, desc.version},
+			HeaderSize:         uint32(headerSize),
+			Width:              uint16(desc.width),
+			Height:             uint16(desc.height),
+			Flags:              desc.flags,
+			Frames:             uint16(desc.frames),
+			FirstFrame:         desc.firstFrame,
+			HighResImageFormat: desc.format,
+			MipmapCount:        uint8(desc.mips),
+			LowResImageFormat:  lowResFormat,
+			LowResImageWidth:   uint8(desc.lowResWidth),
+			LowResImageHeight:  uint8(desc.lowResHeight),
+		},
+		Header72: vtf.Header72{Depth: 1},
+	}
+	if desc.resources {
+		header.NumResource = 2
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, vtfResourceOffset-buf.Len()))
+
+	if !desc.resources {
+		buf.Write(lowRes)
+		buf.Write(images.Bytes())
+		return buf.Bytes()
+	}
+
+	writeResource := func(tag [3]byte, offset int) {
+		buf.Write(tag[:])
+		buf.WriteByte(0)
+		binary.Write(buf, binary.LittleEndian, uint32(offset))
+	}
+	writeResource(vtfResourceHighRes, headerSize)
+	writeResource(vtfResourceLowRes, headerSize+images.Len())
+
+	buf.Write(images.Bytes())
+	buf.Write(lowRes)
+	return buf.Bytes()
+}
+
+func imageByte(mip int, frame int, face int) byte {
+	return byte(mip<<5 | frame<<3 | face)
+}
+
+func TestReadVtfFormats(t *testing.T) {
+	// Every format as a 1x1 image, block formats only use the first pixel of their block
+	tests := []struct {
+		format   uint32
+		data     []byte
+		expected [4]byte
+		err      bool
+	}{
+		{format: VtfFormatRGBA8888, data: []byte{1, 2, 3, 4}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatABGR8888, data: []byte{4, 3, 2, 1}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatRGB888, data: []byte{1, 2, 3}, expected: [4]byte{1, 2, 3, 255}},
+		{format: VtfFormatBGR888, data: []byte{3, 2, 1}, expected: [4]byte{1, 2, 3, 255}},
+		{format: VtfFormatRGB565, data: []byte{0x1f, 0x00}, expected: [4]byte{255, 0, 0, 255}},
+		{format: VtfFormatI8, data: []byte{7}, expected: [4]byte{7, 7, 7, 255}},
+		{format: VtfFormatIA88, data: []byte{7, 9}, expected: [4]byte{7, 7, 7, 9}},
+		{format: VtfFormatP8, data: []byte{7}, expected: [4]byte{7, 7, 7, 255}},
+		{format: VtfFormatA8, data: []byte{7}, expected: [4]byte{0, 0, 0, 7}},
+		{format: VtfFormatRGB888Bluescreen, data: []byte{0, 0, 255}, expected: [4]byte{0, 0, 0, 0}},
+		{format: VtfFormatBGR888Bluescreen, data: []byte{3, 2, 1}, expected: [4]byte{1, 2, 3, 255}},
+		{format: VtfFormatARGB8888, data: []byte{4, 1, 2, 3}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatBGRA8888, data: []byte{3, 2, 1, 4}, expected: [4]byte{1, 2, 3, 4}},
+		// Red and blue end points with the first pixel two thirds of the way to blue
+		{format: VtfFormatDXT1, data: []byte{0x00, 0xf8, 0x1f, 0x00, 0x02, 0, 0, 0}, expected: [4]byte{170, 0, 85, 255}},
+		{format: VtfFormatDXT3, data: []byte{0x08, 0, 0, 0, 0, 0, 0, 0, 0x00, 0xf8, 0x1f, 0x00, 0x02, 0, 0, 0},
+			expected: [4]byte{170, 0, 85, 136}},
+		{format: VtfFormatDXT5, data: []byte{200, 100, 0x02, 0, 0, 0, 0, 0, 0x00, 0xf8, 0x1f, 0x00, 0x02, 0, 0, 0},
+			expected: [4]byte{170, 0, 85, 186}},
+		{format: VtfFormatBGRX8888, data: []byte{3, 2, 1, 9}, expected: [4]byte{1, 2, 3, 255}},
+		{format: VtfFormatBGR565, data: []byte{0x00, 0xf8}, expected: [4]byte{255, 0, 0, 255}},
+		{format: VtfFormatBGRX5551, data: []byte{0x00, 0xfc}, expected: [4]byte{255, 0, 0, 255}},
+		{format: VtfFormatBGRA4444, data: []byte{0x00, 0x0f}, expected: [4]byte{255, 0, 0, 0}},
+		// Three colour mode where the last colour is transparent
+		{format: VtfFormatDXT1OneBitAlpha, data: []byte{0x1f, 0x00, 0x00, 0xf8, 0x03, 0, 0, 0}, expected: [4]byte{0, 0, 0, 0}},
+		{format: VtfFormatBGRA5551, data: []byte{0x00, 0x7c}, expected: [4]byte{255, 0, 0, 0}},
+		{format: VtfFormatUV88, data: []byte{1, 2}, expected: [4]byte{1, 2, 0, 255}},
+		{format: VtfFormatUVWQ8888, data: []byte{1, 2, 3, 4}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatRGBA16161616F, data: []byte{0x00, 0x3c, 0x00, 0x38, 0x00, 0x00, 0x00, 0x3c},
+			expected: [4]byte{255, 128, 0, 255}},
+		{format: VtfFormatRGBA16161616, data: []byte{0x00, 1, 0x00, 2, 0x00, 3, 0x00, 4}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatUVLX8888, data: []byte{1, 2, 3, 4}, expected: [4]byte{1, 2, 3, 4}},
+		{format: VtfFormatR32F, data: []byte{0, 0, 0, 0x3f}, expected: [4]byte{128, 128, 128, 255}},
+		{format: VtfFormatRGB323232F, data: []byte{0, 0, 0x80, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x3f},
+			expected: [4]byte{255, 0, 128, 255}},
+		{format: VtfFormatRGBA32323232F, data: []byte{0, 0, 0x80, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x3f, 0, 0, 0, 0x3f},
+			expected: [4]byte{255, 0, 128, 128}},
+		{format: VtfFormatNVDST16, data: make([]byte, 2), err: true},
+		{format: VtfFormatNVDST24, data: make([]byte, 4), err: true},
+		{format: VtfFormatNVINTZ, data: make([]byte, 4), err: true},
+		{format: VtfFormatNVRAWZ, data: make([]byte, 4), err: true},
+		{format: VtfFormatATIDST16, data: make([]byte, 2), err: true},
+		{format: VtfFormatATIDST24, data: make([]byte, 4), err: true},
+		{format: VtfFormatNVNULL, data: make([]byte, 4), err: true},
+		// Y of 128 and X of 255 leaves nothing for Z
+		{format: VtfFormatATI2N, data: []byte{128, 0, 0, 0, 0, 0, 0, 0, 255, 0, 0, 0, 0, 0, 0, 0},
+			expected: [4]byte{255, 128, 127, 255}},
+		{format: VtfFormatATI1N, data: []byte{200, 100, 0x02, 0, 0, 0, 0, 0}, expected: [4]byte{186, 186, 186, 255}},
+	}
+
+	tested := map[uint32]bool{}
+	for _, test := range tests {
+		tested[test.format] = true
+		name := VtfFormatName(test.format)
+
+		data := buildVtf(t, testVtf{version: 2, width: 1, height: 1, format: test.format, frames: 1, mips: 1})
+		copy(data[vtfResourceOffset:], test.data)
+
+		v, err := ReadVtf(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(v.Image(0, 0, 0), test.data) {
+			t.Errorf("%s: expected image %v, got %v", name, test.data, v.Image(0, 0, 0))
+		}
+
+		rgba, err := v.DecodeImage(0, 0, 0)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error decoding", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(rgba, test.expected[:]) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, rgba)
+		}
+	}
+
+	for format := range vtfFormats {
+		if !tested[uint32(format)] {
+			t.Errorf("%s is not tested", VtfFormatName(uint32(format)))
+		}
+	}
+}
+
+func TestReadVtfLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		desc  testVtf
+		faces int
+	}{
+		{"mips and frames", testVtf{version: 2, width: 8, height: 4, format: VtfFormatRGBA8888, frames: 3, mips: 4}, 1},
+		{"dxt mips", testVtf{version: 2, width: 8, height: 8, format: VtfFormatDXT5, frames: 1, mips: 4}, 1},
+		{"rgb low res", testVtf{version: 2, width: 4, height: 4, format: VtfFormatBGR888, frames: 2, mips: 3,
+			lowResFormat: VtfFormatRGBA8888, lowResWidth: 2, lowResHeight: 2}, 1},
+		{"dxt1 low res", testVtf{version: 1, width: 16, height: 16, format: VtfFormatDXT1, frames: 1, mips: 5,
+			lowResFormat: VtfFormatDXT1, lowResWidth: 4, lowResHeight: 4}, 1},
+		{"cubemap with spheremap", testVtf{version: 4, width: 4, height: 4, format: VtfFormatBGRA8888,
+			flags: vtf.FlagEnvironmentMap, frames: 2, mips: 3}, 7},
+		{"cubemap without spheremap", testVtf{version: 4, width: 4, height: 4, format: VtfFormatBGRA8888,
+			flags: vtf.FlagEnvironmentMap, frames: 1, firstFrame: 0xffff, mips: 3}, 6},
+		{"7.5 cubemap", testVtf{version: 5, width: 4, height: 4, format: VtfFormatBGRA8888,
+			flags: vtf.FlagEnvironmentMap, frames: 2, mips: 3}, 6},
+		{"7.3 resources", testVtf{version: 3, width: 8, height: 8, format: VtfFormatBGRA8888, frames: 2, mips: 4,
+			lowResFormat: VtfFormatRGB888, lowResWidth: 4, lowResHeight: 4, resources: true}, 1},
+		{"7.5 cubemap resources", testVtf{version: 5, width: 4, height: 4, format: VtfFormatDXT1,
+			flags: vtf.FlagEnvironmentMap, frames: 1, mips: 3,
+			lowResFormat: VtfFormatDXT1, lowResWidth: 4, lowResHeight: 4, resources: true}, 6},
+	}
+
+	for _, test := range tests {
+		desc := test.desc
+		v, err := ReadVtf(bytes.NewReader(buildVtf(t, desc)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if v.Frames != desc.frames || v.Faces != test.faces || len(v.Mips) != desc.mips {
+			t.Errorf("%s: expected %d frames, %d faces and %d mips, got %d, %d and %d", test.name,
+				desc.frames, test.faces, desc.mips, v.Frames, v.Faces, len(v.Mips))
+			continue
+		}
+
+		lowResSize := 0
+		if desc.lowResWidth > 0 {
+			lowResSize = VtfImageSize(desc.lowResFormat, desc.lowResWidth, desc.lowResHeight)
+		}
+		if !bytes.Equal(v.LowRes, bytes.Repeat([]byte{0xee}, lowResSize)) {
+			t.Errorf("%s: expected %d bytes of low res image, got %v", test.name, lowResSize, v.LowRes)
+		}
+
+		for mip, m := range v.Mips {
+			width, height := maxInt(desc.width>>uint(mip), 1), maxInt(desc.height>>uint(mip), 1)
+			if m.Width != width || m.Height != height {
+				t.Errorf("%s: expected mip %d to be %dx%d, got %dx%d", test.name, mip, width, height, m.Width, m.Height)
+			}
+
+			size := VtfImageSize(desc.format, width, height)
+			for frame := 0; frame < v.Frames; frame++ {
+				for face := 0; face < v.Faces; face++ {
+					expected := bytes.Repeat([]byte{imageByte(mip, frame, face)}, size)
+					if !bytes.Equal(v.Image(mip, frame, face), expected) {
+						t.Errorf("%s: mip %d frame %d face %d has the wrong data", test.name, mip, frame, face)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReadVtfTruncated(t *testing.T) {
+	data := buildVtf(t, testVtf{version: 2, width: 4, height: 4, format: VtfFormatBGRA8888, frames: 1, mips: 3})
+
+	if _, err := ReadVtf(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("expected an error reading a truncated vtf")
+	}
+}
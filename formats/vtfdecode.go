@@ -0,0 +1,285 @@
+package formats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// DecodeVtfImage converts an image in any vtf format into RGBA8888.
+// Formats that hold something other than colour (like UV88) are copied into the channels as they are
+func DecodeVtfImage(format uint32, width int, height int, data []byte) ([]byte, error) {
+	size := VtfImageSize(format, width, height)
+	if size < 0 {
+		return nil, fmt.Errorf("unknown vtf format %d", format)
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("%s image is truncated", VtfFormatName(format))
+	}
+
+	switch format {
+	case VtfFormatDXT1, VtfFormatDXT1OneBitAlpha, VtfFormatDXT3, VtfFormatDXT5, VtfFormatATI1N, VtfFormatATI2N:
+		return decodeBlocks(format, width, height, data), nil
+	}
+
+	out := make([]byte, width*height*4)
+	bpp := vtfFormats[format].bytesPerPixel
+
+	for i := 0; i < width*height; i++ {
+		if !decodePixel(format, data[i*bpp:(i+1)*bpp], out[i*4:i*4+4]) {
+			return nil, fmt.Errorf("%s images cannot be decoded", VtfFormatName(format))
+		}
+	}
+
+	return out, nil
+}
+
+// expandBits scales a value with the given number of bits up to 8 bits
+func expandBits(value uint16, bits uint) byte {
+	max := uint16(1)<<bits - 1
+	return byte((uint32(value&max)*255 + uint32(max)/2) / uint32(max))
+}
+
+// unpack16 reads channels from a 16 bit pixel. Each channel is a shift and a number of bits
+func unpack16(p []byte, out []byte, r, rBits, g, gBits, b, bBits uint) {
+	v := binary.LittleEndian.Uint16(p)
+	out[0] = expandBits(v>>r, rBits)
+	out[1] = expandBits(v>>g, gBits)
+	out[2] = expandBits(v>>b, bBits)
+	out[3] = 255
+}
+
+func floatToByte(f float32) byte {
+	if f <= 0 || f != f {
+		return 0
+	}
+	if f >= 1 {
+		return 255
+	}
+	return byte(f*255 + 0.5)
+}
+
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mantissa := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mantissa == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Denormal
+		f := float32(mantissa) / 1024 / 16384
+		if sign != 0 {
+			return -f
+		}
+		return f
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+112)<<23 | mantissa<<13)
+}
+
+// decodePixel converts a single uncompressed pixel to RGBA8888.
+// Returns false for formats that do not hold an image (like depth buffers)
+func decodePixel(format uint32, p []byte, out []byte) bool {
+	switch format {
+	case VtfFormatRGBA8888, VtfFormatUVWQ8888, VtfFormatUVLX8888:
+		copy(out, p[:4])
+	case VtfFormatABGR8888:
+		out[0], out[1], out[2], out[3] = p[3], p[2], p[1], p[0]
+	case VtfFormatARGB8888:
+		out[0], out[1], out[2], out[3] = p[1], p[2], p[3], p[0]
+	case VtfFormatBGRA8888:
+		out[0], out[1], out[2], out[3] = p[2], p[1], p[0], p[3]
+	case VtfFormatBGRX8888:
+		out[0], out[1], out[2], out[3] = p[2], p[1], p[0], 255
+	case VtfFormatRGB888:
+		out[0], out[1], out[2], out[3] = p[0], p[1], p[2], 255
+	case VtfFormatBGR888:
+		out[0], out[1], out[2], out[3] = p[2], p[1], p[0], 255
+
+	case VtfFormatRGB888Bluescreen, VtfFormatBGR888Bluescreen:
+		if format == VtfFormatRGB888Bluescreen {
+			out[0], out[1], out[2], out[3] = p[0], p[1], p[2], 255
+		} else {
+			out[0], out[1], out[2], out[3] = p[2], p[1], p[0], 255
+		}
+		// Pure blue is transparent
+		if out[0] == 0 && out[1] == 0 && out[2] == 255 {
+			out[0], out[1], out[2], out[3] = 0, 0, 0, 0
+		}
+
+	case VtfFormatRGB565:
+		unpack16(p, out, 0, 5, 5, 6, 11, 5)
+	case VtfFormatBGR565:
+		unpack16(p, out, 11, 5, 5, 6, 0, 5)
+	case VtfFormatBGRX5551:
+		unpack16(p, out, 10, 5, 5, 5, 0, 5)
+	case VtfFormatBGRA5551:
+		unpack16(p, out, 10, 5, 5, 5, 0, 5)
+		out[3] = expandBits(binary.LittleEndian.Uint16(p)>>15, 1)
+	case VtfFormatBGRA4444:
+		unpack16(p, out, 8, 4, 4, 4, 0, 4)
+		out[3] = expandBits(binary.LittleEndian.Uint16(p)>>12, 4)
+
+	// Palettes were never used so P8 is treated like I8
+	case VtfFormatI8, VtfFormatP8:
+		out[0], out[1], out[2], out[3] = p[0], p[0], p[0], 255
+	case VtfFormatIA88:
+		out[0], out[1], out[2], out[3] = p[0], p[0], p[0], p[1]
+	case VtfFormatA8:
+		out[0], out[1], out[2], out[3] = 0, 0, 0, p[0]
+	case VtfFormatUV88:
+		out[0], out[1], out[2], out[3] = p[0], p[1], 0, 255
+
+	case VtfFormatRGBA16161616F:
+		for c := 0; c < 4; c++ {
+			out[c] = floatToByte(halfToFloat(binary.LittleEndian.Uint16(p[c*2:])))
+		}
+	case VtfFormatRGBA16161616:
+		for c := 0; c < 4; c++ {
+			out[c] = byte(binary.LittleEndian.Uint16(p[c*2:]) >> 8)
+		}
+	case VtfFormatR32F:
+		v := floatToByte(math.Float32frombits(binary.LittleEndian.Uint32(p)))
+		out[0], out[1], out[2], out[3] = v, v, v, 255
+	case VtfFormatRGB323232F, VtfFormatRGBA32323232F:
+		out[3] = 255
+		for c := 0; c < len(p)/4; c++ {
+			out[c] = floatToByte(math.Float32frombits(binary.LittleEndian.Uint32(p[c*4:])))
+		}
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// decodeColourBlock decodes the colour part of a DXT block into 16 RGBA pixels.
+// DXT1 blocks can use the three colour mode where the last colour is transparent
+func decodeColourBlock(block []byte, out *[16][4]byte, dxt1 bool, oneBitAlpha bool) {
+	c0 := binary.LittleEndian.Uint16(block)
+	c1 := binary.LittleEndian.Uint16(block[2:])
+
+	var colours [4][4]byte
+	colours[0] = [4]byte{expandBits(c0>>11, 5), expandBits(c0>>5, 6), expandBits(c0, 5), 255}
+	colours[1] = [4]byte{expandBits(c1>>11, 5), expandBits(c1>>5, 6), expandBits(c1, 5), 255}
+
+	for c := 0; c < 3; c++ {
+		a, b := uint16(colours[0][c]), uint16(colours[1][c])
+
+		if c0 > c1 || !dxt1 {
+			colours[2][c] = byte((2*a + b + 1) / 3)
+			colours[3][c] = byte((a + 2*b + 1) / 3)
+		} else {
+			colours[2][c] = byte((a + b) / 2)
+			colours[3][c] = 0
+		}
+	}
+	colours[2][3] = 255
+	colours[3][3] = 255
+	if dxt1 && c0 <= c1 && oneBitAlpha {
+		colours[3][3] = 0
+	}
+
+	indices := binary.LittleEndian.Uint32(block[4:])
+	for i := uint(0); i < 16; i++ {
+		out[i] = colours[(indices>>(i*2))&3]
+	}
+}
+
+// decodeAlphaBlock decodes a DXT5 style interpolated alpha block into 16 values
+func decodeAlphaBlock(block []byte, out *[16]byte) {
+	a0, a1 := uint16(block[0]), uint16(block[1])
+
+	var values [8]byte
+	values[0], values[1] = block[0], block[1]
+	if a0 > a1 {
+		for i := uint16(1); i < 7; i++ {
+			values[i+1] = byte(((7-i)*a0 + i*a1 + 3) / 7)
+		}
+	} else {
+		for i := uint16(1); i < 5; i++ {
+			values[i+1] = byte(((5-i)*a0 + i*a1 + 2) / 5)
+		}
+		values[6] = 0
+		values[7] = 255
+	}
+
+	// 48 bits of 3 bit indices
+	bits := uint64(0)
+	for i := 0; i < 6; i++ {
+		bits |= uint64(block[2+i]) << (uint(i) * 8)
+	}
+
+	for i := uint(0); i < 16; i++ {
+		out[i] = values[(bits>>(i*3))&7]
+	}
+}
+
+// decodeBlocks decodes any of the 4x4 block compressed formats
+func decodeBlocks(format uint32, width int, height int, data []byte) []byte {
+	out := make([]byte, width*height*4)
+	blockSize := vtfFormats[format].blockSize
+	blocksWide := (width + 3) / 4
+
+	var pixels [16][4]byte
+	var alpha, second [16]byte
+
+	for by := 0; by < (height+3)/4; by++ {
+		for bx := 0; bx < blocksWide; bx++ {
+			block := data[(by*blocksWide+bx)*blockSize:]
+
+			switch format {
+			case VtfFormatDXT1:
+				decodeColourBlock(block, &pixels, true, false)
+			case VtfFormatDXT1OneBitAlpha:
+				decodeColourBlock(block, &pixels, true, true)
+
+			case VtfFormatDXT3:
+				decodeColourBlock(block[8:], &pixels, false, false)
+				for i := uint(0); i < 16; i++ {
+					pixels[i][3] = expandBits(uint16(block[i/2]>>((i%2)*4)), 4)
+				}
+
+			case VtfFormatDXT5:
+				decodeColourBlock(block[8:], &pixels, false, false)
+				decodeAlphaBlock(block, &alpha)
+				for i := range pixels {
+					pixels[i][3] = alpha[i]
+				}
+
+			case VtfFormatATI1N:
+				decodeAlphaBlock(block, &alpha)
+				for i := range pixels {
+					pixels[i] = [4]byte{alpha[i], alpha[i], alpha[i], 255}
+				}
+
+			case VtfFormatATI2N:
+				// ATI2N keeps Y in the first block and X in the second,
+				// these are normal maps so Z is worked out from them
+				decodeAlphaBlock(block, &alpha)
+				decodeAlphaBlock(block[8:], &second)
+				for i := range pixels {
+					x := float64(second[i])/127.5 - 1
+					y := float64(alpha[i])/127.5 - 1
+					z := math.Sqrt(math.Max(0, 1-x*x-y*y))
+					pixels[i] = [4]byte{second[i], alpha[i], byte(z*127.5 + 127.5), 255}
+				}
+			}
+
+			for i := 0; i < 16; i++ {
+				x := bx*4 + i%4
+				y := by*4 + i/4
+				if x < width && y < height {
+					copy(out[(y*width+x)*4:], pixels[i][:])
+				}
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,179 @@
+package formats
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EncodeVtfImage converts an RGBA8888 image into one of the formats that textures are imported as
+func EncodeVtfImage(format uint32, width int, height int, rgba []byte) ([]byte, error) {
+	if len(rgba) < width*height*4 {
+		return nil, fmt.Errorf("image is truncated")
+	}
+
+	switch format {
+	case VtfFormatRGBA8888:
+		return append([]byte(nil), rgba[:width*height*4]...), nil
+
+	case VtfFormatBGRA8888:
+		out := make([]byte, width*height*4)
+		for i := 0; i < width*height*4; i += 4 {
+			out[i], out[i+1], out[i+2], out[i+3] = rgba[i+2], rgba[i+1], rgba[i], rgba[i+3]
+		}
+		return out, nil
+
+	case VtfFormatDXT1, VtfFormatDXT5:
+		return encodeBlocks(format, width, height, rgba), nil
+	}
+
+	return nil, fmt.Errorf("%s images cannot be encoded", VtfFormatName(format))
+}
+
+func pack565(c [4]byte) uint16 {
+	return uint16(c[0]>>3)<<11 | uint16(c[1]>>2)<<5 | uint16(c[2]>>3)
+}
+
+func unpack565(c uint16) [4]byte {
+	return [4]byte{expandBits(c>>11, 5), expandBits(c>>5, 6), expandBits(c, 5), 255}
+}
+
+func colourDistance(a [4]byte, b [4]byte) int {
+	dr, dg, db := int(a[0])-int(b[0]), int(a[1])-int(b[1]), int(a[2])-int(b[2])
+	return dr*dr + dg*dg + db*db
+}
+
+// encodeColourBlock encodes 16 RGBA pixels into the colour part of a DXT block.
+// The ends of the line are the corners of the box around the colours which is
+// quick and good enough for textures that are going to be looked at in an editor.
+// Blocks always use the four colour mode so they decode the same in DXT1 and DXT5
+func encodeColourBlock(pixels *[16][4]byte, block []byte) {
+	min := [4]byte{255, 255, 255, 255}
+	max := [4]byte{}
+	for _, p := range pixels {
+		for c := 0; c < 3; c++ {
+			if p[c] < min[c] {
+				min[c] = p[c]
+			}
+			if p[c] > max[c] {
+				max[c] = p[c]
+			}
+		}
+	}
+
+	c0, c1 := pack565(max), pack565(min)
+	if c0 < c1 {
+		c0, c1 = c1, c0
+	}
+
+	binary.LittleEndian.PutUint16(block, c0)
+	binary.LittleEndian.PutUint16(block[2:], c1)
+
+	if c0 == c1 {
+		// Every index is 0 so the three colour mode does not matter
+		binary.LittleEndian.PutUint32(block[4:], 0)
+		return
+	}
+
+	var colours [4][4]byte
+	colours[0], colours[1] = unpack565(c0), unpack565(c1)
+	for c := 0; c < 3; c++ {
+		a, b := uint16(colours[0][c]), uint16(colours[1][c])
+		colours[2][c] = byte((2*a + b + 1) / 3)
+		colours[3][c] = byte((a + 2*b + 1) / 3)
+	}
+
+	indices := uint32(0)
+	for i, p := range pixels {
+		best, bestDistance := 0, colourDistance(p, colours[0])
+		for j := 1; j < 4; j++ {
+			if d := colourDistance(p, colours[j]); d < bestDistance {
+				best, bestDistance = j, d
+			}
+		}
+		indices |= uint32(best) << (uint(i) * 2)
+	}
+
+	binary.LittleEndian.PutUint32(block[4:], indices)
+}
+
+// encodeAlphaBlock encodes 16 alpha values into a DXT5 style interpolated alpha block
+func encodeAlphaBlock(alpha *[16]byte, block []byte) {
+	a0, a1 := byte(0), byte(255)
+	for _, a := range alpha {
+		if a > a0 {
+			a0 = a
+		}
+		if a < a1 {
+			a1 = a
+		}
+	}
+
+	block[0], block[1] = a0, a1
+
+	// With a0 > a1 there are 6 values between them, with a0 == a1 every index is 0
+	var values [8]int
+	values[0], values[1] = int(a0), int(a1)
+	for i := 1; i < 7; i++ {
+		values[i+1] = ((7-i)*int(a0) + i*int(a1) + 3) / 7
+	}
+
+	bits := uint64(0)
+	if a0 != a1 {
+		for i, a := range alpha {
+			best, bestDistance := 0, 256
+			for j, v := range values {
+				d := int(a) - v
+				if d < 0 {
+					d = -d
+				}
+				if d < bestDistance {
+					best, bestDistance = j, d
+				}
+			}
+			bits |= uint64(best) << (uint(i) * 3)
+		}
+	}
+
+	for i := 0; i < 6; i++ {
+		block[2+i] = byte(bits >> (uint(i) * 8))
+	}
+}
+
+// encodeBlocks encodes DXT1 or DXT5 images.
+// Blocks that hang off the edge of the image repeat the last row and column
+func encodeBlocks(format uint32, width int, height int, rgba []byte) []byte {
+	blockSize := vtfFormats[format].blockSize
+	blocksWide := (width + 3) / 4
+	blocksHigh := (height + 3) / 4
+	out := make([]byte, blocksWide*blocksHigh*blockSize)
+
+	var pixels [16][4]byte
+	var alpha [16]byte
+
+	for by := 0; by < blocksHigh; by++ {
+		for bx := 0; bx < blocksWide; bx++ {
+			for i := 0; i < 16; i++ {
+				x := minInt(bx*4+i%4, width-1)
+				y := minInt(by*4+i/4, height-1)
+				copy(pixels[i][:], rgba[(y*width+x)*4:])
+				alpha[i] = pixels[i][3]
+			}
+
+			block := out[(by*blocksWide+bx)*blockSize:]
+			if format == VtfFormatDXT5 {
+				encodeAlphaBlock(&alpha, block)
+				block = block[8:]
+			}
+			encodeColourBlock(&pixels, block)
+		}
+	}
+
+	return out
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,263 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+
+	"github.com/emily33901/vtf"
+)
+
+// vtfHeaderSize is the size of a 7.2 header once it is padded out
+const vtfHeaderSize = 80
+
+// Largest size that an imported texture is scaled to
+const maxVtfSize = 4096
+
+// vtfLowResSize is the largest that the low resolution image is on either axis
+const vtfLowResSize = 16
+
+// VtfImportFormats are the formats that images can be imported as
+var VtfImportFormats = []uint32{VtfFormatDXT1, VtfFormatDXT5, VtfFormatBGRA8888}
+
+// VtfImportOptions are how an image is turned into a vtf
+type VtfImportOptions struct {
+	// Format is one of VtfImportFormats
+	Format uint32
+
+	NoMipmaps bool
+	NormalMap bool
+	ClampS    bool
+	ClampT    bool
+}
+
+// toNRGBA copies any image into an NRGBA image that starts at 0, 0
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Rect, img, bounds.Min, draw.Src)
+
+	return out
+}
+
+// ImageHasAlpha checks whether any pixel of an image is not opaque
+func ImageHasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	nrgba := toNRGBA(img)
+	for i := 3; i < len(nrgba.Pix); i += 4 {
+		if nrgba.Pix[i] != 255 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nearestPowerOfTwo rounds a size to the closest power of two that a vtf can be
+func nearestPowerOfTwo(size int) int {
+	p := 1
+	for p < size && p < maxVtfSize {
+		p *= 2
+	}
+
+	// Go down instead when that is closer
+	if p > 1 && p-size > size-p/2 {
+		p /= 2
+	}
+
+	return p
+}
+
+// resizeNRGBA scales an image with bilinear filtering
+func resizeNRGBA(img *image.NRGBA, width int, height int) *image.NRGBA {
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy := math.Max(0, (float64(y)+0.5)*float64(srcH)/float64(height)-0.5)
+		y0 := minInt(int(sy), srcH-1)
+		y1 := minInt(y0+1, srcH-1)
+		fy := sy - float64(y0)
+
+		for x := 0; x < width; x++ {
+			sx := math.Max(0, (float64(x)+0.5)*float64(srcW)/float64(width)-0.5)
+			x0 := minInt(int(sx), srcW-1)
+			x1 := minInt(x0+1, srcW-1)
+			fx := sx - float64(x0)
+
+			for c := 0; c < 4; c++ {
+				p00 := float64(img.Pix[y0*img.Stride+x0*4+c])
+				p10 := float64(img.Pix[y0*img.Stride+x1*4+c])
+				p01 := float64(img.Pix[y1*img.Stride+x0*4+c])
+				p11 := float64(img.Pix[y1*img.Stride+x1*4+c])
+
+				top := p00 + (p10-p00)*fx
+				bottom := p01 + (p11-p01)*fx
+				out.Pix[y*out.Stride+x*4+c] = byte(top + (bottom-top)*fy + 0.5)
+			}
+		}
+	}
+
+	return out
+}
+
+// halveRGBA makes the next mip of an RGBA8888 image by averaging 2x2 pixels
+func halveRGBA(rgba []byte, width int, height int) ([]byte, int, int) {
+	newW, newH := maxInt(width/2, 1), maxInt(height/2, 1)
+	out := make([]byte, newW*newH*4)
+
+	for y := 0; y < newH; y++ {
+		for x := 0; x < newW; x++ {
+			x0, y0 := x*2, y*2
+			x1, y1 := minInt(x0+1, width-1), minInt(y0+1, height-1)
+
+			for c := 0; c < 4; c++ {
+				sum := int(rgba[(y0*width+x0)*4+c]) + int(rgba[(y0*width+x1)*4+c]) +
+					int(rgba[(y1*width+x0)*4+c]) + int(rgba[(y1*width+x1)*4+c])
+				out[(y*newW+x)*4+c] = byte((sum + 2) / 4)
+			}
+		}
+	}
+
+	return out, newW, newH
+}
+
+// vtfReflectivity is the average linear colour of an image, which vrad bounces light with
+func vtfReflectivity(rgba []byte) [3]float32 {
+	var sum [3]float64
+	for i := 0; i < len(rgba); i += 4 {
+		for c := 0; c < 3; c++ {
+			sum[c] += math.Pow(float64(rgba[i+c])/255, 2.2)
+		}
+	}
+
+	pixels := float64(len(rgba) / 4)
+	return [3]float32{float32(sum[0] / pixels), float32(sum[1] / pixels), float32(sum[2] / pixels)}
+}
+
+// NewVtfFromImage turns an image into a single frame vtf with generated mips.
+// Images that are not a power of two are scaled to the closest one
+func NewVtfFromImage(img image.Image, options VtfImportOptions) (*Vtf, error) {
+	switch options.Format {
+	case VtfFormatDXT1, VtfFormatDXT5, VtfFormatBGRA8888:
+	default:
+		return nil, fmt.Errorf("images cannot be imported as %s", VtfFormatName(options.Format))
+	}
+
+	nrgba := toNRGBA(img)
+	width, height := nrgba.Rect.Dx(), nrgba.Rect.Dy()
+	if width == 0 || height == 0 {
+		return nil, errors.New("image has no size")
+	}
+
+	if w, h := nearestPowerOfTwo(width), nearestPowerOfTwo(height); w != width || h != height {
+		nrgba = resizeNRGBA(nrgba, w, h)
+		width, height = w, h
+	}
+
+	flags := uint32(0)
+	if options.NoMipmaps {
+		flags |= vtf.FlagNoMipmaps | vtf.FlagNoLevelOfDetail
+	}
+	if options.NormalMap {
+		flags |= vtf.FlagNormalMap
+	}
+	if options.ClampS {
+		flags |= vtf.FlagClampS
+	}
+	if options.ClampT {
+		flags |= vtf.FlagClampT
+	}
+	if options.Format == VtfFormatDXT5 || (options.Format == VtfFormatBGRA8888 && ImageHasAlpha(nrgba)) {
+		flags |= vtf.FlagEightBitAlpha
+	}
+
+	v := &Vtf{Frames: 1, Faces: 1}
+
+	rgba, mipW, mipH := nrgba.Pix, width, height
+	var lowRes []byte
+	lowResW, lowResH := 0, 0
+
+	for {
+		data, err := EncodeVtfImage(options.Format, mipW, mipH, rgba)
+		if err != nil {
+			return nil, err
+		}
+		v.Mips = append(v.Mips, VtfMip{Width: mipW, Height: mipH, Images: [][][]byte{{data}}})
+
+		// The low resolution image is always DXT1
+		if lowRes == nil && mipW <= vtfLowResSize && mipH <= vtfLowResSize {
+			lowRes = encodeBlocks(VtfFormatDXT1, mipW, mipH, rgba)
+			lowResW, lowResH = mipW, mipH
+		}
+
+		if (mipW == 1 && mipH == 1) || (options.NoMipmaps && lowRes != nil) {
+			break
+		}
+
+		rgba, mipW, mipH = halveRGBA(rgba, mipW, mipH)
+	}
+
+	if options.NoMipmaps {
+		v.Mips = v.Mips[:1]
+	}
+
+	v.LowRes = lowRes
+	v.Header = vtf.Header{
+		HeaderCommon: vtf.HeaderCommon{
+			Signature:          [4]byte{'V', 'T', 'F', 0},
+			Version:            [2]uint32{7, 2},
+			HeaderSize:         vtfHeaderSize,
+			Width:              uint16(width),
+			Height:             uint16(height),
+			Flags:              flags,
+			Frames:             1,
+			Reflectivity:       vtfReflectivity(nrgba.Pix),
+			BumpmapScale:       1,
+			HighResImageFormat: options.Format,
+			MipmapCount:        uint8(len(v.Mips)),
+			LowResImageFormat:  VtfFormatDXT1,
+			LowResImageWidth:   uint8(lowResW),
+			LowResImageHeight:  uint8(lowResH),
+		},
+		Header72: vtf.Header72{Depth: 1},
+	}
+
+	return v, nil
+}
+
+// WriteVtf writes a single face vtf out as version 7.2
+func WriteVtf(v *Vtf, w io.Writer) error {
+	header := v.Header
+	header.Version = [2]uint32{7, 2}
+	header.HeaderSize = vtfHeaderSize
+	header.NumResource = 0
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	buf.Write(make([]byte, vtfHeaderSize-buf.Len()))
+
+	buf.Write(v.LowRes)
+
+	// Mips are stored smallest first
+	for level := len(v.Mips) - 1; level >= 0; level-- {
+		for frame := 0; frame < v.Frames; frame++ {
+			for face := 0; face < v.Faces; face++ {
+				buf.Write(v.Mips[level].Images[frame][face])
+			}
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,120 @@
+package formats
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/emily33901/vtf"
+)
+
+// gradientImage makes an image that changes colour across it, with alpha going down it if alpha is set
+func gradientImage(width int, height int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255}
+			if alpha {
+				c.A = uint8(255 - y*255/height)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestWriteVtfRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     *image.NRGBA
+		options VtfImportOptions
+
+		width, height  int
+		mips           int
+		lowResW        int
+		lowResH        int
+		flags, noFlags uint32
+	}{
+		{
+			name:    "bgra8888 with alpha",
+			img:     gradientImage(32, 16, true),
+			options: VtfImportOptions{Format: VtfFormatBGRA8888, ClampS: true},
+			width:   32, height: 16, mips: 6, lowResW: 16, lowResH: 8,
+			flags: vtf.FlagEightBitAlpha | vtf.FlagClampS,
+		},
+		{
+			name:    "opaque bgra8888",
+			img:     gradientImage(32, 16, false),
+			options: VtfImportOptions{Format: VtfFormatBGRA8888},
+			width:   32, height: 16, mips: 6, lowResW: 16, lowResH: 8,
+			noFlags: vtf.FlagEightBitAlpha,
+		},
+		{
+			name:    "dxt1 without mips",
+			img:     gradientImage(32, 16, false),
+			options: VtfImportOptions{Format: VtfFormatDXT1, NoMipmaps: true, NormalMap: true},
+			width:   32, height: 16, mips: 1, lowResW: 16, lowResH: 8,
+			flags: vtf.FlagNoMipmaps | vtf.FlagNoLevelOfDetail | vtf.FlagNormalMap,
+		},
+		{
+			name:    "dxt5 scaled to a power of two",
+			img:     gradientImage(20, 12, true),
+			options: VtfImportOptions{Format: VtfFormatDXT5},
+			width:   16, height: 16, mips: 5, lowResW: 16, lowResH: 16,
+			flags: vtf.FlagEightBitAlpha,
+		},
+	}
+
+	for _, test := range tests {
+		v, err := NewVtfFromImage(test.img, test.options)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := WriteVtf(v, &buf); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		read, err := ReadVtf(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if read.Width() != test.width || read.Height() != test.height || read.Format() != test.options.Format || len(read.Mips) != test.mips {
+			t.Errorf("%s: expected %dx%d %s with %d mips, got %dx%d %s with %d", test.name,
+				test.width, test.height, VtfFormatName(test.options.Format), test.mips,
+				read.Width(), read.Height(), VtfFormatName(read.Format()), len(read.Mips))
+			continue
+		}
+
+		header := read.Header
+		if header.Flags&test.flags != test.flags || header.Flags&test.noFlags != 0 {
+			t.Errorf("%s: expected flags %x and not %x, got %x", test.name, test.flags, test.noFlags, header.Flags)
+		}
+		if int(header.LowResImageWidth) != test.lowResW || int(header.LowResImageHeight) != test.lowResH ||
+			!bytes.Equal(read.LowRes, v.LowRes) {
+			t.Errorf("%s: expected a %dx%d low res image, got %dx%d", test.name,
+				test.lowResW, test.lowResH, header.LowResImageWidth, header.LowResImageHeight)
+		}
+
+		for mip := range v.Mips {
+			if !bytes.Equal(read.Image(mip, 0, 0), v.Image(mip, 0, 0)) {
+				t.Errorf("%s: mip %d is different after reading it back", test.name, mip)
+			}
+		}
+
+		// BGRA8888 is lossless so the largest mip is the image
+		if test.options.Format == VtfFormatBGRA8888 {
+			rgba, err := read.DecodeImage(0, 0, 0)
+			if err != nil || !bytes.Equal(rgba, test.img.Pix) {
+				t.Errorf("%s: expected the largest mip to be the image (%v)", test.name, err)
+			}
+		}
+	}
+}
@@ -15,6 +15,7 @@ require (
 	github.com/galaco/lambda-core v1.1.3 // indirect
 	github.com/galaco/source-tools-common v0.1.0
 	github.com/galaco/vmf v1.0.0
+	github.com/galaco/vpk2 v0.0.0-20181012095330-21e4d1f6c888
 	github.com/go-gl/gl v0.0.0-20190320195200-bf2b1f2f34d7
 	github.com/go-gl/glfw v0.0.0-20190409004039-e6da0acd62b1
 	github.com/go-gl/mathgl v0.0.0-20190713194549-592312d8590a
@@ -1,9 +1,80 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/render/lazy"
+	"github.com/emily33901/go-forgery/settings"
+	"github.com/emily33901/go-forgery/valve"
+)
+
+// exportFromCommandLine exports a texture or material to pngs without opening a window
+func exportFromCommandLine(settingsPath string, profile string, texture string, material string, dir string, options formats.PngExportOptions) error {
+	s, err := settings.Load(settingsPath)
+	if err != nil {
+		return err
+	}
+
+	if profile != "" {
+		s.ActiveProfile = profile
+	}
+
+	config := s.Active()
+	if config == nil {
+		return fmt.Errorf("there is no profile called \"%s\"", s.ActiveProfile)
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	fs, err := valve.NewFileSystem(config.GameDir)
+	if err != nil {
+		return err
+	}
+
+	var written []string
+	if texture != "" {
+		written, err = lazy.ExportTexture(fs, texture, dir, options)
+	} else {
+		written, err = lazy.ExportMaterial(fs, material, dir, options)
+	}
+
+	for _, filename := range written {
+		fmt.Println(filename)
+	}
+
+	return err
+}
+
 func main() {
+	settingsPath := flag.String("settings", settings.DefaultPath, "path to the settings file")
+	profile := flag.String("profile", "", "name of the game configuration to use")
+
+	exportTexture := flag.String("export-texture", "", "export a texture (like brick/brickwall001a) to png and exit")
+	exportMaterial := flag.String("export-material", "", "export the base texture of a material to png and exit")
+	exportDir := flag.String("export-dir", ".", "directory that exported pngs are written to")
+	exportOptions := formats.PngExportOptions{}
+	flag.BoolVar(&exportOptions.AllFrames, "export-frames", false, "export every frame")
+	flag.BoolVar(&exportOptions.AllFaces, "export-faces", false, "export every face")
+	flag.BoolVar(&exportOptions.AllMips, "export-mips", false, "export every mip")
+	flag.BoolVar(&exportOptions.CompositeAlpha, "export-alpha", false, "bake how a material uses its alpha into the exported png")
+	flag.Parse()
+
+	if *exportTexture != "" || *exportMaterial != "" {
+		err := exportFromCommandLine(*settingsPath, *profile, *exportTexture, *exportMaterial, *exportDir, exportOptions)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	f := ForgeryContext{}
 
-	f.NewApp()
+	f.NewApp(*settingsPath, *profile)
 
 	f.Run()
 }
@@ -18,10 +18,16 @@ type Platform interface {
 	// IsKeyPressed returns if there is a key pressed
 	IsKeyPressed(c rune) bool
 	IsShiftPressed() bool
+	IsCtrlPressed() bool
 	KeyWentDown(c rune) bool
 	SetCursorDisabled(state bool)
 
 	FrameCount() int
 
+	// Clipboard returns the text on the system clipboard
+	Clipboard() (string, error)
+	// SetClipboard puts text on the system clipboard
+	SetClipboard(text string)
+
 	Dispose()
 }
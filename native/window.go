@@ -219,6 +219,10 @@ func (platform *GLFW) IsShiftPressed() bool {
 	return platform.keyPressedMap[rune(int(glfw.KeyLeftShift))] > 0 || platform.keyPressedMap[rune(int(glfw.KeyLeftShift))] > 0
 }
 
+func (platform *GLFW) IsCtrlPressed() bool {
+	return platform.keyPressedMap[rune(int(glfw.KeyLeftControl))] > 0 || platform.keyPressedMap[rune(int(glfw.KeyRightControl))] > 0
+}
+
 func (platform *GLFW) KeyWentDown(key rune) bool {
 	return platform.keyPressedMap[key] == 1
 }
@@ -234,3 +238,11 @@ func (platform *GLFW) SetCursorDisabled(state bool) {
 func (platform *GLFW) FrameCount() int {
 	return platform.frameCount
 }
+
+func (platform *GLFW) Clipboard() (string, error) {
+	return platform.window.GetClipboardString()
+}
+
+func (platform *GLFW) SetClipboard(text string) {
+	platform.window.SetClipboardString(text)
+}
@@ -60,6 +60,7 @@ type Adapter interface {
 	SendUniformVec2(uniform int32, float *float32)
 	SendUniformVec4(uniform int32, float *float32)
 	SendUniformBool(uniform int32, b bool)
+	SendUniformInt(uniform int32, i int32)
 
 	Error() bool
 }
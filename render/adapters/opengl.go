@@ -237,6 +237,10 @@ func (ogl *OpenGL) SendUniformBool(uniform int32, b bool) {
 	}
 }
 
+func (ogl *OpenGL) SendUniformInt(uniform int32, i int32) {
+	gl.Uniform1i(uniform, i)
+}
+
 func (ogl *OpenGL) Error() bool {
 	if err := gl.GetError(); err != 0 {
 		logger.Error("GL Error:%d", err)
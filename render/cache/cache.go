@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/emily33901/go-forgery/formats"
 	"github.com/emily33901/go-forgery/render/lazy"
 	"github.com/emily33901/gosigl"
 	"github.com/emily33901/imgui-go"
@@ -12,108 +13,338 @@ import (
 	"github.com/emily33901/lambda-core/core/loader/material"
 	"github.com/emily33901/lambda-core/core/logger"
 	material2 "github.com/emily33901/lambda-core/core/material"
-	"github.com/emily33901/lambda-core/core/resource"
 )
 
 var textureLookup map[string]gosigl.TextureBindingId
 var textureLookupMutex sync.RWMutex
 
+var materialListeners []*MaterialListener
+var materialListenersMutex sync.Mutex
+
+// MaterialListener collects the names of materials that have finished loading
+// until they are taken. A name is only kept once so nothing is ever dropped
+// no matter how many materials load before it is drained
+type MaterialListener struct {
+	mutex sync.Mutex
+	names map[string]struct{}
+}
+
+func NewMaterialListener() *MaterialListener {
+	return &MaterialListener{names: map[string]struct{}{}}
+}
+
+func (listener *MaterialListener) add(name string) {
+	listener.mutex.Lock()
+	listener.names[name] = struct{}{}
+	listener.mutex.Unlock()
+}
+
+// Take returns every material that has loaded since it was last called
+func (listener *MaterialListener) Take() []string {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+
+	if len(listener.names) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(listener.names))
+	for name := range listener.names {
+		names = append(names, name)
+	}
+	listener.names = map[string]struct{}{}
+
+	return names
+}
+
+// SubscribeMaterialLoaded registers a listener that will be given the name
+// of every material once it has finished loading
+func SubscribeMaterialLoaded(listener *MaterialListener) {
+	materialListenersMutex.Lock()
+	materialListeners = append(materialListeners, listener)
+	materialListenersMutex.Unlock()
+}
+
+// UnsubscribeMaterialLoaded removes a listener added with SubscribeMaterialLoaded
+func UnsubscribeMaterialLoaded(listener *MaterialListener) {
+	materialListenersMutex.Lock()
+	defer materialListenersMutex.Unlock()
+
+	for i, l := range materialListeners {
+		if l == listener {
+			materialListeners = append(materialListeners[:i], materialListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// NormaliseMaterialName converts a material name into the form that
+// is used as a key in the lookup tables (lazy.MaterialKey without the extension)
+func NormaliseMaterialName(name string) string {
+	return strings.TrimSuffix(lazy.MaterialKey(name), filesystem.ExtensionVmt)
+}
+
+func notifyMaterialLoaded(name string) {
+	name = NormaliseMaterialName(name)
+
+	materialListenersMutex.Lock()
+	for _, l := range materialListeners {
+		l.add(name)
+	}
+	materialListenersMutex.Unlock()
+}
+
 func createEntryForTexture(fs filesystem.IFileSystem, name string) {
-	name = strings.ToLower(name)
+	name = NormaliseMaterialName(name)
 
 	if _, found := LookupTextureNoLoad(name); found {
 		return
 	}
 
-	material.LoadSingleMaterial(name, fs)
+	loadMaterial(fs, name)
+	registerMaterialName(name)
+}
 
-	textureLookupMutex.Lock()
-	textureLookup[name] = 0
-	textureLookupMutex.Unlock()
+// preparedTexture is a material that has been read and decoded on a streaming worker
+// and only needs to be uploaded on the render thread
+type preparedTexture struct {
+	name    string
+	proxies *materialProxies
+
+	// vtf is nil for textures that do not come from a vtf (like the error texture)
+	vtf *formats.Vtf
+
+	format uint32
+	width  int
+	height int
+	data   []byte
 }
 
-func BindTexture(fs filesystem.IFileSystem, name string) gosigl.TextureBindingId {
-	realName := name
-	if !strings.HasSuffix(realName, ".vmt") {
-		realName += ".vmt"
-	}
+// prepareTexture does everything that binding a material needs apart from talking to GL.
+// It is safe to call from any goroutine
+func prepareTexture(fs filesystem.IFileSystem, name string) (prepared *preparedTexture) {
+	name = NormaliseMaterialName(name)
+	realName := lazy.MaterialKey(name)
+
+	loadLock.RLock()
+	defer loadLock.RUnlock()
 
-	baseMat := resource.Manager().Material(realName)
+	baseMat := lazy.Material(realName)
 	if baseMat == nil {
 		// Really try to make sure this is loaded first
 		baseMat = lazy.LoadSingleLazyMaterial(realName, fs)
 
 		if baseMat == nil {
 			// We have actually failed now so use the error texture
-			baseMat = resource.Manager().Material(resource.Manager().ErrorTextureName())
+			baseMat = lazy.ErrorMaterial()
 		}
 	}
 	mat := baseMat.(*material2.Material)
 
-	// Make sure this is loaded
-	if mat.Textures.Albedo.Reload() != nil {
+	prepared = &preparedTexture{
+		name:    name,
+		proxies: readMaterialProxies(fs, name),
+	}
+
+	// The vtf is read here rather than through the material so that
+	// materials that share a texture do not fight over its data
+	if lazyTex, ok := mat.Textures.Albedo.(*lazy.TextureLazy2D); ok {
+		stream, err := fs.GetFile(lazyTex.FilePath())
+		if err == nil {
+			var v *formats.Vtf
+			if v, err = formats.ReadVtf(stream); err == nil {
+				prepared.vtf = prepareVtfForUpload(v)
+				return prepared
+			}
+		}
+
 		// We actually failed to reload this textures data (amazing right?)
 		// So use the error material for this one
-		logger.Warn("Texture failed to reload... Make sure this isnt an error!")
-		baseMat = resource.Manager().Material(resource.Manager().ErrorTextureName())
+		logger.Warn("Texture failed to reload... Make sure this isnt an error! %s", err)
+		mat = lazy.ErrorMaterial().(*material2.Material)
 	}
 
-	mat = baseMat.(*material2.Material)
+	if mat.Textures.Albedo.Reload() != nil {
+		return nil
+	}
+
+	prepared.format = mat.Textures.Albedo.Format()
+	prepared.width = mat.Textures.Albedo.Width()
+	prepared.height = mat.Textures.Albedo.Height()
+	prepared.data = mat.Textures.Albedo.PixelDataForFrame(0)
+
+	return prepared
+}
 
-	newTex := gosigl.CreateTexture2D(
-		gosigl.TextureSlot(0),
-		mat.Textures.Albedo.Width(),
-		mat.Textures.Albedo.Height(),
-		mat.Textures.Albedo.PixelDataForFrame(0),
-		gosigl.PixelFormat(glTextureFormatFromVtfFormat(mat.Textures.Albedo.Format())),
-		false)
+// uploadPreparedTexture uploads a prepared material and replaces whatever was bound for it before
+func uploadPreparedTexture(prepared *preparedTexture) gosigl.TextureBindingId {
+	var newTex gosigl.TextureBindingId
+	var size int64
+
+	proxies := prepared.proxies
+	if prepared.vtf != nil {
+		newTex, size = createMippedTexture(prepared.vtf, 0)
+
+		// Every frame goes into an array texture so that animating is just picking a layer
+		if frames := prepared.vtf.Frames; frames > 1 {
+			if proxies == nil {
+				proxies = &materialProxies{vars: map[string]*proxyVar{}}
+			}
+			proxies.frames = frames
+
+			var arraySize int64
+			proxies.state.Animated, arraySize = createArrayTexture(prepared.vtf)
+			size += arraySize
+		}
+	} else {
+		newTex = createTexture(prepared.format, prepared.width, prepared.height, prepared.data)
+		size = int64(prepared.width * prepared.height * 4)
+	}
 
 	textureLookupMutex.Lock()
-	textureLookup[name] = newTex
+	old := textureLookup[prepared.name]
+	textureLookup[prepared.name] = newTex
 	textureLookupMutex.Unlock()
 
-	mat.EvictTextures()
+	if old != 0 {
+		gosigl.DeleteTextures(old)
+	}
+
+	setMaterialProxies(prepared.name, proxies)
+	trackTexture(prepared.name, size)
 
-	logger.Notice("Bound texture %s", name)
+	logger.Notice("Bound texture %s", prepared.name)
+
+	notifyMaterialLoaded(prepared.name)
 
 	return newTex
 }
 
+// BindTexture loads and uploads a material straight away on the calling thread.
+// StreamTexture should be used instead wherever the hitch would be noticed
+func BindTexture(fs filesystem.IFileSystem, name string) gosigl.TextureBindingId {
+	prepared := prepareTexture(fs, name)
+	if prepared == nil {
+		return 0
+	}
+
+	return uploadPreparedTexture(prepared)
+}
+
+// ReloadMaterial throws away everything that was loaded for a material and
+// then loads and binds it again from the filesystem
+func ReloadMaterial(fs filesystem.IFileSystem, name string) {
+	name = NormaliseMaterialName(name)
+
+	loadLock.Lock()
+	lazy.UnloadMaterial(name)
+	loadLock.Unlock()
+
+	failedMaterials.Delete(name)
+	dropThumbnail(name)
+
+	// The old texture is drawn until the new one arrives
+	restreamTexture(fs, name)
+}
+
+// RebindTextures uploads every texture that is bound again
+// so that a change to the texture quality takes effect
+func RebindTextures(fs filesystem.IFileSystem) {
+	textureLookupMutex.Lock()
+	bound := make([]string, 0)
+	for name, tex := range textureLookup {
+		if tex != 0 {
+			bound = append(bound, name)
+		}
+	}
+	textureLookupMutex.Unlock()
+
+	for _, name := range bound {
+		restreamTexture(fs, name)
+	}
+}
+
+// ReloadFile reloads whatever materials depend on a file that has changed
+// Returns the names of the materials that were reloaded
+func ReloadFile(fs filesystem.IFileSystem, path string) []string {
+	path = strings.ToLower(filesystem.NormalisePath(path))
+	if !strings.HasPrefix(path, "materials/") {
+		return nil
+	}
+
+	materials := make([]string, 0)
+
+	switch {
+	case strings.HasSuffix(path, ".vmt"):
+		materials = append(materials, NormaliseMaterialName(path))
+		refreshMaterialInfo(fs, NormaliseMaterialName(path))
+	case strings.HasSuffix(path, ".vtf"):
+		loadLock.Lock()
+		for _, m := range lazy.MaterialsUsingTexture(path) {
+			materials = append(materials, NormaliseMaterialName(m))
+		}
+		loadLock.Unlock()
+	}
+
+	for _, m := range materials {
+		logger.Notice("Reloading %s", m)
+		ReloadMaterial(fs, m)
+	}
+
+	return materials
+}
+
+// CreateTextureFromVtf uploads the first frame of a vtf that is not part of a material
+// The caller owns the texture and should delete it when it is done
+func CreateTextureFromVtf(v *formats.Vtf) gosigl.TextureBindingId {
+	return createTexture(v.Format(), v.Width(), v.Height(), v.Image(0, 0, 0))
+}
+
 // OglToImguiTextureId converts a texture that is represented by ogl
 // to one that can be presented by imgui
 func OglToImguiTextureId(id uint32) imgui.TextureID {
 	return imgui.TextureID(uint64(id) | (1 << 32))
 }
 
-// LookupTexture tries to get an individual texture or
-// Loads it if necessary
+// LookupTexture tries to get an individual texture or starts streaming it in
+// if necessary. The placeholder texture is returned until it arrives
 func LookupTexture(fs filesystem.IFileSystem, name string) gosigl.TextureBindingId {
-	name = strings.ToLower(name)
+	name = NormaliseMaterialName(name)
 
 	if texId, found := LookupTextureNoLoad(name); found && texId != 0 {
 		return texId
-	} else if found {
-		// texId was 0 so bind it now
-		createEntryForTexture(fs, name)
 	}
 
-	return BindTexture(fs, name)
+	StreamTexture(fs, name)
+
+	return placeholderTexture()
 }
 
 // LookupTextureNoLoad tries to get a texture but doesnt load one if it doesnt already exist
 // Returns nil if the texture hasnt been loaded yet
 func LookupTextureNoLoad(name string) (gosigl.TextureBindingId, bool) {
-	name = strings.ToLower(name)
+	name = NormaliseMaterialName(name)
 
 	textureLookupMutex.Lock()
 	tex, ok := textureLookup[name]
 	textureLookupMutex.Unlock()
 
-	if ok == true && tex == 0 {
-		logger.Warn("Texture %s is not bound yet...", name)
+	if tex == 0 {
+		// Textures that are on their way are drawn with the placeholder
+		if isStreaming(name) || (ok && requestRestream(name)) {
+			return placeholderTexture(), true
+		}
+
+		if ok {
+			logger.Warn("Texture %s is not bound yet...", name)
+		}
 		return 0, false
 	}
 
+	if ok {
+		markTextureUsed(name)
+	}
+
 	return tex, ok
 }
 
@@ -133,77 +364,33 @@ func GetMaterials() []string {
 	return materials
 }
 
-// getGLTextureFormat swap vtf format to openGL format
-func glTextureFormatFromVtfFormat(vtfFormat uint32) gosigl.PixelFormat {
-	switch vtfFormat {
-	case 0:
-		return gosigl.RGBA
-	case 2:
-		return gosigl.RGB
-	case 3:
-		return gosigl.BGR
-	case 12:
-		return gosigl.BGRA
-	case 13:
-		return gosigl.DXT1
-	case 14:
-		return gosigl.DXT3
-	case 15:
-		return gosigl.DXT5
-	default:
-		return gosigl.RGB
-	}
-}
-
 func InitTextureLookup() {
 	textureLookup = make(map[string]gosigl.TextureBindingId)
 }
 
-func LoadAllKnownMaterials(fs filesystem.IFileSystem, texDone chan struct{}) int {
+// PreloadMaterials loads a set of materials (usually the ones in the open map)
+// in parallel. Each one sends on the returned channel once it has loaded
+func PreloadMaterials(fs filesystem.IFileSystem, names []string) (chan struct{}, int) {
 	// Ensure error texture is loaded
 	material.LoadErrorMaterial()
 
-	// First get all the materials
-	// TODO: these shouldn't fail
-	// BUT THEY DO!
-	materials := make([]string, 0, 2048)
-	for _, x := range fs.AllPaths() {
-		if strings.Index(x, "materials/") != -1 {
-			if strings.Index(x, ".vmt") != -1 {
-				if x == "materials/models/player/custom_player/econ/head/ctm_fbi/ctm_fbi_v2_head_varianta.vmt" ||
-					x == "materials/models/player/custom_player/econ/head/tm_leet/tm_leet_v2_head_variantc.vmt" {
-					continue
-				}
-				materials = append(materials, x[len("materials/"):len(x)-len(".vmt")])
-			}
-		}
-	}
-
-	// Then chunk that array up
-	const chunkCount = 8
-	chunkSize := len(materials) / chunkCount
-	chunks := make([][]string, 0, chunkCount)
-
-	for i := 0; i < len(materials); i += chunkSize {
-		end := i + chunkSize
-
-		if end > len(materials) {
-			end = len(materials)
-		}
-
-		chunks = append(chunks, materials[i:end])
+	texDone := make(chan struct{}, len(names))
+	work := make(chan string, len(names))
+	for _, name := range names {
+		work <- NormaliseMaterialName(name)
 	}
+	close(work)
 
-	// Now parallel lazy load all the textures
-	for _, x := range chunks {
-		go func(materials []string) {
-			for _, m := range materials {
-				createEntryForTexture(fs, m)
+	const workerCount = 8
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			for name := range work {
+				createEntryForTexture(fs, name)
 				texDone <- struct{}{}
 			}
-		}(x)
+		}()
 	}
-	logger.Notice("Preloading %d textures...", len(materials))
+	logger.Notice("Preloading %d materials...", len(names))
 
-	return len(materials)
+	return texDone, len(names)
 }
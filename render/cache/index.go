@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/emily33901/go-forgery/render/lazy"
+	"github.com/emily33901/go-forgery/valve"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// DefaultMaterialIndexPath is the name of the material index file
+const DefaultMaterialIndexPath = "materialindex.json"
+
+// materialIndexVersion is bumped whenever the layout of the index changes
+const materialIndexVersion = 4
+
+// indexSource is the materials in a vpk at the time that it was indexed
+type indexSource struct {
+	Path      string
+	ModTime   int64
+	Size      int64
+	Materials []*MaterialInfo
+}
+
+type materialIndexFile struct {
+	Version int
+	Sources []*indexSource
+}
+
+// loadLock stops materials from being loaded while they are being reloaded.
+// Loaders hold it for reading and reloads hold it for writing
+var loadLock sync.RWMutex
+
+// failedMaterials are materials that have been loaded but did not exist or did not parse.
+// They are not loaded or streamed again until they are reloaded
+var failedMaterials sync.Map
+
+var activeIndexer *Indexer
+var activeIndexerMutex sync.Mutex
+
+// Indexer finds all the materials in a filesystem in the background and
+// then makes thumbnails for materials as they are asked for
+type Indexer struct {
+	fs           *valve.FileSystem
+	path         string
+	thumbnailDir string
+	requests     chan string
+	cancel       chan struct{}
+	done         chan struct{}
+
+	indexed int32
+}
+
+// loadMaterial loads a material without binding it. Broken materials can
+// panic inside of the loader so they are recorded as failed instead
+func loadMaterial(fs filesystem.IFileSystem, name string) {
+	name = NormaliseMaterialName(name)
+	if isMaterialFailed(name) {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warn("Unable to load material %s: %v", name, r)
+			failedMaterials.Store(name, struct{}{})
+		}
+	}()
+
+	loadLock.RLock()
+	defer loadLock.RUnlock()
+
+	if lazy.LoadSingleLazyMaterial(name, fs) == nil || !isMaterialLoaded(name) {
+		failedMaterials.Store(name, struct{}{})
+	}
+
+	notifyMaterialLoaded(name)
+}
+
+func isMaterialLoaded(name string) bool {
+	return lazy.HasMaterial(lazy.MaterialKey(name))
+}
+
+func isMaterialFailed(name string) bool {
+	_, failed := failedMaterials.Load(NormaliseMaterialName(name))
+	return failed
+}
+
+// registerMaterialName makes a material show up in the lookup table without loading it
+func registerMaterialName(name string) {
+	textureLookupMutex.Lock()
+	if _, ok := textureLookup[name]; !ok {
+		textureLookup[name] = 0
+	}
+	textureLookupMutex.Unlock()
+}
+
+func readMaterialIndex(path string) *materialIndexFile {
+	index := &materialIndexFile{Version: materialIndexVersion}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return index
+	}
+
+	cached := &materialIndexFile{}
+	if err := json.Unmarshal(data, cached); err != nil || cached.Version != materialIndexVersion {
+		logger.Warn("Ignoring material index %s", path)
+		return index
+	}
+
+	return cached
+}
+
+// materialsInMount reads the info for all the materials in a mount.
+// Returns nil if the indexer was cancelled part way through
+func (indexer *Indexer) materialsInMount(m valve.Mount) []*MaterialInfo {
+	materials := make([]*MaterialInfo, 0)
+
+	for i, f := range m.Files() {
+		lower := strings.ToLower(f)
+		if !strings.HasPrefix(lower, "materials/") || !strings.HasSuffix(lower, ".vmt") {
+			continue
+		}
+
+		// Big vpks take a while so keep making thumbnails in between
+		if i%256 == 0 {
+			if indexer.cancelled() {
+				return nil
+			}
+			indexer.servePriority()
+		}
+
+		name := NormaliseMaterialName(lower)
+		stream, err := m.Open(f)
+		if err != nil {
+			materials = append(materials, &MaterialInfo{Name: name})
+			continue
+		}
+
+		materials = append(materials, readMaterialInfo(indexer.fs, stream, name))
+	}
+
+	return materials
+}
+
+// StartIndexing starts indexing the materials in fs in the background.
+// Vpks that have not changed since they were last indexed are read from indexPath
+// and thumbnails are cached in thumbnailDir.
+// Any indexer that was already running is cancelled
+func StartIndexing(fs *valve.FileSystem, indexPath string, thumbnailDir string) *Indexer {
+	indexer := &Indexer{
+		fs:           fs,
+		path:         indexPath,
+		thumbnailDir: thumbnailDir,
+		requests:     make(chan string, 1024),
+		cancel:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	// Thumbnails from the last filesystem are no use any more
+	for name := range thumbnailLookup {
+		dropThumbnail(name)
+	}
+	thumbnailRequested = map[string]bool{}
+
+	activeIndexerMutex.Lock()
+	old := activeIndexer
+	activeIndexer = indexer
+	activeIndexerMutex.Unlock()
+
+	if old != nil {
+		old.Cancel()
+	}
+	clearMaterialInfo()
+
+	go indexer.run()
+
+	return indexer
+}
+
+// requestThumbnail asks the indexer to make a thumbnail ahead of anything else.
+// Returns false if the request could not be queued
+func requestThumbnail(name string) bool {
+	activeIndexerMutex.Lock()
+	indexer := activeIndexer
+	activeIndexerMutex.Unlock()
+
+	if indexer == nil {
+		return false
+	}
+
+	select {
+	case indexer.requests <- name:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel stops the indexer and waits for it to finish
+func (indexer *Indexer) Cancel() {
+	select {
+	case <-indexer.cancel:
+	default:
+		close(indexer.cancel)
+	}
+
+	<-indexer.done
+}
+
+// Indexed returns how many materials have been found so far
+func (indexer *Indexer) Indexed() int {
+	return int(atomic.LoadInt32(&indexer.indexed))
+}
+
+func (indexer *Indexer) cancelled() bool {
+	select {
+	case <-indexer.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+func (indexer *Indexer) index() {
+	cached := readMaterialIndex(indexer.path)
+	updated := &materialIndexFile{Version: materialIndexVersion}
+	mounted := map[string]bool{}
+
+	for _, m := range indexer.fs.Mounts() {
+		if indexer.cancelled() {
+			return
+		}
+
+		indexer.servePriority()
+
+		var materials []*MaterialInfo
+
+		if m.Vpk {
+			mounted[m.Path] = true
+
+			info, err := os.Stat(m.Path)
+			if err != nil {
+				continue
+			}
+
+			for _, source := range cached.Sources {
+				if source.Path == m.Path && source.ModTime == info.ModTime().UnixNano() && source.Size == info.Size() {
+					materials = source.Materials
+					break
+				}
+			}
+
+			if materials == nil {
+				materials = indexer.materialsInMount(m)
+				if materials == nil {
+					return
+				}
+			}
+
+			updated.Sources = append(updated.Sources, &indexSource{
+				Path:      m.Path,
+				ModTime:   info.ModTime().UnixNano(),
+				Size:      info.Size(),
+				Materials: materials,
+			})
+		} else {
+			// Loose files change too often to be worth caching
+			materials = indexer.materialsInMount(m)
+			if materials == nil {
+				return
+			}
+		}
+
+		for _, info := range materials {
+			// Mounts are in priority order so the first one to provide a material wins
+			materialInfo.LoadOrStore(info.Name, info)
+			registerMaterialName(info.Name)
+		}
+		atomic.AddInt32(&indexer.indexed, int32(len(materials)))
+	}
+
+	// Keep vpks from other games that share the same index
+	for _, source := range cached.Sources {
+		if !mounted[source.Path] {
+			updated.Sources = append(updated.Sources, source)
+		}
+	}
+
+	data, err := json.Marshal(updated)
+	if err == nil {
+		err = ioutil.WriteFile(indexer.path, data, 0644)
+	}
+	if err != nil {
+		logger.Warn("Unable to save material index %s: %s", indexer.path, err)
+	}
+
+	logger.Notice("Indexed %d materials", indexer.Indexed())
+}
+
+// serve makes a thumbnail that has been asked for
+func (indexer *Indexer) serve(name string) {
+	t, err := makeThumbnail(indexer.fs, indexer.thumbnailDir, name)
+	if err != nil {
+		// An empty thumbnail stops it from being asked for again
+		t = &thumbnail{name: name}
+	}
+
+	select {
+	case thumbnailsReady <- t:
+	case <-indexer.cancel:
+	}
+}
+
+// servePriority makes anything that has been asked for while indexing is still going
+func (indexer *Indexer) servePriority() {
+	for {
+		select {
+		case name := <-indexer.requests:
+			indexer.serve(name)
+		default:
+			return
+		}
+	}
+}
+
+func (indexer *Indexer) run() {
+	defer close(indexer.done)
+
+	indexer.index()
+
+	// After indexing materials are only loaded when something asks for them
+	for {
+		select {
+		case <-indexer.cancel:
+			return
+		case name := <-indexer.requests:
+			indexer.serve(name)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/valve"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// MaterialInfo is what the indexer finds out about a material without loading it
+type MaterialInfo struct {
+	Name        string
+	Shader      string
+	SurfaceProp string
+	Keywords    []string
+
+	// Flags are from the %compile keywords of the material
+	Flags formats.SurfaceFlags
+}
+
+// MaterialDetails is what the material browser shows about the selected material
+type MaterialDetails struct {
+	// Source is the mount that the vmt is loaded from
+	Source      string
+	BaseTexture string
+
+	Width  int
+	Height int
+	Format string
+}
+
+var materialInfo sync.Map
+
+// LookupMaterialInfo returns what is known about a material
+// or nil if it has not been indexed yet
+func LookupMaterialInfo(name string) *MaterialInfo {
+	if info, ok := materialInfo.Load(NormaliseMaterialName(name)); ok {
+		return info.(*MaterialInfo)
+	}
+
+	return nil
+}
+
+// LookupSurfaceFlags returns the surface flags of a material. Materials that
+// have not been indexed yet are guessed from their name
+func LookupSurfaceFlags(name string) formats.SurfaceFlags {
+	if info := LookupMaterialInfo(name); info != nil {
+		return info.Flags
+	}
+
+	return formats.MaterialSurfaceFlags(name)
+}
+
+func clearMaterialInfo() {
+	materialInfo.Range(func(key, value interface{}) bool {
+		materialInfo.Delete(key)
+		return true
+	})
+}
+
+// findMaterialParameter looks through a vmt and any blocks inside of it for a parameter
+func findMaterialParameter(kv *keyvalues.KeyValue, key string) string {
+	children, _ := kv.Children()
+
+	for _, child := range children {
+		if child.HasChildren() {
+			if found := findMaterialParameter(child, key); found != "" {
+				return found
+			}
+		} else if strings.ToLower(child.Key()) == key {
+			return strings.TrimSpace(formats.KeyValueString(child))
+		}
+	}
+
+	return ""
+}
+
+// readMaterialInfo reads the parts of a vmt that the material browser filters on.
+// Materials that do not parse still get an entry so that they can be found
+func readMaterialInfo(fs filesystem.IFileSystem, stream io.Reader, name string) *MaterialInfo {
+	info := &MaterialInfo{Name: name, Flags: formats.MaterialSurfaceFlags(name)}
+
+	kv, err := formats.ReadKeyValuesFromReader(stream)
+	if err != nil {
+		return info
+	}
+
+	// Patches that cannot be resolved are still listed with what they have
+	if resolved, err := formats.ResolveVmt(kv, fs); err == nil {
+		kv = resolved
+	}
+
+	// The root block is named after the shader. Files that have no
+	// single root block are given a placeholder root instead
+	if shader := strings.ToLower(kv.Key()); shader != "$root" {
+		info.Shader = shader
+	}
+
+	info.SurfaceProp = strings.ToLower(findMaterialParameter(kv, "$surfaceprop"))
+
+	info.Flags = formats.VmtSurfaceFlags(kv)
+	if strings.HasPrefix(name, "tools/") {
+		info.Flags |= formats.SurfaceTool
+	}
+
+	for _, keyword := range strings.Split(findMaterialParameter(kv, "%keywords"), ",") {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" {
+			info.Keywords = append(info.Keywords, keyword)
+		}
+	}
+
+	return info
+}
+
+// refreshMaterialInfo reads the info for a material again after it has changed on disk
+func refreshMaterialInfo(fs filesystem.IFileSystem, name string) {
+	stream, err := fs.GetFile(filesystem.BasePathMaterial + name + filesystem.ExtensionVmt)
+	if err != nil {
+		materialInfo.Delete(name)
+		return
+	}
+
+	materialInfo.Store(name, readMaterialInfo(fs, stream, name))
+
+	// New materials need to show up in the browser too
+	registerMaterialName(name)
+}
+
+// ReadMaterialDetails finds out where a material comes from and what its base texture is like
+func ReadMaterialDetails(fs *valve.FileSystem, name string) (*MaterialDetails, error) {
+	name = NormaliseMaterialName(name)
+	vmtPath := filesystem.BasePathMaterial + name + filesystem.ExtensionVmt
+
+	sources := fs.Sources(vmtPath)
+	if len(sources) == 0 {
+		return nil, errors.New("material does not exist")
+	}
+
+	details := &MaterialDetails{Source: sources[0].String()}
+
+	stream, err := sources[0].Open(vmtPath)
+	if err != nil {
+		return details, err
+	}
+
+	kv, err := formats.ReadKeyValuesFromReader(stream)
+	if err == nil {
+		kv, err = formats.ResolveVmt(kv, fs)
+	}
+	if err != nil {
+		return details, fmt.Errorf("unable to read %s: %s", vmtPath, err)
+	}
+
+	baseTexture := findMaterialParameter(kv, "$basetexture")
+	if baseTexture == "" {
+		return details, nil
+	}
+
+	details.BaseTexture = strings.ToLower(filesystem.NormalisePath(baseTexture))
+	details.BaseTexture = filesystem.BasePathMaterial + strings.TrimSuffix(details.BaseTexture, filesystem.ExtensionVtf) + filesystem.ExtensionVtf
+
+	stream, err = fs.GetFile(details.BaseTexture)
+	if err != nil {
+		return details, err
+	}
+
+	v, err := formats.ReadVtf(stream)
+	if err != nil {
+		return details, fmt.Errorf("unable to read %s: %s", details.BaseTexture, err)
+	}
+
+	details.Width = v.Width()
+	details.Height = v.Height()
+	details.Format = formats.VtfFormatName(v.Format())
+
+	return details, nil
+}
@@ -0,0 +1,580 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/logger"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// MaterialState is how the base texture of a material should be drawn this frame
+type MaterialState struct {
+	// Animated is an array texture with every frame of the base texture
+	// or 0 if the base texture only has one frame
+	Animated gosigl.TextureBindingId
+	Frame    float32
+
+	// TransformS and TransformT are the rows of the base texture transform
+	TransformS [3]float32
+	TransformT [3]float32
+
+	Tint [4]float32
+}
+
+var defaultMaterialState = MaterialState{
+	TransformS: [3]float32{1, 0, 0},
+	TransformT: [3]float32{0, 1, 0},
+	Tint:       [4]float32{1, 1, 1, 1},
+}
+
+// proxyVar is a material parameter that proxies can read and write
+type proxyVar struct {
+	value []float64
+
+	// Matrices are 2x3 texture transforms stored row by row
+	matrix bool
+}
+
+// materialProxy changes material parameters every frame
+type materialProxy interface {
+	update(m *materialProxies, now float64)
+}
+
+// materialProxies are the parameters and proxies of a material that is bound
+type materialProxies struct {
+	state MaterialState
+
+	// frames is how many frames the base texture has
+	frames int
+
+	vars    map[string]*proxyVar
+	proxies []materialProxy
+}
+
+var proxyLookup = map[string]*materialProxies{}
+var proxyLookupMutex sync.Mutex
+
+// proxyStart is when proxy time starts from
+var proxyStart = time.Now()
+
+// splitVarName splits a parameter like $color[1] into its name and component.
+// The component is -1 when the whole parameter is used
+func splitVarName(name string) (string, int) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	open := strings.Index(name, "[")
+	if open < 0 || !strings.HasSuffix(name, "]") {
+		return name, -1
+	}
+
+	component, err := strconv.Atoi(name[open+1 : len(name)-1])
+	if err != nil || component < 0 {
+		return name, -1
+	}
+
+	return name[:open], component
+}
+
+// parseFloats reads numbers separated by spaces
+func parseFloats(fields []string) ([]float64, bool) {
+	values := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+
+	return values, true
+}
+
+// buildTextureTransform makes a texture transform in the same way as Source:
+// scale and rotate around the center and then translate
+func buildTextureTransform(center [2]float64, scale [2]float64, rotate float64, translate [2]float64) []float64 {
+	sin, cos := math.Sincos(rotate * math.Pi / 180)
+
+	m := []float64{
+		cos * scale[0], -sin * scale[1], 0,
+		sin * scale[0], cos * scale[1], 0,
+	}
+	m[2] = center[0] + translate[0] - (m[0]*center[0] + m[1]*center[1])
+	m[5] = center[1] + translate[1] - (m[3]*center[0] + m[4]*center[1])
+
+	return m
+}
+
+// parseTextureTransform reads a transform like "center .5 .5 scale 1 1 rotate 0 translate 0 0"
+func parseTextureTransform(fields []string) (*proxyVar, bool) {
+	center := [2]float64{0.5, 0.5}
+	scale := [2]float64{1, 1}
+	translate := [2]float64{0, 0}
+	rotate := 0.0
+
+	for i := 0; i < len(fields); {
+		count := 2
+		if fields[i] == "rotate" {
+			count = 1
+		}
+		if i+count >= len(fields) {
+			return nil, false
+		}
+
+		values, ok := parseFloats(fields[i+1 : i+1+count])
+		if !ok {
+			return nil, false
+		}
+
+		switch fields[i] {
+		case "center":
+			center = [2]float64{values[0], values[1]}
+		case "scale":
+			scale = [2]float64{values[0], values[1]}
+		case "translate":
+			translate = [2]float64{values[0], values[1]}
+		case "rotate":
+			rotate = values[0]
+		default:
+			return nil, false
+		}
+
+		i += count + 1
+	}
+
+	return &proxyVar{value: buildTextureTransform(center, scale, rotate, translate), matrix: true}, true
+}
+
+// parseProxyVar reads a material parameter.
+// Returns nil for parameters that are not numbers (like texture names)
+func parseProxyVar(value string) *proxyVar {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return nil
+	}
+
+	switch value[0] {
+	case '[', '{':
+		fields := strings.Fields(strings.Trim(value, "[]{}"))
+		values, ok := parseFloats(fields)
+		if !ok || len(values) == 0 {
+			return nil
+		}
+
+		// Colours in braces are 0-255
+		if value[0] == '{' {
+			for i := range values {
+				values[i] /= 255
+			}
+		}
+
+		return &proxyVar{value: values}
+	}
+
+	fields := strings.Fields(value)
+	switch fields[0] {
+	case "center", "scale", "rotate", "translate":
+		if v, ok := parseTextureTransform(fields); ok {
+			return v
+		}
+		return nil
+	}
+
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return &proxyVar{value: []float64{v}}
+	}
+
+	return nil
+}
+
+// get returns the value of a parameter or a single component of it
+func (m *materialProxies) get(name string) []float64 {
+	name, component := splitVarName(name)
+
+	v, ok := m.vars[name]
+	if !ok {
+		return nil
+	}
+	if component < 0 {
+		return v.value
+	}
+	if component < len(v.value) && !v.matrix {
+		return v.value[component : component+1]
+	}
+
+	return nil
+}
+
+// float returns the first component of a parameter
+func (m *materialProxies) float(name string, fallback float64) float64 {
+	if v := m.get(name); len(v) > 0 {
+		return v[0]
+	}
+
+	return fallback
+}
+
+// input reads a proxy parameter that is either a number or the name of a material parameter
+func (m *materialProxies) input(value string, fallback float64) float64 {
+	if strings.HasPrefix(value, "$") {
+		return m.float(value, fallback)
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v
+	}
+
+	return fallback
+}
+
+// set writes a value to a parameter or a single component of it
+func (m *materialProxies) set(name string, value float64) {
+	name, component := splitVarName(name)
+	if name == "" {
+		return
+	}
+
+	v, ok := m.vars[name]
+	if !ok || v.matrix {
+		v = &proxyVar{}
+		m.vars[name] = v
+	}
+
+	if component < 0 {
+		// Vectors get the value in every component
+		if len(v.value) == 0 {
+			v.value = []float64{value}
+		}
+		for i := range v.value {
+			v.value[i] = value
+		}
+		return
+	}
+
+	for len(v.value) <= component {
+		v.value = append(v.value, 0)
+	}
+	v.value[component] = value
+}
+
+// setVar replaces a parameter
+func (m *materialProxies) setVar(name string, v *proxyVar) {
+	name, _ = splitVarName(name)
+	if name != "" {
+		m.vars[name] = v
+	}
+}
+
+type animatedTextureProxy struct {
+	frameVar string
+	rate     string
+	noWrap   bool
+}
+
+func (p *animatedTextureProxy) update(m *materialProxies, now float64) {
+	if m.frames < 2 {
+		return
+	}
+
+	frame := int(now * m.input(p.rate, 15))
+	if p.noWrap {
+		if frame > m.frames-1 {
+			frame = m.frames - 1
+		}
+	} else {
+		frame %= m.frames
+	}
+
+	m.set(p.frameVar, float64(frame))
+}
+
+type textureScrollProxy struct {
+	resultVar string
+	rate      string
+	angle     string
+	scale     string
+}
+
+func (p *textureScrollProxy) update(m *materialProxies, now float64) {
+	rate := m.input(p.rate, 1)
+	sin, cos := math.Sincos(m.input(p.angle, 0) * math.Pi / 180)
+
+	s := math.Mod(now*cos*rate, 1)
+	t := math.Mod(now*sin*rate, 1)
+
+	name, _ := splitVarName(p.resultVar)
+	if v, ok := m.vars[name]; ok && !v.matrix {
+		m.setVar(name, &proxyVar{value: []float64{s, t}})
+		return
+	}
+
+	scale := m.input(p.scale, 1)
+	m.setVar(name, &proxyVar{value: []float64{scale, 0, s, 0, scale, t}, matrix: true})
+}
+
+type sineProxy struct {
+	resultVar string
+	period    string
+	min       string
+	max       string
+	offset    string
+}
+
+func (p *sineProxy) update(m *materialProxies, now float64) {
+	period := m.input(p.period, 1)
+	if period == 0 {
+		period = 1
+	}
+	min := m.input(p.min, 0)
+	max := m.input(p.max, 1)
+
+	value := (max-min)*(math.Sin(2*math.Pi*(now-m.input(p.offset, 0))/period)*0.5+0.5) + min
+	m.set(p.resultVar, value)
+}
+
+type linearRampProxy struct {
+	resultVar    string
+	rate         string
+	initialValue string
+}
+
+func (p *linearRampProxy) update(m *materialProxies, now float64) {
+	m.set(p.resultVar, m.input(p.rate, 1)*now+m.input(p.initialValue, 0))
+}
+
+type textureTransformProxy struct {
+	resultVar    string
+	centerVar    string
+	scaleVar     string
+	rotateVar    string
+	translateVar string
+}
+
+// vector2 reads a parameter as two components, scalars are used for both
+func (m *materialProxies) vector2(name string, fallback float64) [2]float64 {
+	v := m.get(name)
+	switch {
+	case len(v) == 0:
+		return [2]float64{fallback, fallback}
+	case len(v) == 1:
+		return [2]float64{v[0], v[0]}
+	}
+
+	return [2]float64{v[0], v[1]}
+}
+
+func (p *textureTransformProxy) update(m *materialProxies, now float64) {
+	transform := buildTextureTransform(
+		m.vector2(p.centerVar, 0.5),
+		m.vector2(p.scaleVar, 1),
+		m.float(p.rotateVar, 0),
+		m.vector2(p.translateVar, 0))
+
+	m.setVar(p.resultVar, &proxyVar{value: transform, matrix: true})
+}
+
+// readProxy reads a single proxy block.
+// Returns nil for proxies that are not evaluated
+func readProxy(kv *keyvalues.KeyValue) materialProxy {
+	params := map[string]string{}
+	children, _ := kv.Children()
+	for _, child := range children {
+		params[strings.ToLower(child.Key())] = strings.ToLower(strings.TrimSpace(formats.KeyValueString(child)))
+	}
+
+	switch strings.ToLower(kv.Key()) {
+	case "animatedtexture":
+		// Only the base texture is drawn so nothing else can be animated
+		if textureVar := params["animatedtexturevar"]; textureVar != "" && textureVar != "$basetexture" {
+			return nil
+		}
+
+		frameVar := params["animatedtextureframenumvar"]
+		if frameVar == "" {
+			frameVar = "$frame"
+		}
+
+		return &animatedTextureProxy{
+			frameVar: frameVar,
+			rate:     params["animatedtextureframerate"],
+			noWrap:   params["animationnowrap"] == "1",
+		}
+	case "texturescroll":
+		return &textureScrollProxy{
+			resultVar: params["texturescrollvar"],
+			rate:      params["texturescrollrate"],
+			angle:     params["texturescrollangle"],
+			scale:     params["texturescale"],
+		}
+	case "sine":
+		return &sineProxy{
+			resultVar: params["resultvar"],
+			period:    params["sineperiod"],
+			min:       params["sinemin"],
+			max:       params["sinemax"],
+			offset:    params["timeoffset"],
+		}
+	case "linearramp":
+		return &linearRampProxy{
+			resultVar:    params["resultvar"],
+			rate:         params["rate"],
+			initialValue: params["initialvalue"],
+		}
+	case "texturetransform":
+		return &textureTransformProxy{
+			resultVar:    params["resultvar"],
+			centerVar:    params["centervar"],
+			scaleVar:     params["scalevar"],
+			rotateVar:    params["rotatevar"],
+			translateVar: params["translatevar"],
+		}
+	}
+
+	return nil
+}
+
+// readMaterialProxies reads the parameters and proxies of a vmt.
+// Returns nil for materials that are drawn as they are
+func readMaterialProxies(fs filesystem.IFileSystem, name string) *materialProxies {
+	kv, err := formats.ReadVmt(filesystem.BasePathMaterial+name+filesystem.ExtensionVmt, fs)
+	if err != nil {
+		return nil
+	}
+
+	m := &materialProxies{vars: map[string]*proxyVar{}}
+	hasProxies := false
+
+	children, _ := kv.Children()
+	for _, child := range children {
+		key := strings.ToLower(child.Key())
+
+		if child.HasChildren() {
+			if key != "proxies" {
+				continue
+			}
+
+			hasProxies = true
+			proxies, _ := child.Children()
+			for _, p := range proxies {
+				if proxy := readProxy(p); proxy != nil {
+					m.proxies = append(m.proxies, proxy)
+				} else {
+					logger.Warn("Proxy %s in %s is not supported", p.Key(), name)
+				}
+			}
+			continue
+		}
+
+		if v := parseProxyVar(formats.KeyValueString(child)); v != nil {
+			m.vars[key] = v
+		}
+	}
+
+	if !hasProxies && m.vars["$basetexturetransform"] == nil {
+		return nil
+	}
+
+	return m
+}
+
+// updateState works out how the material is drawn from its parameters
+func (m *materialProxies) updateState() {
+	m.state.TransformS = defaultMaterialState.TransformS
+	m.state.TransformT = defaultMaterialState.TransformT
+	if v, ok := m.vars["$basetexturetransform"]; ok && v.matrix {
+		for i := 0; i < 3; i++ {
+			m.state.TransformS[i] = float32(v.value[i])
+			m.state.TransformT[i] = float32(v.value[i+3])
+		}
+	}
+
+	frame := int(m.float("$frame", 0))
+	if frame < 0 || frame >= m.frames {
+		frame = 0
+	}
+	m.state.Frame = float32(frame)
+
+	m.state.Tint = defaultMaterialState.Tint
+	colour := m.get("$color")
+	for i := 0; i < 3; i++ {
+		switch {
+		case len(colour) == 1:
+			m.state.Tint[i] = float32(colour[0])
+		case i < len(colour):
+			m.state.Tint[i] = float32(colour[i])
+		}
+	}
+	m.state.Tint[3] = float32(m.float("$alpha", 1))
+}
+
+func (m *materialProxies) evaluate(now float64) {
+	for _, p := range m.proxies {
+		p.update(m, now)
+	}
+
+	m.updateState()
+}
+
+// setMaterialProxies replaces the proxies of a material
+// and deletes the animated texture that it had before
+func setMaterialProxies(name string, m *materialProxies) {
+	proxyLookupMutex.Lock()
+	defer proxyLookupMutex.Unlock()
+
+	if old, ok := proxyLookup[name]; ok && old.state.Animated != 0 {
+		gosigl.DeleteTextures(old.state.Animated)
+	}
+
+	if m == nil {
+		delete(proxyLookup, name)
+		return
+	}
+
+	m.evaluate(time.Since(proxyStart).Seconds())
+	proxyLookup[name] = m
+}
+
+// UpdateProxies evaluates the proxies of every bound material.
+// It should be called once a frame before anything is drawn
+func UpdateProxies() {
+	now := time.Since(proxyStart).Seconds()
+
+	proxyLookupMutex.Lock()
+	for _, m := range proxyLookup {
+		m.evaluate(now)
+	}
+	proxyLookupMutex.Unlock()
+}
+
+// LookupMaterialState returns how a material should be drawn this frame.
+// Materials without proxies or animation get the default state
+func LookupMaterialState(name string) MaterialState {
+	proxyLookupMutex.Lock()
+	defer proxyLookupMutex.Unlock()
+
+	if m, ok := proxyLookup[NormaliseMaterialName(name)]; ok {
+		return m.state
+	}
+
+	return defaultMaterialState
+}
+
+// MaterialStateFromParameters works out how a material would be drawn from its parameters
+// without running any proxies. It is used to preview materials that are being edited
+func MaterialStateFromParameters(params map[string]string) MaterialState {
+	m := &materialProxies{vars: map[string]*proxyVar{}, frames: 1}
+	for key, value := range params {
+		if v := parseProxyVar(value); v != nil {
+			m.vars[strings.ToLower(key)] = v
+		}
+	}
+
+	m.updateState()
+
+	return m.state
+}
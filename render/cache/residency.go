@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// textureResidency is how much GL memory a bound material takes up and when it was last drawn
+type textureResidency struct {
+	bytes    int64
+	lastUsed uint64
+}
+
+// ResidencyStats are shown in the info overlay
+type ResidencyStats struct {
+	Resident int
+	Evicted  int
+
+	Bytes int64
+	// Budget is 0 when there is no budget
+	Budget int64
+}
+
+var residency = map[string]*textureResidency{}
+
+// evicted materials are bound again the next time that they are looked up
+var evicted = map[string]bool{}
+var restreamRequests = map[string]bool{}
+
+var residencyFrame uint64
+var textureBudget int64
+var residencyMutex sync.Mutex
+
+// SetTextureBudget changes how many bytes of GL memory materials can use before
+// the least recently used ones are evicted. 0 means there is no budget
+func SetTextureBudget(bytes int64) {
+	residencyMutex.Lock()
+	textureBudget = bytes
+	residencyMutex.Unlock()
+}
+
+// TextureResidency returns how much GL memory materials are using
+func TextureResidency() ResidencyStats {
+	residencyMutex.Lock()
+	defer residencyMutex.Unlock()
+
+	stats := ResidencyStats{
+		Resident: len(residency),
+		Evicted:  len(evicted),
+		Budget:   textureBudget,
+	}
+	for _, r := range residency {
+		stats.Bytes += r.bytes
+	}
+
+	return stats
+}
+
+// trackTexture records the GL memory of a material that has just been bound
+func trackTexture(name string, bytes int64) {
+	residencyMutex.Lock()
+	residency[name] = &textureResidency{bytes: bytes, lastUsed: residencyFrame}
+	delete(evicted, name)
+	delete(restreamRequests, name)
+	residencyMutex.Unlock()
+}
+
+func markTextureUsed(name string) {
+	residencyMutex.Lock()
+	if r, ok := residency[name]; ok {
+		r.lastUsed = residencyFrame
+	}
+	residencyMutex.Unlock()
+}
+
+// requestRestream asks for an evicted material to be bound again.
+// Returns false if the material was never evicted
+func requestRestream(name string) bool {
+	residencyMutex.Lock()
+	defer residencyMutex.Unlock()
+
+	if !evicted[name] {
+		return false
+	}
+
+	restreamRequests[name] = true
+	return true
+}
+
+// evictTexture deletes the GL textures of a material but keeps its entry
+// so that it can be bound again when it is needed
+func evictTexture(name string) {
+	textureLookupMutex.Lock()
+	tex := textureLookup[name]
+	textureLookup[name] = 0
+	textureLookupMutex.Unlock()
+
+	if tex != 0 {
+		gosigl.DeleteTextures(tex)
+	}
+	setMaterialProxies(name, nil)
+
+	residencyMutex.Lock()
+	delete(residency, name)
+	evicted[name] = true
+	residencyMutex.Unlock()
+}
+
+// UpdateResidency streams evicted materials that have been asked for again and then evicts the
+// least recently used materials until they fit in the budget. Materials that were drawn in the
+// last frame or that inUse returns are never evicted.
+// It should be called once a frame
+func UpdateResidency(fs filesystem.IFileSystem, inUse func() map[string]bool) {
+	residencyMutex.Lock()
+	residencyFrame++
+	requests := make([]string, 0, len(restreamRequests))
+	for name := range restreamRequests {
+		requests = append(requests, name)
+	}
+	restreamRequests = map[string]bool{}
+	residencyMutex.Unlock()
+
+	for _, name := range requests {
+		StreamTexture(fs, name)
+	}
+
+	residencyMutex.Lock()
+	total := int64(0)
+	candidates := make([]string, 0)
+	for name, r := range residency {
+		total += r.bytes
+		if r.lastUsed+1 < residencyFrame {
+			candidates = append(candidates, name)
+		}
+	}
+	budget := textureBudget
+
+	if budget == 0 || total <= budget {
+		residencyMutex.Unlock()
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return residency[candidates[i]].lastUsed < residency[candidates[j]].lastUsed
+	})
+	residencyMutex.Unlock()
+
+	keep := map[string]bool{}
+	if inUse != nil {
+		keep = inUse()
+	}
+
+	count := 0
+	for _, name := range candidates {
+		if total <= budget {
+			break
+		}
+		if keep[name] {
+			continue
+		}
+
+		residencyMutex.Lock()
+		total -= residency[name].bytes
+		residencyMutex.Unlock()
+
+		evictTexture(name)
+		count++
+	}
+
+	if count > 0 {
+		logger.Notice("Evicted %d textures to stay in the texture budget", count)
+	}
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// streamWorkerCount is how many materials are read and decoded at once
+const streamWorkerCount = 4
+
+// streamUploadBudget is how long the render thread spends uploading streamed textures each frame.
+// At least one texture is always uploaded so that streaming cannot stall
+const streamUploadBudget = 4 * time.Millisecond
+
+type streamRequest struct {
+	fs   filesystem.IFileSystem
+	name string
+}
+
+// streamResult is sent back to the render thread, prepared is nil if the material could not be read
+type streamResult struct {
+	name     string
+	prepared *preparedTexture
+}
+
+var streamQueue []streamRequest
+var streamQueueCond = sync.NewCond(&sync.Mutex{})
+
+// streaming is every material that has been asked for but has not been uploaded yet
+var streaming = map[string]bool{}
+var streamingMutex sync.Mutex
+
+// restreamAfter is every material that was reloaded while it was streaming.
+// What is in flight was read before the reload so each one is streamed again once it finishes
+var restreamAfter = map[string]filesystem.IFileSystem{}
+
+var streamResults []streamResult
+var streamResultsMutex sync.Mutex
+
+var streamWorkersOnce sync.Once
+
+var placeholder gosigl.TextureBindingId
+
+// placeholderTexture is drawn in place of materials that are still streaming in
+func placeholderTexture() gosigl.TextureBindingId {
+	if placeholder != 0 {
+		return placeholder
+	}
+
+	// A grey checkerboard so that it is obvious that something is missing
+	const size = 8
+	data := make([]byte, size*size*4)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			shade := byte(96)
+			if (x+y)%2 == 0 {
+				shade = 160
+			}
+			i := (y*size + x) * 4
+			data[i], data[i+1], data[i+2], data[i+3] = shade, shade, shade, 255
+		}
+	}
+
+	placeholder = createTexture(formats.VtfFormatRGBA8888, size, size, data)
+
+	return placeholder
+}
+
+func isStreaming(name string) bool {
+	streamingMutex.Lock()
+	defer streamingMutex.Unlock()
+
+	return streaming[name]
+}
+
+// StreamTexture reads and decodes a material in the background and uploads it
+// from UpdateStreaming once it is ready. Until then the placeholder is drawn for it,
+// or whatever was bound for it before
+func StreamTexture(fs filesystem.IFileSystem, name string) {
+	name = NormaliseMaterialName(name)
+
+	// There is nothing to stream for these and the placeholder is drawn instead
+	if isMaterialFailed(name) {
+		return
+	}
+
+	streamingMutex.Lock()
+	if streaming[name] {
+		streamingMutex.Unlock()
+		return
+	}
+	streaming[name] = true
+	streamingMutex.Unlock()
+
+	streamWorkersOnce.Do(func() {
+		for i := 0; i < streamWorkerCount; i++ {
+			go streamWorker()
+		}
+	})
+
+	streamQueueCond.L.Lock()
+	streamQueue = append(streamQueue, streamRequest{fs: fs, name: name})
+	streamQueueCond.L.Unlock()
+	streamQueueCond.Signal()
+}
+
+// restreamTexture streams a material again after it has changed. If it is
+// already streaming it is streamed again once that has finished
+func restreamTexture(fs filesystem.IFileSystem, name string) {
+	name = NormaliseMaterialName(name)
+
+	streamingMutex.Lock()
+	if streaming[name] {
+		restreamAfter[name] = fs
+		streamingMutex.Unlock()
+		return
+	}
+	streamingMutex.Unlock()
+
+	StreamTexture(fs, name)
+}
+
+// prepareStreamed prepares a material for a worker. Broken materials can
+// panic inside of the loader so they are given up on instead
+func prepareStreamed(request streamRequest) (prepared *preparedTexture) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warn("Unable to stream material %s: %v", request.name, r)
+			prepared = nil
+		}
+	}()
+
+	return prepareTexture(request.fs, request.name)
+}
+
+func streamWorker() {
+	for {
+		streamQueueCond.L.Lock()
+		for len(streamQueue) == 0 {
+			streamQueueCond.Wait()
+		}
+		request := streamQueue[0]
+		streamQueue = streamQueue[1:]
+		streamQueueCond.L.Unlock()
+
+		result := streamResult{name: request.name, prepared: prepareStreamed(request)}
+
+		streamResultsMutex.Lock()
+		streamResults = append(streamResults, result)
+		streamResultsMutex.Unlock()
+	}
+}
+
+// UpdateStreaming uploads the materials that have finished streaming in
+// until the upload budget for this frame runs out.
+// It should be called once a frame on the render thread
+func UpdateStreaming() {
+	start := time.Now()
+
+	for {
+		streamResultsMutex.Lock()
+		if len(streamResults) == 0 {
+			streamResultsMutex.Unlock()
+			return
+		}
+		result := streamResults[0]
+		streamResults = streamResults[1:]
+		streamResultsMutex.Unlock()
+
+		streamingMutex.Lock()
+		delete(streaming, result.name)
+		fs, restream := restreamAfter[result.name]
+		delete(restreamAfter, result.name)
+		streamingMutex.Unlock()
+
+		// A stale result is still uploaded so that something is drawn until the restream finishes,
+		// but only the restream decides whether the material failed
+		if result.prepared != nil {
+			uploadPreparedTexture(result.prepared)
+		} else if !restream {
+			failedMaterials.Store(result.name, struct{}{})
+			notifyMaterialLoaded(result.name)
+		}
+
+		if restream {
+			StreamTexture(fs, result.name)
+		}
+
+		if time.Since(start) > streamUploadBudget {
+			return
+		}
+	}
+}
+
+// StreamingCount returns how many materials are still streaming in
+func StreamingCount() int {
+	streamingMutex.Lock()
+	defer streamingMutex.Unlock()
+
+	return len(streaming)
+}
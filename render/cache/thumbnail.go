@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/valve"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/filesystem"
+)
+
+// ThumbnailSize is the largest that a thumbnail will be on either axis
+const ThumbnailSize = 128
+
+// thumbnailVersion is bumped whenever the layout of a cached thumbnail changes
+const thumbnailVersion = 1
+
+// Most thumbnails uploaded in a single frame
+const thumbnailUploadsPerFrame = 32
+
+var thumbnailMagic = [4]byte{'F', 'T', 'H', 'B'}
+
+// thumbnail is a small mip of a materials base texture
+type thumbnail struct {
+	name string
+
+	// The times of the files that the thumbnail was made from
+	vmtTime int64
+	vtfTime int64
+	vtfPath string
+
+	format uint32
+	width  uint32
+	height uint32
+	data   []byte
+}
+
+// thumbnailHeader is the fixed size part of a cached thumbnail
+type thumbnailHeader struct {
+	Magic   [4]byte
+	Version uint32
+	VmtTime int64
+	VtfTime int64
+	Format  uint32
+	Width   uint32
+	Height  uint32
+	PathLen uint32
+	DataLen uint32
+}
+
+// These are only touched from the main thread
+var thumbnailLookup = map[string]gosigl.TextureBindingId{}
+var thumbnailRequested = map[string]bool{}
+
+var thumbnailsReady = make(chan *thumbnail, 1024)
+
+// ThumbnailDirectoryFor returns a cache directory for a game inside of root
+func ThumbnailDirectoryFor(root string, gameDir string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(filepath.Clean(gameDir))))
+	return filepath.Join(root, "thumbnails", filepath.Base(gameDir)+"-"+hex.EncodeToString(sum[:4]))
+}
+
+func dropThumbnail(name string) {
+	if tex := thumbnailLookup[name]; tex != 0 {
+		gosigl.DeleteTextures(tex)
+	}
+
+	delete(thumbnailLookup, name)
+	delete(thumbnailRequested, name)
+}
+
+func thumbnailPath(dir string, name string) string {
+	sum := sha1.Sum([]byte(name))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".thumb")
+}
+
+// LookupThumbnail returns the thumbnail for a material. If it is not ready yet
+// it is asked for and 0 is returned until it has been made
+func LookupThumbnail(name string) gosigl.TextureBindingId {
+	name = NormaliseMaterialName(name)
+
+	if tex, ok := thumbnailLookup[name]; ok {
+		return tex
+	}
+
+	// If the queue is full this is tried again next frame
+	if !thumbnailRequested[name] && requestThumbnail(name) {
+		thumbnailRequested[name] = true
+	}
+
+	return 0
+}
+
+// UpdateThumbnails uploads thumbnails that have been made since the last frame
+func UpdateThumbnails() {
+	for i := 0; i < thumbnailUploadsPerFrame; i++ {
+		select {
+		case t := <-thumbnailsReady:
+			// The thumbnail was thrown away while it was being made
+			if !thumbnailRequested[t.name] {
+				continue
+			}
+
+			if t.data == nil {
+				thumbnailLookup[t.name] = 0
+				continue
+			}
+
+			thumbnailLookup[t.name] = createTexture(t.format, int(t.width), int(t.height), t.data)
+		default:
+			return
+		}
+	}
+}
+
+func readThumbnail(path string) (*thumbnail, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := thumbnailHeader{}
+	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if header.Magic != thumbnailMagic || header.Version != thumbnailVersion {
+		return nil, errors.New("not a thumbnail")
+	}
+
+	vtfPath := make([]byte, header.PathLen)
+	data := make([]byte, header.DataLen)
+	if _, err := io.ReadFull(file, vtfPath); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+
+	return &thumbnail{
+		vmtTime: header.VmtTime,
+		vtfTime: header.VtfTime,
+		vtfPath: string(vtfPath),
+		format:  header.Format,
+		width:   header.Width,
+		height:  header.Height,
+		data:    data,
+	}, nil
+}
+
+func writeThumbnail(path string, t *thumbnail) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.LittleEndian, &thumbnailHeader{
+		Magic:   thumbnailMagic,
+		Version: thumbnailVersion,
+		VmtTime: t.vmtTime,
+		VtfTime: t.vtfTime,
+		Format:  t.format,
+		Width:   t.width,
+		Height:  t.height,
+		PathLen: uint32(len(t.vtfPath)),
+		DataLen: uint32(len(t.data)),
+	})
+	buffer.WriteString(t.vtfPath)
+	buffer.Write(t.data)
+
+	return ioutil.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+// pickThumbnailMip finds the largest mip that fits in a thumbnail,
+// falling back to the low resolution image if the vtf has no small mips
+func pickThumbnailMip(v *formats.Vtf, t *thumbnail) bool {
+	for i, m := range v.Mips {
+		if m.Width <= ThumbnailSize && m.Height <= ThumbnailSize {
+			t.format = v.Format()
+			t.width = uint32(m.Width)
+			t.height = uint32(m.Height)
+			t.data = v.Image(i, 0, 0)
+			return true
+		}
+	}
+
+	if len(v.LowRes) > 0 {
+		t.format = formats.VtfFormatDXT1
+		t.width = uint32(v.Header.LowResImageWidth)
+		t.height = uint32(v.Header.LowResImageHeight)
+		t.data = v.LowRes
+		return true
+	}
+
+	return false
+}
+
+// makeThumbnail reads a thumbnail from the cache or makes it from the materials base texture
+func makeThumbnail(fs *valve.FileSystem, dir string, name string) (*thumbnail, error) {
+	vmtPath := filesystem.BasePathMaterial + name + filesystem.ExtensionVmt
+
+	vmtTime, ok := fs.ModTime(vmtPath)
+	if !ok {
+		return nil, errors.New("material does not exist")
+	}
+
+	cachePath := thumbnailPath(dir, name)
+	if cached, err := readThumbnail(cachePath); err == nil && cached.vmtTime == vmtTime.UnixNano() {
+		if vtfTime, ok := fs.ModTime(cached.vtfPath); ok && cached.vtfTime == vtfTime.UnixNano() {
+			cached.name = name
+			return cached, nil
+		}
+	}
+
+	// Only the base texture is needed so the material is not loaded
+	kv, err := formats.ReadVmt(vmtPath, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	baseTexture := findMaterialParameter(kv, "$basetexture")
+	if baseTexture == "" {
+		return nil, errors.New("material has no base texture")
+	}
+
+	vtfPath := strings.ToLower(filesystem.NormalisePath(baseTexture))
+	vtfPath = filesystem.BasePathMaterial + strings.TrimSuffix(vtfPath, filesystem.ExtensionVtf) + filesystem.ExtensionVtf
+
+	vtfTime, ok := fs.ModTime(vtfPath)
+	if !ok {
+		return nil, errors.New("base texture does not exist")
+	}
+
+	stream, err := fs.GetFile(vtfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := formats.ReadVtf(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &thumbnail{
+		name:    name,
+		vmtTime: vmtTime.UnixNano(),
+		vtfTime: vtfTime.UnixNano(),
+		vtfPath: vtfPath,
+	}
+
+	if !pickThumbnailMip(v, t) {
+		return nil, errors.New("vtf has no image data")
+	}
+
+	if dir != "" {
+		writeThumbnail(cachePath, t)
+	}
+
+	return t, nil
+}
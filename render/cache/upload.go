@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/logger"
+	"github.com/emily33901/vtf"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// Anisotropic filtering is an extension in GL 4.1
+const (
+	glTextureMaxAnisotropy    = 0x84FE
+	glMaxTextureMaxAnisotropy = 0x84FF
+)
+
+// MaxTextureQuality is the most mips that can be skipped
+const MaxTextureQuality = 3
+
+// textureQuality is how many of the largest mips are skipped when textures are uploaded
+var textureQuality = 0
+
+// maxAnisotropy is found the first time that it is needed
+var maxAnisotropy float32 = -1
+
+// SetTextureQuality changes how many of the largest mips are skipped.
+// Textures that are already bound keep their quality until RebindTextures is called
+func SetTextureQuality(skip int) {
+	if skip < 0 {
+		skip = 0
+	}
+	if skip > MaxTextureQuality {
+		skip = MaxTextureQuality
+	}
+
+	textureQuality = skip
+}
+
+// TextureQuality returns how many of the largest mips are skipped
+func TextureQuality() int {
+	return textureQuality
+}
+
+func isCompressed(format gosigl.PixelFormat) bool {
+	switch format {
+	case gosigl.DXT1, gosigl.DXT1A, gosigl.DXT3, gosigl.DXT5:
+		return true
+	}
+
+	return false
+}
+
+// uploadMip uploads a mip of a 2D texture or of every layer of an array texture.
+// Returns how many bytes of GL memory it takes up
+func uploadMip(target uint32, level int32, width int, height int, layers int, data []byte, format gosigl.PixelFormat) int64 {
+	switch {
+	case target == gl.TEXTURE_2D_ARRAY && isCompressed(format):
+		gl.CompressedTexImage3D(target, level, uint32(format), int32(width), int32(height), int32(layers), 0, int32(len(data)), gl.Ptr(data))
+	case target == gl.TEXTURE_2D_ARRAY:
+		gl.TexImage3D(target, level, gl.RGBA, int32(width), int32(height), int32(layers), 0, uint32(format), gl.UNSIGNED_BYTE, gl.Ptr(data))
+	case isCompressed(format):
+		gl.CompressedTexImage2D(target, level, uint32(format), int32(width), int32(height), 0, int32(len(data)), gl.Ptr(data))
+	default:
+		gl.TexImage2D(target, level, gl.RGBA, int32(width), int32(height), 0, uint32(format), gl.UNSIGNED_BYTE, gl.Ptr(data))
+	}
+
+	if isCompressed(format) {
+		return int64(len(data))
+	}
+
+	// Everything that is not compressed is stored as RGBA8
+	return int64(width * height * 4 * layers)
+}
+
+// fullMipCount is how many mips a complete chain down to 1x1 has
+func fullMipCount(width int, height int) int {
+	count := 1
+	for width > 1 || height > 1 {
+		width /= 2
+		height /= 2
+		count++
+	}
+
+	return count
+}
+
+func applySamplingFlags(target uint32, flags uint32, mipmapped bool) {
+	wrapS, wrapT := int32(gl.REPEAT), int32(gl.REPEAT)
+	if flags&vtf.FlagClampS != 0 {
+		wrapS = gl.CLAMP_TO_EDGE
+	}
+	if flags&vtf.FlagClampT != 0 {
+		wrapT = gl.CLAMP_TO_EDGE
+	}
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_S, wrapS)
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_T, wrapT)
+
+	minFilter, magFilter := int32(gl.LINEAR), int32(gl.LINEAR)
+	switch {
+	case flags&vtf.FlagPointSampling != 0:
+		magFilter = gl.NEAREST
+		minFilter = gl.NEAREST
+		if mipmapped {
+			minFilter = gl.NEAREST_MIPMAP_NEAREST
+		}
+	case !mipmapped:
+	case flags&(vtf.FlagTrilinearSampling|vtf.FlagAnisotropicFiltering) != 0:
+		minFilter = gl.LINEAR_MIPMAP_LINEAR
+	default:
+		minFilter = gl.LINEAR_MIPMAP_NEAREST
+	}
+	gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(target, gl.TEXTURE_MAG_FILTER, magFilter)
+
+	if flags&vtf.FlagAnisotropicFiltering != 0 && mipmapped {
+		if maxAnisotropy < 0 {
+			gl.GetFloatv(glMaxTextureMaxAnisotropy, &maxAnisotropy)
+			// Drivers without the extension complain about the enum
+			gl.GetError()
+		}
+		if maxAnisotropy > 1 {
+			gl.TexParameterf(target, glTextureMaxAnisotropy, maxAnisotropy)
+		}
+	}
+}
+
+// createMippedTexture uploads every mip of a frame of a vtf, leaving out
+// the largest ones depending on the texture quality.
+// Mips that the vtf does not have are generated
+func createMippedTexture(v *formats.Vtf, frame int) (gosigl.TextureBindingId, int64) {
+	var id uint32
+	gl.GenTextures(1, &id)
+	gosigl.BindTexture2D(gosigl.TextureSlot(0), gosigl.TextureBindingId(id))
+
+	size := uploadVtf(gl.TEXTURE_2D, v, frame, 1)
+
+	return gosigl.TextureBindingId(id), size
+}
+
+// createArrayTexture uploads every frame of a vtf as the layers of an array texture.
+// The texture is left bound to texture slot 1
+func createArrayTexture(v *formats.Vtf) (gosigl.TextureBindingId, int64) {
+	var id uint32
+	gl.GenTextures(1, &id)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, id)
+
+	size := uploadVtf(gl.TEXTURE_2D_ARRAY, v, 0, v.Frames)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	return gosigl.TextureBindingId(id), size
+}
+
+// mipLayers returns the images for a run of frames of a mip in a format that GL can take.
+// When decode is set compressed images are decoded so that mips can be generated from them
+func mipLayers(v *formats.Vtf, m formats.VtfMip, firstFrame int, frames int, decode bool) ([]byte, gosigl.PixelFormat) {
+	var layers []byte
+	var format gosigl.PixelFormat
+
+	for frame := firstFrame; frame < firstFrame+frames; frame++ {
+		data, f := uploadableImage(v.Format(), m.Width, m.Height, m.Images[frame][0])
+		if decode && isCompressed(f) {
+			decoded, err := formats.DecodeVtfImage(v.Format(), m.Width, m.Height, m.Images[frame][0])
+			if err == nil {
+				data, f = decoded, gosigl.RGBA
+			}
+		}
+
+		if frames == 1 {
+			return data, f
+		}
+
+		layers = append(layers, data...)
+		format = f
+	}
+
+	return layers, format
+}
+
+// firstUploadedMip is the largest mip of a vtf that is uploaded at the current texture quality
+func firstUploadedMip(v *formats.Vtf) int {
+	first := textureQuality
+	if v.Header.Flags&vtf.FlagNoLevelOfDetail != 0 {
+		first = 0
+	}
+	if first > len(v.Mips)-1 {
+		first = len(v.Mips) - 1
+	}
+
+	return first
+}
+
+// prepareVtfForUpload decodes whatever GL cannot take as it is so that the
+// render thread only has to upload it. The mips that are skipped at the current
+// texture quality are dropped too
+func prepareVtfForUpload(v *formats.Vtf) *formats.Vtf {
+	first := firstUploadedMip(v)
+	top := v.Mips[first]
+
+	format, native := glTextureFormatFromVtfFormat(v.Format())
+	mipmapped := v.Header.Flags&vtf.FlagNoMipmaps == 0
+	complete := len(v.Mips)-first >= fullMipCount(top.Width, top.Height)
+
+	// Compressed images cannot always have mips generated for them
+	needsDecode := !native || (mipmapped && !complete && isCompressed(format))
+	if first == 0 && !needsDecode {
+		return v
+	}
+
+	prepared := *v
+	prepared.Mips = make([]formats.VtfMip, 0, len(v.Mips)-first)
+	prepared.Faces = 1
+
+	// The skipped mips are already gone so the upload must not skip any more
+	prepared.Header.Flags |= vtf.FlagNoLevelOfDetail
+	prepared.Header.Width = uint16(top.Width)
+	prepared.Header.Height = uint16(top.Height)
+	prepared.Header.MipmapCount = uint8(len(v.Mips) - first)
+
+	if needsDecode {
+		prepared.Header.HighResImageFormat = formats.VtfFormatRGBA8888
+	}
+
+	for _, m := range v.Mips[first:] {
+		mip := formats.VtfMip{Width: m.Width, Height: m.Height, Images: make([][][]byte, v.Frames)}
+
+		for frame := 0; frame < v.Frames; frame++ {
+			data := m.Images[frame][0]
+			if needsDecode {
+				decoded, err := formats.DecodeVtfImage(v.Format(), m.Width, m.Height, data)
+				if err != nil {
+					// Still upload something so that the texture is the right size
+					logger.Warn("Unable to decode texture: %s", err)
+					decoded = make([]byte, m.Width*m.Height*4)
+				}
+				data = decoded
+			}
+
+			mip.Images[frame] = [][]byte{data}
+		}
+
+		prepared.Mips = append(prepared.Mips, mip)
+	}
+
+	return &prepared
+}
+
+// uploadVtf uploads the mips of a run of frames to the bound texture.
+// Returns how many bytes of GL memory they take up
+func uploadVtf(target uint32, v *formats.Vtf, firstFrame int, frames int) int64 {
+	flags := v.Header.Flags
+	first := firstUploadedMip(v)
+
+	// Rows of RGB888 images are not always 4 byte aligned
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+
+	top := v.Mips[first]
+	mipmapped := flags&vtf.FlagNoMipmaps == 0
+	complete := len(v.Mips)-first >= fullMipCount(top.Width, top.Height)
+	size := int64(0)
+
+	if !mipmapped || complete {
+		last := len(v.Mips) - 1
+		if !mipmapped {
+			last = first
+		}
+
+		for i := first; i <= last; i++ {
+			m := v.Mips[i]
+			data, format := mipLayers(v, m, firstFrame, frames, false)
+			size += uploadMip(target, int32(i-first), m.Width, m.Height, frames, data, format)
+		}
+		gl.TexParameteri(target, gl.TEXTURE_MAX_LEVEL, int32(last-first))
+	} else {
+		// Compressed formats cannot always have mips generated for them so decode first
+		data, format := mipLayers(v, top, firstFrame, frames, true)
+
+		size += uploadMip(target, 0, top.Width, top.Height, frames, data, format)
+		if !isCompressed(format) {
+			gl.GenerateMipmap(target)
+
+			for level := 1; level < fullMipCount(top.Width, top.Height); level++ {
+				size += int64(maxInt(top.Width>>uint(level), 1) * maxInt(top.Height>>uint(level), 1) * 4 * frames)
+			}
+		} else {
+			gl.TexParameteri(target, gl.TEXTURE_MAX_LEVEL, 0)
+			mipmapped = false
+		}
+	}
+
+	applySamplingFlags(target, flags, mipmapped)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+
+	return size
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// glTextureFormatFromVtfFormat returns the GL format for vtf formats that can be uploaded as they are
+func glTextureFormatFromVtfFormat(vtfFormat uint32) (gosigl.PixelFormat, bool) {
+	switch vtfFormat {
+	case formats.VtfFormatRGBA8888:
+		return gosigl.RGBA, true
+	case formats.VtfFormatRGB888:
+		return gosigl.RGB, true
+	case formats.VtfFormatBGR888:
+		return gosigl.BGR, true
+	case formats.VtfFormatBGRA8888:
+		return gosigl.BGRA, true
+	case formats.VtfFormatDXT1:
+		return gosigl.DXT1, true
+	case formats.VtfFormatDXT1OneBitAlpha:
+		return gosigl.DXT1A, true
+	case formats.VtfFormatDXT3:
+		return gosigl.DXT3, true
+	case formats.VtfFormatDXT5:
+		return gosigl.DXT5, true
+	}
+
+	return 0, false
+}
+
+// uploadableImage returns image data in a format that GL can take.
+// Anything that GL cannot read directly is decoded to RGBA8888
+func uploadableImage(vtfFormat uint32, width int, height int, data []byte) ([]byte, gosigl.PixelFormat) {
+	if format, ok := glTextureFormatFromVtfFormat(vtfFormat); ok {
+		return data, format
+	}
+
+	decoded, err := formats.DecodeVtfImage(vtfFormat, width, height, data)
+	if err != nil {
+		// Still upload something so that the texture is the right size
+		logger.Warn("Unable to decode texture: %s", err)
+		decoded = make([]byte, width*height*4)
+	}
+
+	return decoded, gosigl.RGBA
+}
+
+// createTexture uploads an image from a vtf
+func createTexture(vtfFormat uint32, width int, height int, data []byte) gosigl.TextureBindingId {
+	data, format := uploadableImage(vtfFormat, width, height, data)
+
+	return gosigl.CreateTexture2D(gosigl.TextureSlot(0), width, height, data, format, false)
+}
@@ -144,15 +144,48 @@ func NewCompositionMesh(texName string, offset int, length int) *compositionMesh
 type Compositor struct {
 	meshes []mesh.IMesh
 
+	// slots is where each mesh is in meshes so that removing one does not have to search for it
+	slots map[mesh.IMesh]int
+
 	isOutdated bool
 }
 
 // AddModel adds a new model to be composed.
 func (compositor *Compositor) AddMesh(m mesh.IMesh) {
+	if compositor.slots == nil {
+		compositor.slots = map[mesh.IMesh]int{}
+	}
+
+	compositor.slots[m] = len(compositor.meshes)
 	compositor.meshes = append(compositor.meshes, m)
 	compositor.isOutdated = true
 }
 
+// RemoveMesh removes a mesh that was previously added to be composed.
+// Meshes are grouped by material when composing so the last mesh is moved into its place
+func (compositor *Compositor) RemoveMesh(m mesh.IMesh) {
+	idx, ok := compositor.slots[m]
+	if !ok {
+		return
+	}
+
+	last := len(compositor.meshes) - 1
+	if idx != last {
+		compositor.meshes[idx] = compositor.meshes[last]
+		compositor.slots[compositor.meshes[idx]] = idx
+	}
+	compositor.meshes[last] = nil
+	compositor.meshes = compositor.meshes[:last]
+	delete(compositor.slots, m)
+
+	compositor.isOutdated = true
+}
+
+// MarkOutdated forces the next frame to recompose the scene.
+func (compositor *Compositor) MarkOutdated() {
+	compositor.isOutdated = true
+}
+
 func (compositor *Compositor) IsOutdated() bool {
 	return compositor.isOutdated
 }
@@ -5,16 +5,19 @@ import (
 
 	"github.com/go-gl/mathgl/mgl32"
 
+	"github.com/emily33901/go-forgery/render/lazy"
 	"github.com/emily33901/go-forgery/valve/world"
 	"github.com/emily33901/lambda-core/core/filesystem"
-	materialoader "github.com/emily33901/lambda-core/core/loader/material"
-	"github.com/emily33901/lambda-core/core/logger"
 	"github.com/emily33901/lambda-core/core/material"
 	lambdaMesh "github.com/emily33901/lambda-core/core/mesh"
 	lambdaModel "github.com/emily33901/lambda-core/core/model"
 	"github.com/golang-source-engine/vmt"
 )
 
+// DefaultTextureSize is used to generate uvs for materials whose
+// dimensions are not known yet
+const DefaultTextureSize = 128
+
 func SolidToModel(solid *world.Solid, fs filesystem.IFileSystem) *lambdaModel.Model {
 	meshes := make([]lambdaMesh.IMesh, 0)
 
@@ -39,8 +42,14 @@ func SolidToModel(solid *world.Solid, fs filesystem.IFileSystem) *lambdaModel.Mo
 func sideToMesh(side *world.Side, fs filesystem.IFileSystem) *lambdaMesh.Mesh {
 	mesh := lambdaMesh.NewMesh()
 
-	// Material
-	mesh.SetMaterial(material.NewMaterial(side.Material, vmt.NewProperties()))
+	// Material. The mesh always refers to its material by the same key
+	// so that it can be streamed in even before the material has loaded
+	key := lazy.MaterialKey(side.Material)
+	if mat := lazy.Material(key); mat != nil {
+		mesh.SetMaterial(mat)
+	} else {
+		mesh.SetMaterial(material.NewMaterial(key, vmt.NewProperties()))
+	}
 	mesh.SetMeta("side", side.Id)
 
 	// Vertices
@@ -79,22 +88,15 @@ func sideToMesh(side *world.Side, fs filesystem.IFileSystem) *lambdaMesh.Mesh {
 
 	// Texture coordinates
 	{
-		for i := range verts {
-			// TODO width & height must be known
-			mat := materialoader.LoadSingleMaterial(side.Material, fs)
-
-			width, height := 128, 128
+		width, height, found := lazy.MaterialDimensions(key)
 
-			if mat != nil {
-				mesh.SetMaterial(mat)
-				width = mat.Width()
-				height = mat.Height()
-			} else {
-				// TODO use the event manager to catch when materials are loaded properly
-				// and then update the uvs there and rebind them
-				logger.Notice("mat == nil so uvs will be wrong")
-			}
+		if !found {
+			// The material hasnt finished loading yet so these uvs will be wrong
+			// Scene will rebuild this side once it has been loaded
+			width, height = DefaultTextureSize, DefaultTextureSize
+		}
 
+		for i := range verts {
 			mesh.AddUV(uvForVertex(verts[i], &side.UAxis, &side.VAxis, width, height))
 		}
 	}
@@ -105,6 +107,13 @@ func sideToMesh(side *world.Side, fs filesystem.IFileSystem) *lambdaMesh.Mesh {
 	return mesh
 }
 
+// SideHasMaterialDimensions returns whether the dimensions of the material
+// on this side are known, and so whether its uvs will be correct
+func SideHasMaterialDimensions(side *world.Side) bool {
+	_, _, found := lazy.MaterialDimensions(side.Material)
+	return found
+}
+
 func uvForVertex(vertex mgl32.Vec3, u *world.UVTransform, v *world.UVTransform, width int, height int) (uvs mgl32.Vec2) {
 	cu := ((float32(u.Transform[0]) * vertex[0]) +
 		(float32(u.Transform[1]) * vertex[1]) +
@@ -0,0 +1,117 @@
+package lazy
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	loader "github.com/emily33901/lambda-core/core/loader/material"
+	keyvalues "github.com/galaco/KeyValues"
+)
+
+// trimTexturePath turns anything from "materials/x/y.vtf" to "x/y" into the form that LoadLazyTexture takes
+func trimTexturePath(texturePath string) string {
+	texturePath = strings.ToLower(filesystem.NormalisePath(texturePath))
+	texturePath = strings.TrimPrefix(texturePath, filesystem.BasePathMaterial)
+
+	return strings.TrimSuffix(texturePath, filesystem.ExtensionVtf)
+}
+
+// readLazyVtf reads a whole vtf through the lazy texture loader
+func readLazyVtf(fs filesystem.IFileSystem, texturePath string) (*formats.Vtf, error) {
+	// Textures that cannot be read fall back to the error texture
+	loader.LoadErrorMaterial()
+
+	tex, ok := LoadLazyTexture(texturePath, fs).(*TextureLazy2D)
+	if !ok {
+		return nil, fmt.Errorf("unable to read %s", texturePath)
+	}
+
+	return tex.ReadVtf()
+}
+
+// ExportTexture writes the images of a texture to dir as pngs named after the texture.
+// Returns the files that were written
+func ExportTexture(fs filesystem.IFileSystem, texturePath string, dir string, options formats.PngExportOptions) ([]string, error) {
+	texturePath = trimTexturePath(texturePath)
+
+	v, err := readLazyVtf(fs, texturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return formats.ExportVtfPngs(v, dir, path.Base(texturePath), options, nil)
+}
+
+func vmtFloat(kv *keyvalues.KeyValue, key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(formats.VmtParameter(kv, key), 64)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func vmtBool(kv *keyvalues.KeyValue, key string) bool {
+	return vmtFloat(kv, key, 0) != 0
+}
+
+// materialAlphaCompositor bakes how a material draws its base texture into the alpha.
+// The alpha of textures that are not translucent or alpha tested is a mask for
+// something else (like the envmap) so it is thrown away
+func materialAlphaCompositor(kv *keyvalues.KeyValue) func(rgba []byte) {
+	alpha := vmtFloat(kv, "$alpha", 1)
+	translucent := vmtBool(kv, "$translucent")
+	alphaTest := vmtBool(kv, "$alphatest")
+	reference := vmtFloat(kv, "$alphatestreference", 0.5)
+
+	return func(rgba []byte) {
+		for i := 3; i < len(rgba); i += 4 {
+			a := float64(rgba[i]) / 255
+
+			switch {
+			case alphaTest:
+				if a >= reference {
+					a = 1
+				} else {
+					a = 0
+				}
+			case !translucent:
+				a = 1
+			}
+
+			rgba[i] = byte(a*alpha*255 + 0.5)
+		}
+	}
+}
+
+// ExportMaterial writes the images of the base texture of a material to dir as pngs named after the material.
+// Returns the files that were written
+func ExportMaterial(fs filesystem.IFileSystem, materialPath string, dir string, options formats.PngExportOptions) ([]string, error) {
+	materialPath = strings.TrimSuffix(MaterialKey(materialPath), filesystem.ExtensionVmt)
+
+	kv, err := formats.ReadVmt(filesystem.BasePathMaterial+materialPath+filesystem.ExtensionVmt, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	baseTexture := formats.VmtParameter(kv, "$basetexture")
+	if baseTexture == "" {
+		return nil, fmt.Errorf("%s has no base texture", materialPath)
+	}
+
+	v, err := readLazyVtf(fs, trimTexturePath(baseTexture))
+	if err != nil {
+		return nil, err
+	}
+
+	var composite func([]byte)
+	if options.CompositeAlpha {
+		composite = materialAlphaCompositor(kv)
+	}
+
+	return formats.ExportVtfPngs(v, dir, path.Base(materialPath), options, composite)
+}
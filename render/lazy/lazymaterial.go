@@ -2,32 +2,107 @@ package lazy
 
 import (
 	"strings"
+	"sync"
 
+	"github.com/emily33901/go-forgery/formats"
 	"github.com/emily33901/lambda-core/core/filesystem"
 	"github.com/emily33901/lambda-core/core/logger"
 	"github.com/emily33901/lambda-core/core/material"
-	"github.com/emily33901/lambda-core/core/resource"
 	"github.com/emily33901/lambda-core/core/texture"
 	"github.com/golang-source-engine/vmt"
 )
 
+// MaterialTextures are the textures of a material that lambda-core has nowhere to keep.
+// Any of them can be nil when the material does not use them
+type MaterialTextures struct {
+	// BaseTexture2 and BlendModulate are used by WorldVertexTransition to blend two textures
+	BaseTexture2  texture.ITexture
+	BlendModulate texture.ITexture
+
+	Detail texture.ITexture
+}
+
+// MaterialKey is the name that a material is kept under in the resource manager:
+// lowercase, relative to materials/ and with the .vmt extension.
+// Every other material key in forgery is made from this
+func MaterialKey(materialPath string) string {
+	materialPath = strings.ToLower(filesystem.NormalisePath(materialPath))
+	materialPath = strings.TrimPrefix(materialPath, "/")
+	materialPath = strings.TrimPrefix(materialPath, filesystem.BasePathMaterial)
+	if !strings.HasSuffix(materialPath, filesystem.ExtensionVmt) {
+		materialPath += filesystem.ExtensionVmt
+	}
+
+	return materialPath
+}
+
+var materialTextures = map[string]*MaterialTextures{}
+var materialTexturesMutex sync.Mutex
+
+func setMaterialTextures(materialPath string, textures *MaterialTextures) {
+	materialPath = MaterialKey(materialPath)
+
+	materialTexturesMutex.Lock()
+	if textures == nil {
+		delete(materialTextures, materialPath)
+	} else {
+		materialTextures[materialPath] = textures
+	}
+	materialTexturesMutex.Unlock()
+}
+
+// LookupMaterialTextures returns the extra textures of a material that has been loaded
+// or nil if it has not been
+func LookupMaterialTextures(materialPath string) *MaterialTextures {
+	materialPath = MaterialKey(materialPath)
+
+	materialTexturesMutex.Lock()
+	defer materialTexturesMutex.Unlock()
+
+	return materialTextures[materialPath]
+}
+
+// all returns every texture that is set
+func (textures *MaterialTextures) all() []texture.ITexture {
+	all := make([]texture.ITexture, 0, 3)
+	for _, tex := range []texture.ITexture{textures.BaseTexture2, textures.BlendModulate, textures.Detail} {
+		if tex != nil {
+			all = append(all, tex)
+		}
+	}
+
+	return all
+}
+
+// loadOptionalTexture loads a texture that a material can do without
+func loadOptionalTexture(filePath string, fs filesystem.IFileSystem) texture.ITexture {
+	if filePath == "" {
+		return nil
+	}
+
+	return LoadLazyTexture(filePath, fs)
+}
+
 // loadMaterialsLazy "private" function that actually does the loading
 func loadMaterialsLazy(fs filesystem.IFileSystem, materialList ...string) (missingList []string) {
-	ResourceManager := resource.Manager()
-
 	for _, materialPath := range materialList {
 		vtfTexturePath := ""
 
-		if !strings.HasSuffix(materialPath, filesystem.ExtensionVmt) {
-			materialPath += filesystem.ExtensionVmt
+		materialPath = MaterialKey(materialPath)
+		if HasMaterial(materialPath) {
+			continue
 		}
 
-		if ResourceManager.HasMaterial(filesystem.BasePathMaterial + materialPath) {
+		vmtPath := filesystem.BasePathMaterial + materialPath
+
+		kv, err := formats.ReadVmt(vmtPath, fs)
+		if err != nil {
+			logger.Warn("Failed to load material: %s. Reason: %s", filesystem.BasePathMaterial+materialPath, err)
+			missingList = append(missingList, materialPath)
 			continue
 		}
 
-		mat, err := vmt.FromFilesystem(materialPath, fs, vmt.NewProperties())
-
+		mat, err := vmt.FromKeyValues(kv, vmt.NewProperties())
 		if err != nil {
 			logger.Warn("Failed to load material: %s. Reason: %s", filesystem.BasePathMaterial+materialPath, err)
 			missingList = append(missingList, materialPath)
@@ -38,14 +113,13 @@ func loadMaterialsLazy(fs filesystem.IFileSystem, materialList ...string) (missi
 		material := material.NewMaterial(materialPath, properties)
 
 		if material.Props.BaseTexture == "" {
-			material.Textures.Albedo = ResourceManager.Texture(ResourceManager.ErrorTextureName()).(texture.ITexture)
+			material.Textures.Albedo = ErrorTexture()
 			missingList = append(missingList, materialPath)
 
-			ResourceManager.AddMaterial(material)
+			addMaterial(material)
 			continue
 		}
 
-		// NOTE: in patch vmts include is not supported
 		vtfTexturePath = material.Props.BaseTexture
 		if !strings.HasSuffix(vtfTexturePath, filesystem.ExtensionVtf) {
 			vtfTexturePath = vtfTexturePath + filesystem.ExtensionVtf
@@ -54,30 +128,50 @@ func loadMaterialsLazy(fs filesystem.IFileSystem, materialList ...string) (missi
 		material.Textures.Albedo = LoadLazyTexture(vtfTexturePath, fs)
 
 		if material.Textures.Albedo == nil {
-			material.Textures.Albedo = ResourceManager.Texture(ResourceManager.ErrorTextureName()).(texture.ITexture)
+			material.Textures.Albedo = ErrorTexture()
 			missingList = append(missingList, materialPath)
-			ResourceManager.AddMaterial(material)
+			addMaterial(material)
 			continue
 		}
 
 		if material.Props.Bumpmap != "" {
 			material.Textures.Normal = LoadLazyTexture(material.Props.Bumpmap, fs)
 		}
-		ResourceManager.AddMaterial(material)
+
+		setMaterialTextures(material.FilePath(), &MaterialTextures{
+			BaseTexture2:  loadOptionalTexture(formats.VmtParameter(kv, "$basetexture2"), fs),
+			BlendModulate: loadOptionalTexture(formats.VmtParameter(kv, "$blendmodulatetexture"), fs),
+			Detail:        loadOptionalTexture(formats.VmtParameter(kv, "$detail"), fs),
+		})
+
+		addMaterial(material)
 	}
 	return missingList
 }
 
-// LoadSingleMaterial loads a single material with known file path
+// LoadSingleMaterial loads a single material with known file path.
+// The path can be given with or without materials/ and .vmt
 func LoadSingleLazyMaterial(filePath string, fs filesystem.IFileSystem) material.IMaterial {
-	if resource.Manager().HasMaterial(filesystem.BasePathMaterial + filePath) {
-		return resource.Manager().Material(filesystem.BasePathMaterial + filePath)
+	key := MaterialKey(filePath)
+	if mat := Material(key); mat != nil {
+		return mat
 	}
 
-	result := loadMaterialsLazy(fs, filePath)
+	result := loadMaterialsLazy(fs, key)
 	if len(result) == 0 {
-		return resource.Manager().Material(filesystem.BasePathMaterial + filePath)
+		return Material(key)
+	}
+	return ErrorMaterial()
+}
 
+// MaterialDimensions returns the dimensions of a materials base texture
+// if the material has already been loaded. These come from the vtf header
+// so the texture itself does not need to be resident.
+func MaterialDimensions(materialPath string) (width int, height int, found bool) {
+	mat := Material(MaterialKey(materialPath))
+	if mat == nil || mat.Width() == 0 || mat.Height() == 0 {
+		return 0, 0, false
 	}
-	return resource.Manager().Material(resource.Manager().ErrorTextureName())
+
+	return mat.Width(), mat.Height(), true
 }
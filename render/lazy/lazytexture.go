@@ -3,9 +3,9 @@ package lazy
 import (
 	"strings"
 
+	"github.com/emily33901/go-forgery/formats"
 	"github.com/emily33901/lambda-core/core/filesystem"
 	"github.com/emily33901/lambda-core/core/logger"
-	"github.com/emily33901/lambda-core/core/resource"
 	"github.com/emily33901/lambda-core/core/texture"
 	"github.com/emily33901/vtf"
 )
@@ -15,7 +15,7 @@ type TextureLazy2D struct {
 	fileSystem filesystem.IFileSystem
 	width      int
 	height     int
-	vtf        *vtf.Vtf
+	vtf        *formats.Vtf
 }
 
 // FilePath Get the filepath this data was loaded from
@@ -39,7 +39,7 @@ func (tex *TextureLazy2D) Format() uint32 {
 		logger.Panic("Always Reload() a texture before attempting to access its fields")
 	}
 
-	return tex.vtf.Header().HighResImageFormat
+	return tex.vtf.Format()
 }
 
 // PixelDataForFrame get raw colour data for this frame
@@ -48,7 +48,16 @@ func (tex *TextureLazy2D) PixelDataForFrame(frame int) []byte {
 		logger.Panic("Always Reload() a texture before attempting to access its fields")
 	}
 
-	return tex.vtf.HighestResolutionImageForFrame(frame)
+	return tex.vtf.Image(0, frame, 0)
+}
+
+// Vtf returns the whole vtf with all of its mips and frames
+func (tex *TextureLazy2D) Vtf() *formats.Vtf {
+	if tex.vtf == nil {
+		logger.Panic("Always Reload() a texture before attempting to access its fields")
+	}
+
+	return tex.vtf
 }
 
 // Thumbnail returns a small thumbnail image of a material
@@ -57,19 +66,24 @@ func (tex *TextureLazy2D) Thumbnail() []byte {
 		logger.Panic("Always Reload() a texture before attempting to access its fields")
 	}
 
-	return tex.vtf.LowResImageData()
+	return tex.vtf.LowRes
 }
 
-func (tex *TextureLazy2D) Reload() error {
+// ReadVtf reads the whole vtf from the filesystem without keeping it,
+// so that it can be used without fighting over the data that Reload keeps
+func (tex *TextureLazy2D) ReadVtf() (*formats.Vtf, error) {
 	stream, err := tex.fileSystem.GetFile(tex.filePath)
 	if err != nil {
-		logger.Error("Unable to load %s from Disk: %s", tex.filePath, err)
-		return err
+		return nil, err
 	}
 
+	return formats.ReadVtf(stream)
+}
+
+func (tex *TextureLazy2D) Reload() error {
 	// Attempt to parse the vtf into color data we can use,
 	// if this fails (it shouldn't) we can treat it like it was missing
-	read, err := vtf.ReadFromStream(stream)
+	read, err := tex.ReadVtf()
 	if err != nil {
 		logger.Error("Unable to load %s from Disk: %s", tex.filePath, err)
 		return err
@@ -100,16 +114,16 @@ func LoadLazyTexture(filePath string, fs filesystem.IFileSystem) texture.ITextur
 	if !strings.HasSuffix(filePath, filesystem.ExtensionVtf) {
 		filePath = filePath + filesystem.ExtensionVtf
 	}
-	if resource.Manager().Texture(filesystem.BasePathMaterial+filePath) != nil {
-		return resource.Manager().Texture(filesystem.BasePathMaterial + filePath).(texture.ITexture)
+	if tex := Texture(filesystem.BasePathMaterial + filePath); tex != nil {
+		return tex
 	}
 	if filePath == "" {
-		return resource.Manager().Texture(resource.Manager().ErrorTextureName()).(texture.ITexture)
+		return ErrorTexture()
 	}
 	mat, err := readVtf(filesystem.BasePathMaterial+filePath, fs)
 	if err != nil {
 		logger.Warn("Failed to load texture: %s. Reason: %s", filesystem.BasePathMaterial+filePath, err)
-		return resource.Manager().Texture(resource.Manager().ErrorTextureName()).(texture.ITexture)
+		return ErrorTexture()
 	}
 	return mat
 }
@@ -118,7 +132,6 @@ func LoadLazyTexture(filePath string, fs filesystem.IFileSystem) texture.ITextur
 
 // readVtf
 func readVtf(path string, fs filesystem.IFileSystem) (texture.ITexture, error) {
-	ResourceManager := resource.Manager()
 	stream, err := fs.GetFile(path)
 	if err != nil {
 		return nil, err
@@ -133,7 +146,7 @@ func readVtf(path string, fs filesystem.IFileSystem) (texture.ITexture, error) {
 	}
 
 	// Store filesystem containing raw data in memory
-	ResourceManager.AddTexture(
+	addTexture(
 		NewLazyTexture(
 			path,
 			fs,
@@ -141,5 +154,5 @@ func readVtf(path string, fs filesystem.IFileSystem) (texture.ITexture, error) {
 			int(header.Height)))
 
 	// Finally generate the gpu buffer for the material
-	return ResourceManager.Texture(path), nil
+	return Texture(path), nil
 }
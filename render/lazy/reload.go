@@ -0,0 +1,71 @@
+package lazy
+
+import (
+	"strings"
+
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/material"
+	"github.com/emily33901/lambda-core/core/resource"
+	"github.com/emily33901/lambda-core/core/texture"
+)
+
+// The resource manager has no way to remove a single resource so these remove them
+// from its maps under resourceMutex. render/cache also makes sure that a material is
+// not being loaded while it is being unloaded so that the load does not use stale textures
+
+// unloadableTextures returns the paths of textures that can be removed
+func unloadableTextures(textures ...texture.ITexture) []string {
+	paths := make([]string, 0, len(textures))
+	for _, tex := range textures {
+		if tex != nil && !strings.EqualFold(tex.FilePath(), resource.Manager().ErrorTextureName()) {
+			paths = append(paths, tex.FilePath())
+		}
+	}
+
+	return paths
+}
+
+// UnloadMaterial removes a material and its textures from the resource manager
+// so that the next time it is loaded it is read from the filesystem again
+func UnloadMaterial(materialPath string) {
+	materialPath = MaterialKey(materialPath)
+
+	textures := make([]string, 0)
+	if mat, ok := Material(materialPath).(*material.Material); ok {
+		textures = append(textures, unloadableTextures(mat.Textures.Albedo, mat.Textures.Normal)...)
+	}
+
+	if extra := LookupMaterialTextures(materialPath); extra != nil {
+		textures = append(textures, unloadableTextures(extra.all()...)...)
+		setMaterialTextures(materialPath, nil)
+	}
+
+	removeResources([]string{materialPath}, textures)
+}
+
+// MaterialsUsingTexture returns the names of the loaded materials that use a texture
+func MaterialsUsingTexture(texturePath string) []string {
+	texturePath = strings.ToLower(filesystem.NormalisePath(texturePath))
+
+	results := make([]string, 0)
+	rangeMaterials(func(name string, m material.IMaterial) {
+		mat, ok := m.(*material.Material)
+		if !ok {
+			return
+		}
+
+		textures := []texture.ITexture{mat.Textures.Albedo, mat.Textures.Normal}
+		if extra := LookupMaterialTextures(name); extra != nil {
+			textures = append(textures, extra.all()...)
+		}
+
+		for _, tex := range textures {
+			if tex != nil && strings.ToLower(tex.FilePath()) == texturePath {
+				results = append(results, name)
+				break
+			}
+		}
+	})
+
+	return results
+}
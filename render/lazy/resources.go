@@ -0,0 +1,88 @@
+package lazy
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/emily33901/lambda-core/core/material"
+	"github.com/emily33901/lambda-core/core/resource"
+	"github.com/emily33901/lambda-core/core/texture"
+)
+
+// The resource manager only locks single lookups and hands out its maps as they are.
+// Everything in forgery goes through these instead so that removing resources and
+// searching through all of them can be locked against materials loading on other goroutines
+
+var resourceMutex sync.RWMutex
+
+// Material returns a loaded material or nil
+func Material(filePath string) material.IMaterial {
+	resourceMutex.RLock()
+	defer resourceMutex.RUnlock()
+
+	return resource.Manager().Material(filePath)
+}
+
+// HasMaterial returns whether a material has been loaded
+func HasMaterial(filePath string) bool {
+	resourceMutex.RLock()
+	defer resourceMutex.RUnlock()
+
+	return resource.Manager().HasMaterial(filePath)
+}
+
+// ErrorMaterial returns the material that is used in place of ones that could not be loaded
+func ErrorMaterial() material.IMaterial {
+	return Material(resource.Manager().ErrorTextureName())
+}
+
+func addMaterial(mat material.IMaterial) {
+	resourceMutex.Lock()
+	defer resourceMutex.Unlock()
+
+	resource.Manager().AddMaterial(mat)
+}
+
+// Texture returns a loaded texture or nil
+func Texture(filePath string) texture.ITexture {
+	resourceMutex.RLock()
+	defer resourceMutex.RUnlock()
+
+	return resource.Manager().Texture(filePath)
+}
+
+// ErrorTexture returns the texture that is used in place of ones that could not be loaded
+func ErrorTexture() texture.ITexture {
+	return Texture(resource.Manager().ErrorTextureName())
+}
+
+func addTexture(tex texture.ITexture) {
+	resourceMutex.Lock()
+	defer resourceMutex.Unlock()
+
+	resource.Manager().AddTexture(tex)
+}
+
+// removeResources removes materials and textures from the resource manager
+func removeResources(materials []string, textures []string) {
+	resourceMutex.Lock()
+	defer resourceMutex.Unlock()
+
+	for _, name := range materials {
+		delete(resource.Manager().Materials(), strings.ToLower(name))
+	}
+	for _, name := range textures {
+		delete(resource.Manager().Textures(), strings.ToLower(name))
+	}
+}
+
+// rangeMaterials calls fn with every loaded material while holding the lock.
+// fn must not load or remove resources
+func rangeMaterials(fn func(name string, mat material.IMaterial)) {
+	resourceMutex.RLock()
+	defer resourceMutex.RUnlock()
+
+	for name, mat := range resource.Manager().Materials() {
+		fn(name, mat)
+	}
+}
@@ -0,0 +1,89 @@
+package render
+
+import (
+	"math"
+
+	"github.com/emily33901/lambda-core/core/material"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// previewMaterial is the material that preview meshes are composed with.
+// DrawPreview binds its own texture so it is never looked up
+const previewMaterial = "editor/preview"
+
+func newPreviewMeshHelper() *MeshHelper {
+	helper := NewMeshHelper()
+	helper.Mesh().SetMaterial(material.NewMaterial(previewMaterial, material.NewProperties()))
+
+	return helper
+}
+
+// addPreviewVertex adds a white vertex to a preview mesh
+func addPreviewVertex(helper *MeshHelper, position mgl32.Vec3, normal mgl32.Vec3, uv mgl32.Vec2) {
+	m := helper.Mesh()
+	m.AddVertex(position)
+	m.AddNormal(normal)
+	m.AddUV(uv)
+	m.AddColor(1, 1, 1, 1)
+}
+
+// NewPreviewSphere builds a uv sphere for previewing materials on
+func NewPreviewSphere(radius float32, rings int, segments int) *MeshHelper {
+	helper := newPreviewMeshHelper()
+
+	point := func(ring int, segment int) (mgl32.Vec3, mgl32.Vec2) {
+		theta := math.Pi * float64(ring) / float64(rings)
+		phi := 2 * math.Pi * float64(segment) / float64(segments)
+
+		normal := mgl32.Vec3{
+			float32(math.Sin(theta) * math.Cos(phi)),
+			float32(math.Sin(theta) * math.Sin(phi)),
+			float32(math.Cos(theta)),
+		}
+		uv := mgl32.Vec2{float32(segment) / float32(segments), float32(ring) / float32(rings)}
+
+		return normal, uv
+	}
+
+	// Triangles are wound clockwise when seen from outside, which the renderer treats as the front
+	for ring := 0; ring < rings; ring++ {
+		for segment := 0; segment < segments; segment++ {
+			n00, uv00 := point(ring, segment)
+			n01, uv01 := point(ring, segment+1)
+			n10, uv10 := point(ring+1, segment)
+			n11, uv11 := point(ring+1, segment+1)
+
+			for _, v := range []struct {
+				n  mgl32.Vec3
+				uv mgl32.Vec2
+			}{{n00, uv00}, {n11, uv11}, {n10, uv10}, {n00, uv00}, {n01, uv01}, {n11, uv11}} {
+				addPreviewVertex(helper, v.n.Mul(radius), v.n, v.uv)
+			}
+		}
+	}
+
+	return helper
+}
+
+// NewPreviewPlane builds a square facing up the z axis for previewing materials on
+func NewPreviewPlane(size float32) *MeshHelper {
+	helper := newPreviewMeshHelper()
+
+	half := size / 2
+	up := mgl32.Vec3{0, 0, 1}
+	corners := []struct {
+		position mgl32.Vec3
+		uv       mgl32.Vec2
+	}{
+		{mgl32.Vec3{-half, -half, 0}, mgl32.Vec2{0, 1}},
+		{mgl32.Vec3{half, -half, 0}, mgl32.Vec2{1, 1}},
+		{mgl32.Vec3{half, half, 0}, mgl32.Vec2{1, 0}},
+		{mgl32.Vec3{-half, half, 0}, mgl32.Vec2{0, 0}},
+	}
+
+	for _, i := range []int{0, 2, 1, 0, 3, 2} {
+		addPreviewVertex(helper, corners[i].position, up, corners[i].uv)
+	}
+
+	return helper
+}
@@ -1,10 +1,12 @@
 package render
 
 import (
+	"github.com/emily33901/go-forgery/formats"
 	"github.com/emily33901/go-forgery/render/cache"
 	"github.com/emily33901/gosigl"
 	"github.com/emily33901/lambda-core/core/entity"
 	"github.com/go-gl/gl/v3.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
 )
 
 var (
@@ -25,6 +27,30 @@ var (
 	}
 )
 
+// How faces with tool materials are drawn in a view
+const (
+	ToolTexturesShow = iota
+	ToolTexturesGhost
+	ToolTexturesHide
+)
+
+var ToolTextureModes = [...]string{
+	"Show",
+	"Ghost",
+	"Hide",
+}
+
+const (
+	// ghostAlpha is how see through ghosted tool faces are
+	ghostAlpha = 0.2
+
+	// triggerAlpha is how see through triggers and clips are so that what they surround still shows
+	triggerAlpha = 0.5
+)
+
+// Faces with these flags are drawn after everything else
+const translucentSurfaces = formats.SurfaceTranslucent | formats.SurfaceTrigger | formats.SurfaceClip
+
 type Renderer struct {
 	adapter Adapter
 
@@ -52,12 +78,13 @@ func (renderer *Renderer) StartFrame() {
 }
 
 func (renderer *Renderer) BindCamera(cam *entity.Camera, aspectRatio float32) {
-	model := cam.ModelMatrix()
-	view := cam.ViewMatrix()
-	proj := cam.ProjectionMatrix(aspectRatio)
-
 	renderer.Fov = cam.Fov()
 
+	renderer.BindMatrices(cam.ModelMatrix(), cam.ViewMatrix(), cam.ProjectionMatrix(aspectRatio))
+}
+
+// BindMatrices sends the matrices of something that is not a camera (like a preview) to every shader
+func (renderer *Renderer) BindMatrices(model mgl32.Mat4, view mgl32.Mat4, proj mgl32.Mat4) {
 	for i, s := range renderer.shaders {
 		s.UseProgram()
 
@@ -102,6 +129,44 @@ func (renderer *Renderer) endRender(renderType int) {
 	}
 }
 
+// bindMaterial binds the textures of a material and sends how its proxies want it drawn this frame
+func (renderer *Renderer) bindMaterial(name string, renderType int) {
+	renderer.bindMaterialAlpha(name, renderType, 1)
+}
+
+// bindMaterialAlpha binds a material that is faded by alpha on top of its own tint
+func (renderer *Renderer) bindMaterialAlpha(name string, renderType int, alpha float32) {
+	if tex, ok := cache.LookupTextureNoLoad(name); ok {
+		gosigl.BindTexture2D(gosigl.TextureSlot(0), tex)
+	}
+
+	if renderType != ModeTextured {
+		return
+	}
+
+	state := cache.LookupMaterialState(name)
+	state.Tint[3] *= alpha
+
+	renderer.sendMaterialState(state)
+}
+
+// sendMaterialState binds the animated texture of a material and sends how it is transformed and tinted
+func (renderer *Renderer) sendMaterialState(state cache.MaterialState) {
+	uniforms := renderer.uniforms[ModeTextured]
+
+	if state.Animated != 0 {
+		gl.ActiveTexture(gl.TEXTURE1)
+		gl.BindTexture(gl.TEXTURE_2D_ARRAY, uint32(state.Animated))
+		gl.ActiveTexture(gl.TEXTURE0)
+	}
+
+	renderer.adapter.SendUniformBool(uniforms["albedoIsArray"], state.Animated != 0)
+	renderer.adapter.SendUniformFloat(uniforms["albedoFrame"], &state.Frame)
+	renderer.adapter.SendUniformVec3(uniforms["textureTransformS"], &state.TransformS[0])
+	renderer.adapter.SendUniformVec3(uniforms["textureTransformT"], &state.TransformT[0])
+	renderer.adapter.SendUniformVec4(uniforms["tint"], &state.Tint[0])
+}
+
 func (renderer *Renderer) DrawMeshHelper(mesh *MeshHelper, renderType int) {
 	if mesh == nil || !mesh.Valid() {
 		// If there is nothing to draw then dont try
@@ -116,11 +181,7 @@ func (renderer *Renderer) DrawMeshHelper(mesh *MeshHelper, renderType int) {
 	renderer.beginRender(renderType, false)
 	{
 		for _, matObj := range comp.MaterialMeshes() {
-			if tex, ok := cache.LookupTextureNoLoad(matObj.Material()); ok {
-				gosigl.BindTexture2D(gosigl.TextureSlot(0), tex)
-			}
-
-			//gosigl.BindTexture2D(gosigl.TextureSlot(0), 0)
+			renderer.bindMaterial(matObj.Material(), renderType)
 
 			renderer.adapter.DrawTriangleArray(matObj.Offset(), matObj.Length())
 			renderer.adapter.Error()
@@ -129,7 +190,31 @@ func (renderer *Renderer) DrawMeshHelper(mesh *MeshHelper, renderType int) {
 	renderer.endRender(renderType)
 }
 
-func (renderer *Renderer) DrawComposition(composition *Composition, mesh *gosigl.VertexObject, renderType int) {
+// DrawPreview draws a mesh textured with tex instead of the materials of the mesh
+func (renderer *Renderer) DrawPreview(mesh *MeshHelper, tex gosigl.TextureBindingId, state cache.MaterialState) {
+	if mesh == nil || !mesh.Valid() {
+		return
+	}
+
+	comp, glMesh := mesh.Rebuild()
+
+	gosigl.BindMesh(glMesh)
+	renderer.adapter.Error()
+
+	renderer.beginRender(ModeTextured, true)
+	{
+		gosigl.BindTexture2D(gosigl.TextureSlot(0), tex)
+		renderer.sendMaterialState(state)
+
+		renderer.adapter.DrawTriangleArray(0, int32(len(comp.Vertices)/3))
+		renderer.adapter.Error()
+	}
+	renderer.endRender(ModeTextured)
+}
+
+// DrawComposition draws a composed scene. toolTextures is one of ToolTexturesShow,
+// ToolTexturesGhost or ToolTexturesHide
+func (renderer *Renderer) DrawComposition(composition *Composition, mesh *gosigl.VertexObject, renderType int, toolTextures int) {
 	if mesh == nil {
 		return
 	}
@@ -140,16 +225,50 @@ func (renderer *Renderer) DrawComposition(composition *Composition, mesh *gosigl
 
 		renderer.beginRender(renderType, false)
 		{
+			translucent := make([]*compositionMesh, 0)
+
 			for _, matObj := range composition.MaterialMeshes() {
-				if tex, ok := cache.LookupTextureNoLoad(matObj.Material()); ok {
-					gosigl.BindTexture2D(gosigl.TextureSlot(0), tex)
+				flags := cache.LookupSurfaceFlags(matObj.Material())
+				if flags.Has(formats.SurfaceTool) && toolTextures == ToolTexturesHide {
+					continue
 				}
 
-				//gosigl.BindTexture2D(gosigl.TextureSlot(0), 0)
+				if renderType == ModeTextured &&
+					(flags.Has(translucentSurfaces) || (flags.Has(formats.SurfaceTool) && toolTextures == ToolTexturesGhost)) {
+					translucent = append(translucent, matObj)
+					continue
+				}
+
+				renderer.bindMaterial(matObj.Material(), renderType)
 
 				renderer.adapter.DrawTriangleArray(matObj.Offset(), matObj.Length())
 				renderer.adapter.Error()
 			}
+
+			// Translucent faces go last and do not write depth so that
+			// everything behind them has already been drawn and still shows through
+			if len(translucent) != 0 {
+				gl.DepthMask(false)
+
+				for _, matObj := range translucent {
+					flags := cache.LookupSurfaceFlags(matObj.Material())
+
+					alpha := float32(1)
+					switch {
+					case flags.Has(formats.SurfaceTool) && toolTextures == ToolTexturesGhost:
+						alpha = ghostAlpha
+					case flags.Has(formats.SurfaceTrigger | formats.SurfaceClip):
+						alpha = triggerAlpha
+					}
+
+					renderer.bindMaterialAlpha(matObj.Material(), renderType, alpha)
+
+					renderer.adapter.DrawTriangleArray(matObj.Offset(), matObj.Length())
+					renderer.adapter.Error()
+				}
+
+				gl.DepthMask(true)
+			}
 		}
 		renderer.endRender(renderType)
 	}
@@ -176,7 +295,14 @@ func NewRenderer(adapter Adapter) *Renderer {
 
 		switch i {
 		case ModeTextured:
-			break
+			uniforms["albedoIsArray"] = s.GetUniform("albedoIsArray")
+			uniforms["albedoFrame"] = s.GetUniform("albedoFrame")
+			uniforms["textureTransformS"] = s.GetUniform("textureTransformS")
+			uniforms["textureTransformT"] = s.GetUniform("textureTransformT")
+			uniforms["tint"] = s.GetUniform("tint")
+
+			// Animated textures are bound to the second slot
+			renderer.adapter.SendUniformInt(s.GetUniform("albedoArraySampler"), 1)
 		case ModeWireFrame:
 			uniforms["lineWidth"] = s.GetUniform("lineWidth")
 			uniforms["blendFactor"] = s.GetUniform("blendFactor")
@@ -15,6 +15,13 @@ import (
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+// solidRef is the id of a solid in the map, or the index of a solid
+// in the instances of the scene when instance is set
+type solidRef struct {
+	id       int
+	instance bool
+}
+
 type Scene struct {
 	Solids      map[int]*world.Solid
 	SolidMeshes map[int]*model.Model
@@ -24,6 +31,15 @@ type Scene struct {
 
 	filesystem filesystem.IFileSystem
 
+	// Solids whose uvs were generated before their material was loaded
+	// keyed by the material that they are waiting for
+	pendingSolids  map[string]map[solidRef]struct{}
+	materialLoaded *cache.MaterialListener
+
+	// The contents of func_instances and their meshes, these cannot be selected
+	instanceSolids []*world.Solid
+	instanceModels []*model.Model
+
 	FrameCompositor *render.Compositor
 	FrameComposed   *render.Composition
 	FrameMesh       *gosigl.VertexObject
@@ -46,6 +62,20 @@ func (scene *Scene) Composition() *gosigl.VertexObject {
 	return scene.FrameMesh
 }
 
+// Materials returns the names of the materials in the composed scene
+func (scene *Scene) Materials() map[string]bool {
+	materials := map[string]bool{}
+	if scene.FrameComposed == nil {
+		return materials
+	}
+
+	for _, m := range scene.FrameComposed.MaterialMeshes() {
+		materials[cache.NormaliseMaterialName(m.Material())] = true
+	}
+
+	return materials
+}
+
 func (scene *Scene) RecomposeScene() *gosigl.VertexObject {
 	if scene.FrameMesh != nil {
 		gosigl.DeleteMesh(scene.FrameMesh)
@@ -72,12 +102,176 @@ func (scene *Scene) RecomposeScene() *gosigl.VertexObject {
 func (scene *Scene) AddSolid(solid *world.Solid) {
 	scene.Solids[solid.Id] = solid
 
+	// Hidden solids are tracked but do not get any meshes
+	if solid.Hidden {
+		return
+	}
+
+	scene.SolidMeshes[solid.Id] = scene.addModel(solid, solidRef{id: solid.Id})
+}
+
+// addModel adds the meshes for a solid to the compositor and remembers
+// which materials it has to be rebuilt for once they are loaded
+func (scene *Scene) addModel(solid *world.Solid, ref solidRef) *model.Model {
 	model := convert.SolidToModel(solid, scene.filesystem)
-	scene.SolidMeshes[solid.Id] = model
 
 	for idx := range model.Meshes() {
 		scene.FrameCompositor.AddMesh(model.Meshes()[idx])
 	}
+
+	for idx := range solid.Sides {
+		if !convert.SideHasMaterialDimensions(&solid.Sides[idx]) {
+			name := cache.NormaliseMaterialName(solid.Sides[idx].Material)
+
+			if _, ok := scene.pendingSolids[name]; !ok {
+				scene.pendingSolids[name] = map[solidRef]struct{}{}
+			}
+			scene.pendingSolids[name][ref] = struct{}{}
+		}
+	}
+
+	return model
+}
+
+// removeModel removes the meshes of a model from the compositor
+func (scene *Scene) removeModel(model *model.Model) {
+	for _, m := range model.Meshes() {
+		scene.FrameCompositor.RemoveMesh(m)
+	}
+}
+
+// RemoveSolid removes a solid and its meshes from the scene
+func (scene *Scene) RemoveSolid(id int) {
+	if model, ok := scene.SolidMeshes[id]; ok {
+		scene.removeModel(model)
+	}
+
+	delete(scene.Solids, id)
+	delete(scene.SolidMeshes, id)
+}
+
+// RebuildSolid regenerates the meshes for a solid that has changed
+func (scene *Scene) RebuildSolid(id int) {
+	solid, ok := scene.Solids[id]
+	if !ok {
+		return
+	}
+
+	scene.RemoveSolid(id)
+	scene.AddSolid(solid)
+}
+
+// rebuildInstanceSolid regenerates the meshes for a solid inside of an instance
+func (scene *Scene) rebuildInstanceSolid(index int) {
+	if index >= len(scene.instanceSolids) {
+		return
+	}
+
+	scene.removeModel(scene.instanceModels[index])
+	scene.instanceModels[index] = scene.addModel(scene.instanceSolids[index], solidRef{id: index, instance: true})
+}
+
+// rebuild regenerates the meshes for a solid in the map or in an instance
+func (scene *Scene) rebuild(ref solidRef) {
+	if ref.instance {
+		scene.rebuildInstanceSolid(ref.id)
+	} else {
+		scene.RebuildSolid(ref.id)
+	}
+}
+
+// Update handles any materials that have finished loading since the last frame
+// and regenerates the uvs of the solids that were waiting for them
+func (scene *Scene) Update() {
+	dirty := map[solidRef]struct{}{}
+
+	for _, name := range scene.materialLoaded.Take() {
+		for ref := range scene.pendingSolids[name] {
+			dirty[ref] = struct{}{}
+		}
+		delete(scene.pendingSolids, name)
+	}
+
+	for ref := range dirty {
+		scene.rebuild(ref)
+	}
+}
+
+// MaterialChanged rebuilds the solids (including those in instances) that use a material after it has been reloaded
+func (scene *Scene) MaterialChanged(name string) {
+	name = cache.NormaliseMaterialName(name)
+
+	for id, solid := range scene.Solids {
+		if usesMaterial(solid, name) {
+			scene.RebuildSolid(id)
+		}
+	}
+
+	for index, solid := range scene.instanceSolids {
+		if usesMaterial(solid, name) {
+			scene.rebuildInstanceSolid(index)
+		}
+	}
+}
+
+// usesMaterial is whether any side of a solid has the normalised material name
+func usesMaterial(solid *world.Solid, name string) bool {
+	for idx := range solid.Sides {
+		if cache.NormaliseMaterialName(solid.Sides[idx].Material) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SideFlags returns the surface flags that the material of a side gives it
+func (scene *Scene) SideFlags(solidId int, sideId int) formats.SurfaceFlags {
+	solid, ok := scene.Solids[solidId]
+	if !ok {
+		return 0
+	}
+
+	for idx := range solid.Sides {
+		if solid.Sides[idx].Id == sideId {
+			return cache.LookupSurfaceFlags(solid.Sides[idx].Material)
+		}
+	}
+
+	return 0
+}
+
+// AddInstance adds the contents of an instance to the scene
+func (scene *Scene) AddInstance(instance *formats.Instance) {
+	for _, solid := range instance.Solids() {
+		ref := solidRef{id: len(scene.instanceSolids), instance: true}
+
+		scene.instanceSolids = append(scene.instanceSolids, solid)
+		scene.instanceModels = append(scene.instanceModels, scene.addModel(solid, ref))
+	}
+}
+
+// ClearInstances removes the contents of all instances from the scene
+func (scene *Scene) ClearInstances() {
+	for _, model := range scene.instanceModels {
+		scene.removeModel(model)
+	}
+
+	// The indices of instance solids are reused by the next instances that are added
+	for name, refs := range scene.pendingSolids {
+		for ref := range refs {
+			if ref.instance {
+				delete(refs, ref)
+			}
+		}
+
+		if len(refs) == 0 {
+			delete(scene.pendingSolids, name)
+		}
+	}
+
+	scene.instanceSolids = nil
+	scene.instanceModels = nil
 }
 
 func (scene *Scene) AddCamera(camera *formats.Camera, name string) {
@@ -93,17 +287,24 @@ func (scene *Scene) AddCamera(camera *formats.Camera, name string) {
 }
 
 func (scene *Scene) Close() {
+	cache.UnsubscribeMaterialLoaded(scene.materialLoaded)
 	gosigl.DeleteMesh(scene.FrameMesh)
 }
 
 func NewScene(fs filesystem.IFileSystem) *Scene {
-	return &Scene{
+	s := &Scene{
 		filesystem:      fs,
 		Solids:          map[int]*world.Solid{},
 		SolidMeshes:     map[int]*model.Model{},
 		cameras:         map[string]*entity.Camera{},
+		pendingSolids:   map[string]map[solidRef]struct{}{},
+		materialLoaded:  cache.NewMaterialListener(),
 		FrameCompositor: &render.Compositor{},
 	}
+
+	cache.SubscribeMaterialLoaded(s.materialLoaded)
+
+	return s
 }
 
 func NewSceneFromVmf(fs filesystem.IFileSystem, vmf *formats.Vmf) *Scene {
@@ -115,8 +316,15 @@ func NewSceneFromVmf(fs filesystem.IFileSystem, vmf *formats.Vmf) *Scene {
 		// widget.dispatcher.Dispatch(events.NewEntityCreated(project.Vmf.Entities().Get(i)))
 	}
 
-	for i := range vmf.Worldspawn().Solids {
-		s.AddSolid(&vmf.Worldspawn().Solids[i])
+	for _, solid := range vmf.Worldspawn().Solids {
+		s.AddSolid(solid)
+	}
+
+	// Brush entities are drawn and selected like the world
+	for i := 0; i < vmf.Entities().Length(); i++ {
+		for _, solid := range vmf.EntitySolids(i) {
+			s.AddSolid(solid)
+		}
 	}
 
 	for i := range vmf.Cameras().CameraList {
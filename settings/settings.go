@@ -0,0 +1,282 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultPath is where settings are kept if no other path is given
+const DefaultPath = "settings.json"
+
+// BackupExtension is added to a settings file that could not be loaded when it is moved aside
+const BackupExtension = ".bak"
+
+// GameConfig is a profile for a game that maps can be made for
+type GameConfig struct {
+	Name string
+
+	// GameDir is the directory that contains gameinfo.txt
+	GameDir string
+	FGDs    []string
+
+	// Materials used for new solids and when nothing is selected
+	DefaultMaterial string
+
+	// Compile tools
+	GameExe string
+	BSP     string
+	VIS     string
+	RAD     string
+
+	// MapDir is where compiled maps are put
+	MapDir string
+
+	// FavouriteMaterials are pinned in the materials window
+	FavouriteMaterials []string
+}
+
+const (
+	SpecialNone       = 0
+	SpecialChangeDir  = 256
+	SpecialCopyFile   = 257
+	SpecialDeleteFile = 258
+	SpecialRenameFile = 259
+)
+
+// CompileCommand is a single step of a compile sequence
+type CompileCommand struct {
+	Enabled bool
+
+	// Special is one of the Special constants for built in commands
+	// otherwise Run is run with Params
+	Special int
+	Run     string
+	Params  string
+
+	// EnsureFile is checked to exist after the command has run
+	EnsureCheck bool
+	EnsureFile  string
+
+	UseProcessWindow bool
+	NoWait           bool
+}
+
+// CompileSequence is a named list of commands that are run to compile a map
+type CompileSequence struct {
+	Name     string
+	Commands []*CompileCommand
+}
+
+// Settings are all of the persistent settings
+type Settings struct {
+	ActiveProfile    string
+	Profiles         []*GameConfig
+	CompileSequences []*CompileSequence
+
+	// TextureQuality is how many of the largest mips are left out of textures to save memory
+	TextureQuality int
+	// TextureBudget is how many megabytes of GL memory textures can use, 0 is no limit
+	TextureBudget int
+
+	path string
+	// firstRun is set when there was no settings file to load
+	firstRun bool
+	// keep is set when the file at path could not be loaded or moved aside, so it is not overwritten
+	keep bool
+}
+
+// DefaultProfile is the name of the profile that is made on first run
+const DefaultProfile = "Default"
+
+// Default returns the settings that are used when there is no settings file at path yet.
+// The profile in them is empty as there is no way to know where the game is
+func Default(path string) *Settings {
+	return &Settings{
+		ActiveProfile: DefaultProfile,
+		Profiles: []*GameConfig{
+			{
+				Name: DefaultProfile,
+			},
+		},
+		path: path,
+	}
+}
+
+// Load reads settings from path. If the file does not exist
+// then the default settings are returned
+func Load(path string) (*Settings, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s := Default(path)
+		s.firstRun = true
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Settings{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("unable to read settings from %s: %s", path, err)
+	}
+	s.path = path
+
+	return s, nil
+}
+
+// LoadOrDefault reads settings from path like Load. If they cannot be loaded then the default
+// settings for path are returned along with the error. The file that could not be loaded is moved
+// to path.bak, and if that fails then the default settings will not be saved over it
+func LoadOrDefault(path string) (*Settings, error) {
+	s, err := Load(path)
+	if err == nil {
+		return s, nil
+	}
+
+	s = Default(path)
+
+	backup := path + BackupExtension
+	if renameErr := os.Rename(path, backup); renameErr != nil {
+		s.keep = true
+		return s, fmt.Errorf("%s (settings will not be saved: %s)", err, renameErr)
+	}
+
+	return s, fmt.Errorf("%s (it has been moved to %s)", err, backup)
+}
+
+// Save writes the settings back to where they were loaded from
+func (s *Settings) Save() error {
+	if s.keep {
+		return fmt.Errorf("not saving settings over %s as it could not be loaded", s.path)
+	}
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path, data, 0644)
+}
+
+// FirstRun returns whether there was no settings file when the settings were loaded
+func (s *Settings) FirstRun() bool {
+	return s.firstRun
+}
+
+// Dir returns the directory that the settings file is in.
+// Caches are kept next to it
+func (s *Settings) Dir() string {
+	return filepath.Dir(s.path)
+}
+
+// Profile finds a profile by name
+func (s *Settings) Profile(name string) *GameConfig {
+	for _, p := range s.Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Active returns the active profile or nil if there is not one
+func (s *Settings) Active() *GameConfig {
+	return s.Profile(s.ActiveProfile)
+}
+
+// AddProfile adds a new empty profile with a unique name
+func (s *Settings) AddProfile(name string) *GameConfig {
+	unique := name
+	for i := 1; s.Profile(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+
+	p := &GameConfig{Name: unique}
+	s.Profiles = append(s.Profiles, p)
+
+	return p
+}
+
+// ImportProfile adds an existing profile, renaming it if the name is already used
+func (s *Settings) ImportProfile(config *GameConfig) {
+	name := config.Name
+	for i := 1; s.Profile(config.Name) != nil; i++ {
+		config.Name = fmt.Sprintf("%s %d", name, i)
+	}
+
+	s.Profiles = append(s.Profiles, config)
+}
+
+// ImportCompileSequence adds a compile sequence, replacing any sequence with the same name
+func (s *Settings) ImportCompileSequence(sequence *CompileSequence) {
+	for i, existing := range s.CompileSequences {
+		if existing.Name == sequence.Name {
+			s.CompileSequences[i] = sequence
+			return
+		}
+	}
+
+	s.CompileSequences = append(s.CompileSequences, sequence)
+}
+
+// RemoveProfile removes a profile by name
+func (s *Settings) RemoveProfile(name string) {
+	for i, p := range s.Profiles {
+		if p.Name == name {
+			s.Profiles = append(s.Profiles[:i], s.Profiles[i+1:]...)
+			break
+		}
+	}
+
+	if s.ActiveProfile == name {
+		s.ActiveProfile = ""
+	}
+}
+
+// IsFavouriteMaterial returns whether a material has been marked as a favourite
+func (config *GameConfig) IsFavouriteMaterial(name string) bool {
+	for _, f := range config.FavouriteMaterials {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ToggleFavouriteMaterial adds a material to the favourites or removes it if it is already there
+func (config *GameConfig) ToggleFavouriteMaterial(name string) {
+	for i, f := range config.FavouriteMaterials {
+		if f == name {
+			config.FavouriteMaterials = append(config.FavouriteMaterials[:i], config.FavouriteMaterials[i+1:]...)
+			return
+		}
+	}
+
+	config.FavouriteMaterials = append(config.FavouriteMaterials, name)
+}
+
+// Validate checks that a profile can be used
+func (config *GameConfig) Validate() error {
+	if config.GameDir == "" {
+		return errors.New("no game directory set")
+	}
+
+	info, err := os.Stat(config.GameDir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("game directory %s does not exist", config.GameDir)
+	}
+
+	for _, fgd := range config.FGDs {
+		if _, err := os.Stat(fgd); err != nil {
+			return fmt.Errorf("fgd %s does not exist", fgd)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forgery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		contents string
+
+		err      bool
+		firstRun bool
+		profile  string
+	}{
+		{name: "missing", firstRun: true, profile: DefaultProfile},
+		{name: "valid", contents: `{"ActiveProfile": "CS:GO", "Profiles": [{"Name": "CS:GO"}]}`, profile: "CS:GO"},
+		{name: "broken", contents: `{"ActiveProfile": `, err: true, profile: DefaultProfile},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name, "settings.json")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if test.contents != "" {
+			if err := ioutil.WriteFile(path, []byte(test.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s, err := LoadOrDefault(path)
+		if (err != nil) != test.err {
+			t.Errorf("%s: expected an error to be %v, got %v", test.name, test.err, err)
+		}
+		if s.FirstRun() != test.firstRun || s.ActiveProfile != test.profile {
+			t.Errorf("%s: expected first run %v with profile %s, got %v with %s", test.name,
+				test.firstRun, test.profile, s.FirstRun(), s.ActiveProfile)
+		}
+
+		// Settings are always saved where they were asked to be loaded from
+		if s.Dir() != filepath.Dir(path) {
+			t.Errorf("%s: expected the settings to be in %s, got %s", test.name, filepath.Dir(path), s.Dir())
+		}
+		if err := s.Save(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if _, err := Load(path); err != nil {
+			t.Errorf("%s: expected the saved settings to load, got %v", test.name, err)
+		}
+
+		// The file that could not be loaded is kept
+		backup, err := ioutil.ReadFile(path + BackupExtension)
+		if test.err && string(backup) != test.contents {
+			t.Errorf("%s: expected the broken settings to be kept in %s%s", test.name, path, BackupExtension)
+		}
+		if !test.err && err == nil {
+			t.Errorf("%s: expected no backup to be made", test.name)
+		}
+	}
+}
+
+func TestLoadOrDefaultKeepsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forgery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A directory cannot be read as settings, and it cannot be moved over the backup below
+	path := filepath.Join(dir, "settings.json")
+	for _, d := range []string{path, path + BackupExtension} {
+		if err := os.MkdirAll(filepath.Join(d, "child"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := LoadOrDefault(path)
+	if err == nil {
+		t.Error("expected an error loading a directory")
+	}
+	if err := s.Save(); err == nil {
+		t.Error("expected the settings not to be saved over what could not be loaded")
+	}
+}
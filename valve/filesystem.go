@@ -1,57 +1,45 @@
 package valve
 
 import (
-	"io/ioutil"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/emily33901/lambda-core/lib/vpk"
-
 	"github.com/emily33901/lambda-core/core/filesystem"
 	"github.com/emily33901/lambda-core/core/logger"
 	"github.com/emily33901/lambda-core/core/resource"
 	"github.com/emily33901/lambda-core/lib/gameinfo"
 )
 
+// ValidateGameDir checks that a game directory has a gameinfo.txt
+func ValidateGameDir(gameDir string) error {
+	if _, err := os.Stat(filepath.Join(gameDir, "gameinfo.txt")); err != nil {
+		return fmt.Errorf("%s does not contain a gameinfo.txt", gameDir)
+	}
+
+	return nil
+}
+
 // NewFileSystem builds a new filesystem from a game directory root.
 // It loads a gameinfo.txt and attempts to find listed resourced
 // in it.
-func NewFileSystem(gameDir string) filesystem.IFileSystem {
+func NewFileSystem(gameDir string) (*FileSystem, error) {
+	if err := ValidateGameDir(gameDir); err != nil {
+		return nil, err
+	}
+
 	gameInfo, err := gameinfo.LoadConfig(gameDir)
 	if err != nil {
-		logger.Panic(err)
+		return nil, err
 	}
 
 	// Register GameInfo.txt referenced resource paths
 	// Filesystem module needs to know about all the possible resource
 	// locations it can search.
-	fs := filesystem.CreateFilesystemFromGameInfoDefinitions(gameDir, gameInfo)
-
-	// Make sure to also load the platform dir
-	fs.RegisterLocalDirectory(gameDir + "/../platform")
-
-	// Now try and load all of the vpks that are in those directories
-	for _, x := range fs.EnumerateResourcePaths() {
-		files, err := ioutil.ReadDir(x)
-
-		if err != nil {
-			// panic(err)
-			continue
-		}
-
-		for _, f := range files {
-			if strings.HasSuffix(f.Name(), "_dir.vpk") {
-				nameNoSuffix := x + "/" + f.Name()[:len(f.Name())-8]
-				v, err := vpk.OpenVPK(nameNoSuffix)
-
-				if err != nil {
-					panic(err)
-				}
-
-				fs.RegisterVpk(nameNoSuffix, v)
-			}
-		}
-
-		// TODO: we also need to load all the vpks that arent part of a dir pack
+	fs := NewMountedFileSystem()
+	if err := MountGameInfo(fs, gameDir, gameInfo); err != nil {
+		return nil, err
 	}
 
 	// Explicity define fallbacks for missing resources
@@ -62,7 +50,7 @@ func NewFileSystem(gameDir string) filesystem.IFileSystem {
 	resource.Manager().SetErrorModelName("models/props/de_dust/du_antenna_A.mdl")
 	resource.Manager().SetErrorTextureName("materials/error.vtf")
 
-	return fs.(*filesystem.FileSystem)
+	return fs, nil
 }
 
 func DumpAllKnownMaterials(fs filesystem.IFileSystem) {
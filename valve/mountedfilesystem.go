@@ -0,0 +1,270 @@
+package valve
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/galaco/bsp/lumps"
+	"github.com/galaco/vpk2"
+)
+
+// Mount is a directory or vpk that has been added to a filesystem
+type Mount struct {
+	// Priority is the order that the mount is searched in, lower is searched first
+	Priority int
+	Path     string
+	Vpk      bool
+
+	// SearchPaths is the gameinfo key (e.g. game+mod) that the mount came from
+	SearchPaths string
+
+	// Custom mounts came from a wildcard search path like custom/*
+	Custom bool
+
+	vpk *vpk.VPK
+}
+
+func (m Mount) String() string {
+	kind := "directory"
+	if m.Vpk {
+		kind = "vpk"
+	}
+
+	return fmt.Sprintf("%d: %s %s (%s)", m.Priority, kind, m.Path, m.SearchPaths)
+}
+
+// Files returns every file in the mount as a normalised path
+func (m Mount) Files() []string {
+	if m.Vpk {
+		paths := m.vpk.Paths()
+		results := make([]string, 0, len(paths))
+		for _, p := range paths {
+			results = append(results, normalisePath(p))
+		}
+		return results
+	}
+
+	results := make([]string, 0)
+	filepath.Walk(m.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		// Directories keep their case so that files can be found again on
+		// case sensitive filesystems
+		if rel, err := filepath.Rel(m.Path, path); err == nil {
+			results = append(results, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return results
+}
+
+// Open opens a file from this mount only
+func (m Mount) Open(path string) (io.Reader, error) {
+	if m.Vpk {
+		if entry := m.vpk.Entry(normalisePath(path)); entry != nil {
+			return entry.Open()
+		}
+		return nil, filesystem.NewFileNotFoundError(path)
+	}
+
+	local, ok := m.localPath(path)
+	if !ok {
+		return nil, filesystem.NewFileNotFoundError(path)
+	}
+
+	data, err := ioutil.ReadFile(local)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// localPath finds a file in a directory mount as it is given and then lowercase
+func (m Mount) localPath(path string) (string, bool) {
+	path = strings.TrimPrefix(filesystem.NormalisePath(path), "/")
+
+	for _, p := range []string{path, strings.ToLower(path)} {
+		local := filepath.Join(m.Path, filepath.FromSlash(p))
+		if info, err := os.Stat(local); err == nil && !info.IsDir() {
+			return local, true
+		}
+	}
+
+	return "", false
+}
+
+func (m Mount) contains(path string) bool {
+	if m.Vpk {
+		return m.vpk.Entry(normalisePath(path)) != nil
+	}
+
+	_, ok := m.localPath(path)
+	return ok
+}
+
+func normalisePath(path string) string {
+	return strings.TrimPrefix(filesystem.NormalisePath(strings.ToLower(path)), "/")
+}
+
+// FileSystem is a filesystem.IFileSystem that searches directories and vpks
+// in the same order that they were mounted in, like the engine does
+type FileSystem struct {
+	pakFile *lumps.Pakfile
+	mounts  []Mount
+}
+
+func NewMountedFileSystem() *FileSystem {
+	return &FileSystem{}
+}
+
+func (fs *FileSystem) mount(m Mount) {
+	m.Priority = len(fs.mounts)
+	fs.mounts = append(fs.mounts, m)
+}
+
+func (fs *FileSystem) unmount(path string) {
+	for i, m := range fs.mounts {
+		if m.Path == path {
+			fs.mounts = append(fs.mounts[:i], fs.mounts[i+1:]...)
+			break
+		}
+	}
+
+	for i := range fs.mounts {
+		fs.mounts[i].Priority = i
+	}
+}
+
+// Mounts returns everything that has been mounted in priority order
+func (fs *FileSystem) Mounts() []Mount {
+	return fs.mounts
+}
+
+// Sources returns the mounts that contain path in priority order,
+// the first one is the one that GetFile will read from
+func (fs *FileSystem) Sources(path string) []Mount {
+	results := make([]Mount, 0)
+	for _, m := range fs.mounts {
+		if m.contains(path) {
+			results = append(results, m)
+		}
+	}
+
+	return results
+}
+
+// IsStock returns whether a file is read from one of the games own vpks.
+// Files that are overridden by loose files or custom content are not stock
+func (fs *FileSystem) IsStock(path string) bool {
+	for _, m := range fs.mounts {
+		if m.contains(path) {
+			return m.Vpk && !m.Custom
+		}
+	}
+
+	return false
+}
+
+// ModTime returns when a file was last changed. Files in vpks use the time of the vpk
+func (fs *FileSystem) ModTime(path string) (time.Time, bool) {
+	for _, m := range fs.mounts {
+		if !m.contains(path) {
+			continue
+		}
+
+		local := m.Path
+		if !m.Vpk {
+			local, _ = m.localPath(path)
+		}
+
+		info, err := os.Stat(local)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return info.ModTime(), true
+	}
+
+	return time.Time{}, false
+}
+
+func (fs *FileSystem) PakFile() *lumps.Pakfile {
+	return fs.pakFile
+}
+
+func (fs *FileSystem) RegisterPakFile(pakFile *lumps.Pakfile) {
+	fs.pakFile = pakFile
+}
+
+func (fs *FileSystem) UnregisterPakFile() {
+	fs.pakFile = nil
+}
+
+func (fs *FileSystem) RegisterVpk(path string, vpkFile *vpk.VPK) {
+	fs.mount(Mount{Path: path, Vpk: true, vpk: vpkFile})
+}
+
+func (fs *FileSystem) RegisterLocalDirectory(directory string) {
+	fs.mount(Mount{Path: directory})
+}
+
+func (fs *FileSystem) UnregisterLocalDirectory(directory string) {
+	fs.unmount(directory)
+}
+
+func (fs *FileSystem) EnumerateResourcePaths() []string {
+	results := make([]string, 0, len(fs.mounts))
+	for _, m := range fs.mounts {
+		results = append(results, m.Path)
+	}
+
+	return results
+}
+
+// GetFile reads a file from the pakfile or the highest priority mount that has it
+func (fs *FileSystem) GetFile(filename string) (io.Reader, error) {
+	if fs.pakFile != nil {
+		f, err := fs.pakFile.GetFile(normalisePath(filename))
+		if err == nil && len(f) != 0 {
+			return bytes.NewReader(f), nil
+		}
+	}
+
+	for _, m := range fs.mounts {
+		if r, err := m.Open(filename); err == nil {
+			return r, nil
+		}
+	}
+
+	return nil, filesystem.NewFileNotFoundError(filename)
+}
+
+// AllPaths returns every file that can be read from the filesystem
+func (fs *FileSystem) AllPaths() []string {
+	seen := map[string]struct{}{}
+	results := make([]string, 0)
+
+	for _, m := range fs.mounts {
+		for _, f := range m.Files() {
+			key := strings.ToLower(f)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				results = append(results, f)
+			}
+		}
+	}
+	sort.Strings(results)
+
+	return results
+}
@@ -0,0 +1,239 @@
+package valve
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	keyvalues "github.com/galaco/KeyValues"
+	"github.com/galaco/vpk2"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// searchPathEntry is a single line from the SearchPaths block of a gameinfo.txt
+type searchPathEntry struct {
+	keys string
+	path string
+}
+
+func readSearchPaths(gameInfo *keyvalues.KeyValue) ([]searchPathEntry, error) {
+	node := gameInfo
+	for _, key := range []string{"GameInfo", "FileSystem", "SearchPaths"} {
+		// The root may already be GameInfo
+		if strings.EqualFold(node.Key(), key) {
+			continue
+		}
+
+		child, err := node.Find(key)
+		if err != nil {
+			return nil, errors.New("gameinfo.txt does not contain any search paths")
+		}
+		node = child
+	}
+
+	children, err := node.Children()
+	if err != nil {
+		return nil, errors.New("gameinfo.txt does not contain any search paths")
+	}
+
+	entries := make([]searchPathEntry, 0, len(children))
+	for _, c := range children {
+		entries = append(entries, searchPathEntry{
+			keys: strings.ToLower(c.Key()),
+			path: strings.Trim(strings.TrimSpace(formats.KeyValueString(c)), "\""),
+		})
+	}
+
+	return entries, nil
+}
+
+// wantsSearchPath returns whether a search path holds content that we care about
+func wantsSearchPath(keys string) bool {
+	for _, k := range strings.Split(keys, "+") {
+		switch k {
+		case "game", "mod", "platform", "game_write", "default_write_path", "vpk":
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandSearchPath turns a gameinfo search path into a real path
+func expandSearchPath(path string, gameDir string, baseDir string) string {
+	lower := strings.ToLower(path)
+
+	switch {
+	case strings.HasPrefix(lower, "|gameinfo_path|"):
+		path = filepath.Join(gameDir, path[len("|gameinfo_path|"):])
+	case strings.HasPrefix(lower, "|all_source_engine_paths|"):
+		path = filepath.Join(baseDir, path[len("|all_source_engine_paths|"):])
+	case !filepath.IsAbs(path):
+		path = filepath.Join(baseDir, path)
+	}
+
+	return filepath.Clean(path)
+}
+
+// openVpk opens a single file or multi part vpk. Broken archives can panic
+// inside of the vpk library so that is turned into an error too
+func openVpk(path string) (v *vpk.VPK, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s is corrupt: %v", path, r)
+		}
+	}()
+
+	if strings.HasSuffix(path, "_dir.vpk") {
+		return vpk.Open(vpk.MultiVPK(strings.TrimSuffix(path, "_dir.vpk")))
+	}
+
+	return vpk.Open(vpk.SingleVPK(path))
+}
+
+type mounter struct {
+	fs      *FileSystem
+	mounted map[string]bool
+
+	// custom is set while mounting the contents of a wildcard path
+	custom bool
+}
+
+func (m *mounter) mountDirectory(path string, keys string) {
+	if m.mounted[path] {
+		return
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return
+	}
+
+	m.mounted[path] = true
+	m.fs.mount(Mount{Path: path, SearchPaths: keys, Custom: m.custom})
+
+	// Any multi part vpks that live in the directory are mounted after it
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(strings.ToLower(f.Name()), "_dir.vpk") {
+			m.mountVpk(filepath.Join(path, f.Name()), keys)
+		}
+	}
+}
+
+func (m *mounter) mountVpk(path string, keys string) {
+	// pak01.vpk in gameinfo means pak01_dir.vpk on disk
+	if _, err := os.Stat(path); err != nil {
+		multi := strings.TrimSuffix(path, ".vpk") + "_dir.vpk"
+		if _, err := os.Stat(multi); err != nil {
+			return
+		}
+		path = multi
+	}
+
+	if m.mounted[path] {
+		return
+	}
+	m.mounted[path] = true
+
+	v, err := openVpk(path)
+	if err != nil {
+		logger.Warn("Unable to mount %s: %s", path, err)
+		return
+	}
+
+	m.fs.mount(Mount{Path: path, Vpk: true, SearchPaths: keys, Custom: m.custom, vpk: v})
+}
+
+// mountWildcard mounts everything inside of a custom/* style path
+func (m *mounter) mountWildcard(dir string, keys string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return strings.ToLower(files[i].Name()) < strings.ToLower(files[j].Name()) })
+
+	m.custom = true
+	defer func() { m.custom = false }()
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		lower := strings.ToLower(f.Name())
+
+		switch {
+		case f.IsDir():
+			m.mountDirectory(path, keys)
+		case strings.HasSuffix(lower, "_dir.vpk"):
+			m.mountVpk(path, keys)
+		case strings.HasSuffix(lower, ".vpk") && !isVpkArchivePart(lower):
+			m.mountVpk(path, keys)
+		}
+	}
+}
+
+// isVpkArchivePart returns whether a file is one of the numbered parts of a multi part vpk
+func isVpkArchivePart(name string) bool {
+	name = strings.TrimSuffix(name, ".vpk")
+	i := strings.LastIndex(name, "_")
+	if i == -1 {
+		return false
+	}
+
+	_, err := strconv.Atoi(name[i+1:])
+	return err == nil
+}
+
+// MountGameInfo adds all of the search paths from a gameinfo.txt to fs
+func MountGameInfo(fs *FileSystem, gameDir string, gameInfo *keyvalues.KeyValue) error {
+	gameDir, err := filepath.Abs(gameDir)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(gameDir)
+
+	entries, err := readSearchPaths(gameInfo)
+	if err != nil {
+		return err
+	}
+
+	m := &mounter{
+		fs:      fs,
+		mounted: map[string]bool{},
+	}
+
+	for _, e := range entries {
+		if !wantsSearchPath(e.keys) || e.path == "" {
+			continue
+		}
+
+		path := filepath.FromSlash(strings.Replace(e.path, "\\", "/", -1))
+
+		switch {
+		case strings.HasSuffix(path, string(filepath.Separator)+"*"):
+			m.mountWildcard(expandSearchPath(strings.TrimSuffix(path, "*"), gameDir, baseDir), e.keys)
+		case strings.HasSuffix(strings.ToLower(path), ".vpk"):
+			m.mountVpk(expandSearchPath(path, gameDir, baseDir), e.keys)
+		default:
+			m.mountDirectory(expandSearchPath(path, gameDir, baseDir), e.keys)
+		}
+	}
+
+	// Make sure to also load the platform dir
+	m.mountDirectory(filepath.Join(baseDir, "platform"), "platform")
+
+	for _, mount := range fs.Mounts() {
+		logger.Notice("Mounted %s", mount)
+	}
+
+	return nil
+}
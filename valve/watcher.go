@@ -0,0 +1,166 @@
+package valve
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+// How long a file has to stop changing for before it is reported.
+// Exporters tend to write files in a few goes
+const watcherSettleTime = 300 * time.Millisecond
+
+// How often directories are walked when they cannot be watched natively
+const watcherPollInterval = time.Second
+
+// watchRoot is a directory that is being watched and the mount that it belongs to
+type watchRoot struct {
+	mount string
+	dir   string
+}
+
+// Watcher reports files that change inside of the directory mounts of a filesystem
+type Watcher struct {
+	roots   []watchRoot
+	raw     chan string
+	changes chan string
+	done    chan struct{}
+}
+
+// NewWatcher watches subdir (e.g. materials) of every directory mount in fs.
+// Changes are reported as filesystem paths like materials/foo/bar.vtf
+func NewWatcher(fs *FileSystem, subdir string) *Watcher {
+	w := &Watcher{
+		raw:     make(chan string, 1024),
+		changes: make(chan string, 1024),
+		done:    make(chan struct{}),
+	}
+
+	for _, m := range fs.Mounts() {
+		if m.Vpk {
+			continue
+		}
+
+		dir := filepath.Join(m.Path, subdir)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			w.roots = append(w.roots, watchRoot{mount: m.Path, dir: dir})
+		}
+	}
+
+	if err := w.watchNative(); err != nil {
+		logger.Warn("Unable to watch for file changes (%s), polling instead", err)
+		go w.poll()
+	}
+
+	go w.settle()
+
+	return w
+}
+
+// Changes returns the channel that changed files are sent down
+func (w *Watcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops watching for changes
+func (w *Watcher) Close() {
+	close(w.done)
+}
+
+// report converts a path on disk into a filesystem path and queues it
+func (w *Watcher) report(root watchRoot, path string) {
+	rel, err := filepath.Rel(root.mount, path)
+	if err != nil {
+		return
+	}
+
+	select {
+	case w.raw <- normalisePath(filepath.ToSlash(rel)):
+	default:
+		logger.Warn("Too many file changes, dropping %s", rel)
+	}
+}
+
+// settle waits for files to stop changing before sending them on
+func (w *Watcher) settle() {
+	pending := map[string]time.Time{}
+	ticker := time.NewTicker(watcherSettleTime / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case path := <-w.raw:
+			pending[path] = time.Now()
+		case now := <-ticker.C:
+			for path, changed := range pending {
+				if now.Sub(changed) < watcherSettleTime {
+					continue
+				}
+
+				select {
+				case w.changes <- path:
+					delete(pending, path)
+				default:
+				}
+			}
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func (w *Watcher) snapshot(root watchRoot) map[string]fileState {
+	files := map[string]fileState{}
+
+	filepath.Walk(root.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files[path] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+
+	return files
+}
+
+// poll walks the watched directories looking for files that have changed
+func (w *Watcher) poll() {
+	states := make([]map[string]fileState, len(w.roots))
+	for i, root := range w.roots {
+		states[i] = w.snapshot(root)
+	}
+
+	ticker := time.NewTicker(watcherPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		for i, root := range w.roots {
+			files := w.snapshot(root)
+
+			for path, state := range files {
+				if old, ok := states[i][path]; !ok || old != state {
+					w.report(root, path)
+				}
+			}
+			for path := range states[i] {
+				if _, ok := files[path]; !ok {
+					w.report(root, path)
+				}
+			}
+
+			states[i] = files
+		}
+	}
+}
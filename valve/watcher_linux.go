@@ -0,0 +1,97 @@
+package valve
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// watchNative uses inotify to watch every directory under the roots
+func (w *Watcher) watchNative() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+
+	watches := map[int32]string{}
+	owners := map[string]watchRoot{}
+
+	addTree := func(root watchRoot, dir string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+
+			watches[int32(wd)] = path
+			owners[path] = root
+			return nil
+		})
+	}
+
+	for _, root := range w.roots {
+		if err := addTree(root, root.dir); err != nil {
+			syscall.Close(fd)
+			return err
+		}
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+
+		buffer := make([]byte, 64*1024)
+		for {
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+
+			n, err := syscall.Read(fd, buffer)
+			if err != nil || n <= 0 {
+				// Nothing to read yet
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+				nameBytes := buffer[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+				dir, ok := watches[event.Wd]
+				if !ok {
+					continue
+				}
+
+				name := string(nameBytes)
+				for len(name) > 0 && name[len(name)-1] == 0 {
+					name = name[:len(name)-1]
+				}
+				path := filepath.Join(dir, name)
+				root := owners[dir]
+
+				if event.Mask&syscall.IN_ISDIR != 0 {
+					// New directories need watching too
+					if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+						addTree(root, path)
+					}
+					continue
+				}
+
+				w.report(root, path)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package valve
+
+import "errors"
+
+// watchNative is only implemented for linux, everything else polls
+func (w *Watcher) watchNative() error {
+	return errors.New("native file watching is not supported on this platform")
+}
@@ -0,0 +1,114 @@
+package world
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/galaco/vmf"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// dispVectorRows are the rows of a dispinfo that hold a direction for every vertex
+var dispVectorRows = [...]string{"normals", "offsets", "offset_normals"}
+
+// CloneNode makes a deep copy of a vmf block
+func CloneNode(node *vmf.Node) vmf.Node {
+	var clone vmf.Node
+	*clone.GetKey() = *node.GetKey()
+
+	for _, v := range *node.GetAllValues() {
+		if child, ok := v.(vmf.Node); ok {
+			v = CloneNode(&child)
+		}
+		*clone.GetAllValues() = append(*clone.GetAllValues(), v)
+	}
+
+	return clone
+}
+
+func cloneNodes(nodes []vmf.Node) []vmf.Node {
+	if nodes == nil {
+		return nil
+	}
+
+	clones := make([]vmf.Node, len(nodes))
+	for i := range nodes {
+		clones[i] = CloneNode(&nodes[i])
+	}
+
+	return clones
+}
+
+// formatDispFloat formats a displacement value, dropping the noise that rotating leaves behind
+func formatDispFloat(f float32) string {
+	if f > -1e-6 && f < 1e-6 {
+		f = 0
+	}
+
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+// transformDisplacements moves the start position of the displacements on a side with point
+// and turns the direction of each of their vertices with direction
+func (side *Side) transformDisplacements(point func(mgl32.Vec3) mgl32.Vec3, direction func(mgl32.Vec3) mgl32.Vec3) {
+	for i := range side.Blocks {
+		if *side.Blocks[i].GetKey() != "dispinfo" {
+			continue
+		}
+
+		for _, v := range *side.Blocks[i].GetAllValues() {
+			child, ok := v.(vmf.Node)
+			if !ok {
+				continue
+			}
+
+			key := *child.GetKey()
+			if key == "startposition" {
+				values := child.GetAllValues()
+				if s, ok := (*values)[0].(string); ok {
+					p := point(NewVec3FromString(s))
+					(*values)[0] = "[" + formatDispFloat(p[0]) + " " + formatDispFloat(p[1]) + " " + formatDispFloat(p[2]) + "]"
+				}
+				continue
+			}
+
+			for _, rows := range dispVectorRows {
+				if key == rows {
+					transformDispRows(&child, direction)
+				}
+			}
+		}
+	}
+}
+
+// transformDispRows turns every vector in rows of "x y z x y z ..." with direction
+func transformDispRows(rows *vmf.Node, direction func(mgl32.Vec3) mgl32.Vec3) {
+	for _, v := range *rows.GetAllValues() {
+		row, ok := v.(vmf.Node)
+		if !ok {
+			continue
+		}
+
+		values := row.GetAllValues()
+		s, ok := (*values)[0].(string)
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(s)
+		for i := 0; i+2 < len(fields); i += 3 {
+			var vec mgl32.Vec3
+			for c := 0; c < 3; c++ {
+				f, _ := strconv.ParseFloat(fields[i+c], 32)
+				vec[c] = float32(f)
+			}
+
+			vec = direction(vec)
+			for c := 0; c < 3; c++ {
+				fields[i+c] = formatDispFloat(vec[c])
+			}
+		}
+
+		(*values)[0] = strings.Join(fields, " ")
+	}
+}
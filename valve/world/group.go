@@ -0,0 +1,95 @@
+package world
+
+// Group holds solids (and other groups) together so that they are selected as one
+// Members refer to their group through the groupid in their editor block
+type Group struct {
+	Id     int
+	Editor *Editor
+}
+
+func NewGroup(id int, editor *Editor) *Group {
+	return &Group{
+		Id:     id,
+		Editor: editor,
+	}
+}
+
+func (world *World) AddGroup(group *Group) {
+	world.Groups = append(world.Groups, group)
+}
+
+// RemoveGroup removes a group by id, returning the removed group
+func (world *World) RemoveGroup(id int) *Group {
+	for i, g := range world.Groups {
+		if g.Id == id {
+			world.Groups = append(world.Groups[:i], world.Groups[i+1:]...)
+			return g
+		}
+	}
+
+	return nil
+}
+
+// Group finds a group by id
+func (world *World) Group(id int) *Group {
+	for _, g := range world.Groups {
+		if g.Id == id {
+			return g
+		}
+	}
+
+	return nil
+}
+
+// RootGroup follows a chain of nested groups up to the outermost one
+// Returns nil if groupId does not refer to a group
+func (world *World) RootGroup(groupId int) *Group {
+	var root *Group
+
+	// Guard against groups that contain themselves
+	seen := map[int]bool{}
+
+	for group := world.Group(groupId); group != nil && !seen[group.Id]; {
+		seen[group.Id] = true
+		root = group
+
+		if group.Editor == nil {
+			break
+		}
+		group = world.Group(group.Editor.GroupId)
+	}
+
+	return root
+}
+
+// SolidRootGroup returns the outermost group that a solid is in or nil
+func (world *World) SolidRootGroup(solid *Solid) *Group {
+	if solid.Editor == nil || solid.Editor.GroupId == 0 {
+		return nil
+	}
+
+	return world.RootGroup(solid.Editor.GroupId)
+}
+
+// GroupSolids returns the ids of every solid in the same outermost group as
+// the solid with id. If the solid is not in a group then it is the only result
+func (world *World) GroupSolids(id int) []int {
+	solid := world.Solid(id)
+	if solid == nil {
+		return nil
+	}
+
+	root := world.SolidRootGroup(solid)
+	if root == nil {
+		return []int{id}
+	}
+
+	results := make([]int, 0)
+	for _, s := range world.Solids {
+		if r := world.SolidRootGroup(s); r != nil && r.Id == root.Id {
+			results = append(results, s.Id)
+		}
+	}
+
+	return results
+}
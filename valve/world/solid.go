@@ -3,6 +3,7 @@ package world
 import (
 	"fmt"
 
+	"github.com/galaco/vmf"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -10,6 +11,12 @@ type Solid struct {
 	Id     int
 	Sides  []Side
 	Editor *Editor
+
+	// Hidden solids are kept in the map but are not drawn
+	Hidden bool
+
+	// Child blocks that are not understood, kept so that they can be written back out
+	Blocks []vmf.Node
 }
 
 type Side struct {
@@ -21,6 +28,10 @@ type Side struct {
 	Rotation        float32
 	LightmapScale   float32
 	SmoothingGroups bool
+
+	// Child blocks like dispinfo that are not understood, kept so
+	// that they can be written back out
+	Blocks []vmf.Node
 }
 
 type UVTransform struct {
@@ -30,12 +41,21 @@ type UVTransform struct {
 
 type Editor struct {
 	Color             mgl32.Vec3
+	GroupId           int
 	visgroupShown     bool
 	visGroupAutoShown bool
 
 	logicalPos mgl32.Vec2 // only exists on brush entities?
 }
 
+func (editor *Editor) VisgroupShown() bool {
+	return editor.visgroupShown
+}
+
+func (editor *Editor) VisgroupAutoShown() bool {
+	return editor.visGroupAutoShown
+}
+
 type Plane [3]mgl32.Vec3
 
 func NewSolid(id int, sides []Side, editor *Editor) *Solid {
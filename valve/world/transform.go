@@ -0,0 +1,152 @@
+package world
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Clone makes a deep copy of a solid
+func (solid *Solid) Clone() *Solid {
+	sides := make([]Side, len(solid.Sides))
+	copy(sides, solid.Sides)
+	for i := range sides {
+		sides[i].Blocks = cloneNodes(sides[i].Blocks)
+	}
+
+	var editor *Editor
+	if solid.Editor != nil {
+		e := *solid.Editor
+		editor = &e
+	}
+
+	clone := NewSolid(solid.Id, sides, editor)
+	clone.Hidden = solid.Hidden
+	clone.Blocks = cloneNodes(solid.Blocks)
+
+	return clone
+}
+
+// Center returns the center of all the points that make up the solids planes
+func (solid *Solid) Center() mgl32.Vec3 {
+	center := mgl32.Vec3{}
+	count := 0
+
+	for _, side := range solid.Sides {
+		for _, p := range side.Plane {
+			center = center.Add(p)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return center
+	}
+
+	return center.Mul(1 / float32(count))
+}
+
+// Translate moves a solid by offset keeping its textures locked in place
+func (solid *Solid) Translate(offset mgl32.Vec3) {
+	for i := range solid.Sides {
+		side := &solid.Sides[i]
+
+		for j := range side.Plane {
+			side.Plane[j] = side.Plane[j].Add(offset)
+		}
+
+		side.UAxis.shift(-side.UAxis.Axis().Dot(offset))
+		side.VAxis.shift(-side.VAxis.Axis().Dot(offset))
+
+		side.transformDisplacements(func(p mgl32.Vec3) mgl32.Vec3 {
+			return p.Add(offset)
+		}, func(d mgl32.Vec3) mgl32.Vec3 {
+			return d
+		})
+	}
+}
+
+// Rotate rotates a solid around origin keeping its textures locked in place
+func (solid *Solid) Rotate(origin mgl32.Vec3, rotation mgl32.Mat3) {
+	for i := range solid.Sides {
+		side := &solid.Sides[i]
+
+		for j := range side.Plane {
+			side.Plane[j] = rotation.Mul3x1(side.Plane[j].Sub(origin)).Add(origin)
+		}
+
+		side.UAxis.rotate(origin, rotation)
+		side.VAxis.rotate(origin, rotation)
+
+		side.transformDisplacements(func(p mgl32.Vec3) mgl32.Vec3 {
+			return rotation.Mul3x1(p.Sub(origin)).Add(origin)
+		}, rotation.Mul3x1)
+	}
+}
+
+// Axis returns the world space axis of a uv transform
+func (uv *UVTransform) Axis() mgl32.Vec3 {
+	return uv.Transform.Vec3()
+}
+
+// shift moves the texture along its axis by distance world units
+func (uv *UVTransform) shift(distance float32) {
+	if uv.Scale == 0 {
+		return
+	}
+
+	uv.Transform[3] += distance / uv.Scale
+}
+
+func (uv *UVTransform) rotate(origin mgl32.Vec3, rotation mgl32.Mat3) {
+	oldAxis := uv.Axis()
+	newAxis := rotation.Mul3x1(oldAxis)
+
+	uv.Transform = newAxis.Vec4(uv.Transform[3])
+	uv.shift(oldAxis.Dot(origin) - newAxis.Dot(origin))
+}
+
+// RotationFromAngles builds a rotation from rotations (in degrees) around the x, y and z axes
+func RotationFromAngles(angles mgl32.Vec3) mgl32.Mat3 {
+	return mgl32.Rotate3DZ(mgl32.DegToRad(angles.Z())).
+		Mul3(mgl32.Rotate3DY(mgl32.DegToRad(angles.Y()))).
+		Mul3(mgl32.Rotate3DX(mgl32.DegToRad(angles.X())))
+}
+
+// MatrixFromEntityAngles converts entity "angles" (pitch yaw roll in degrees)
+// into a rotation matrix
+func MatrixFromEntityAngles(angles mgl32.Vec3) mgl32.Mat3 {
+	sp, cp := math.Sincos(float64(mgl32.DegToRad(angles.X())))
+	sy, cy := math.Sincos(float64(mgl32.DegToRad(angles.Y())))
+	sr, cr := math.Sincos(float64(mgl32.DegToRad(angles.Z())))
+
+	// Columns are forward, left and up
+	return mgl32.Mat3FromCols(
+		mgl32.Vec3{float32(cp * cy), float32(cp * sy), float32(-sp)},
+		mgl32.Vec3{float32(sr*sp*cy - cr*sy), float32(sr*sp*sy + cr*cy), float32(sr * cp)},
+		mgl32.Vec3{float32(cr*sp*cy + sr*sy), float32(cr*sp*sy - sr*cy), float32(cr * cp)})
+}
+
+// EntityAnglesFromMatrix converts a rotation matrix back into entity angles
+func EntityAnglesFromMatrix(m mgl32.Mat3) mgl32.Vec3 {
+	forward := m.Col(0)
+	left := m.Col(1)
+	up := m.Col(2)
+
+	xyDist := math.Sqrt(float64(forward.X()*forward.X() + forward.Y()*forward.Y()))
+
+	var pitch, yaw, roll float64
+	if xyDist > 0.001 {
+		yaw = math.Atan2(float64(forward.Y()), float64(forward.X()))
+		pitch = math.Atan2(float64(-forward.Z()), xyDist)
+		roll = math.Atan2(float64(left.Z()), float64(up.Z()))
+	} else {
+		yaw = math.Atan2(float64(-left.X()), float64(left.Y()))
+		pitch = math.Atan2(float64(-forward.Z()), xyDist)
+	}
+
+	return mgl32.Vec3{
+		mgl32.RadToDeg(float32(pitch)),
+		mgl32.RadToDeg(float32(yaw)),
+		mgl32.RadToDeg(float32(roll))}
+}
@@ -1,23 +1,54 @@
 package world
 
-import "github.com/galaco/source-tools-common/entity"
+import (
+	"github.com/galaco/source-tools-common/entity"
+	"github.com/galaco/vmf"
+)
 
 type World struct {
 	Keyvalues *entity.Entity
-	Solids    []Solid
+	Solids    []*Solid
+	Groups    []*Group
+
+	// Child blocks that are not understood, kept so that they can be written back out
+	Blocks []vmf.Node
 }
 
 func (world *World) AddSolid(solid *Solid) error {
 	// TODO
 	// Assign an Id to a solid that is unique, and check
-	world.Solids = append(world.Solids, *solid)
+	world.Solids = append(world.Solids, solid)
+
+	return nil
+}
+
+// RemoveSolid removes a solid by id, returning the removed solid
+func (world *World) RemoveSolid(id int) *Solid {
+	for i, s := range world.Solids {
+		if s.Id == id {
+			world.Solids = append(world.Solids[:i], world.Solids[i+1:]...)
+			return s
+		}
+	}
+
+	return nil
+}
+
+// Solid finds a solid by id
+func (world *World) Solid(id int) *Solid {
+	for _, s := range world.Solids {
+		if s.Id == id {
+			return s
+		}
+	}
 
 	return nil
 }
 
-func NewWorld(entityKvs *entity.Entity, solids []Solid) *World {
+func NewWorld(entityKvs *entity.Entity, solids []*Solid, groups []*Group) *World {
 	return &World{
 		Keyvalues: entityKvs,
 		Solids:    solids,
+		Groups:    groups,
 	}
 }
@@ -0,0 +1,215 @@
+package windows
+
+import (
+	"fmt"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/settings"
+	"github.com/emily33901/imgui-go"
+	"github.com/sqweek/dialog"
+)
+
+// ConfigureWindow edits the game configuration profiles
+type ConfigureWindow struct {
+	settings *settings.Settings
+	selected int
+	status   string
+}
+
+func NewConfigureWindow(s *settings.Settings) *ConfigureWindow {
+	window := &ConfigureWindow{
+		settings: s,
+	}
+
+	for i, p := range s.Profiles {
+		if p.Name == s.ActiveProfile {
+			window.selected = i
+		}
+	}
+
+	return window
+}
+
+// SetStatus sets the message shown at the bottom of the window
+func (window *ConfigureWindow) SetStatus(status string) {
+	window.status = status
+}
+
+// pathInput is a text input with a button to browse for a file or directory
+func pathInput(label string, value *string, directory bool) {
+	imgui.InputText(label, value)
+	imgui.SameLine()
+
+	if imgui.Button("...##" + label) {
+		var path string
+		var err error
+
+		if directory {
+			path, err = dialog.Directory().Title(label).Browse()
+		} else {
+			path, err = dialog.File().Title(label).Load()
+		}
+
+		if err == nil {
+			*value = path
+		}
+	}
+}
+
+// Render draws the window. activate is called when a profile should be used
+func (window *ConfigureWindow) Render(shouldOpen *bool, activate func(config *settings.GameConfig) error) {
+	s := window.settings
+
+	if imgui.BeginV("Configure", shouldOpen, imgui.WindowFlagsAlwaysAutoResize) {
+		if window.selected >= len(s.Profiles) {
+			window.selected = len(s.Profiles) - 1
+		}
+
+		preview := ""
+		if window.selected >= 0 {
+			preview = s.Profiles[window.selected].Name
+		}
+
+		if imgui.BeginCombo("Profile", preview) {
+			for i, p := range s.Profiles {
+				if imgui.Selectable(fmt.Sprintf("%s##%d", p.Name, i)) {
+					window.selected = i
+				}
+			}
+			imgui.EndCombo()
+		}
+
+		if imgui.Button("Add") {
+			s.AddProfile("New profile")
+			window.selected = len(s.Profiles) - 1
+		}
+		imgui.SameLine()
+		if imgui.Button("Remove") && window.selected >= 0 {
+			s.RemoveProfile(s.Profiles[window.selected].Name)
+		}
+
+		imgui.SameLine()
+		if imgui.Button("Import GameConfig.txt") {
+			window.importGameConfig()
+		}
+		imgui.SameLine()
+		if imgui.Button("Import CmdSeq.wc") {
+			window.importCmdSeq()
+		}
+
+		imgui.Separator()
+
+		if window.selected >= 0 {
+			p := s.Profiles[window.selected]
+
+			imgui.InputText("Name", &p.Name)
+			pathInput("Game directory", &p.GameDir, true)
+			imgui.InputText("Default material", &p.DefaultMaterial)
+
+			if imgui.TreeNode("FGDs") {
+				for i, fgd := range p.FGDs {
+					imgui.Text(fgd)
+					imgui.SameLine()
+					if imgui.Button(fmt.Sprintf("Remove##fgd%d", i)) {
+						p.FGDs = append(p.FGDs[:i], p.FGDs[i+1:]...)
+						break
+					}
+				}
+
+				if imgui.Button("Add FGD") {
+					if path, err := dialog.File().Filter("Game data file", "fgd").Load(); err == nil {
+						p.FGDs = append(p.FGDs, path)
+					}
+				}
+				imgui.TreePop()
+			}
+
+			if imgui.TreeNode("Compile tools") {
+				pathInput("Game executable", &p.GameExe, false)
+				pathInput("BSP", &p.BSP, false)
+				pathInput("VIS", &p.VIS, false)
+				pathInput("RAD", &p.RAD, false)
+				pathInput("Map output directory", &p.MapDir, true)
+				imgui.TreePop()
+			}
+
+			imgui.Separator()
+
+			if imgui.Button("Use profile") {
+				s.ActiveProfile = p.Name
+
+				if err := activate(p); err != nil {
+					window.status = fmt.Sprintf("Unable to use %s: %s", p.Name, err)
+				} else {
+					window.status = fmt.Sprintf("Using %s", p.Name)
+				}
+			}
+		}
+
+		if imgui.TreeNode(fmt.Sprintf("Compile sequences (%d)", len(s.CompileSequences))) {
+			for i, sequence := range s.CompileSequences {
+				if imgui.TreeNode(fmt.Sprintf("%s##sequence%d", sequence.Name, i)) {
+					for _, c := range sequence.Commands {
+						imgui.Checkbox(fmt.Sprintf("%s %s##%p", c.Run, c.Params, c), &c.Enabled)
+					}
+					imgui.TreePop()
+				}
+			}
+			imgui.TreePop()
+		}
+
+		if imgui.Button("Save") {
+			if err := s.Save(); err != nil {
+				window.status = fmt.Sprintf("Unable to save settings: %s", err)
+			} else {
+				window.status = "Saved settings"
+			}
+		}
+
+		if window.status != "" {
+			imgui.Separator()
+			imgui.PushTextWrapPosV(400)
+			imgui.Text(window.status)
+			imgui.PopTextWrapPos()
+		}
+	}
+	imgui.End()
+}
+
+func (window *ConfigureWindow) importGameConfig() {
+	path, err := dialog.File().Filter("Hammer game configuration", "txt").Load()
+	if err != nil {
+		return
+	}
+
+	configs, err := formats.ImportGameConfig(path)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to import %s: %s", path, err)
+		return
+	}
+
+	for _, c := range configs {
+		window.settings.ImportProfile(c)
+	}
+
+	window.status = fmt.Sprintf("Imported %d profiles", len(configs))
+}
+
+func (window *ConfigureWindow) importCmdSeq() {
+	path, err := dialog.File().Filter("Hammer command sequences", "wc").Load()
+	if err != nil {
+		return
+	}
+
+	sequences, err := formats.ImportCmdSeq(path)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to import %s: %s", path, err)
+		return
+	}
+
+	for _, sequence := range sequences {
+		window.settings.ImportCompileSequence(sequence)
+	}
+
+	window.status = fmt.Sprintf("Imported %d compile sequences", len(sequences))
+}
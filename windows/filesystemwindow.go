@@ -0,0 +1,384 @@
+package windows
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/render/cache"
+	"github.com/emily33901/go-forgery/render/lazy"
+	"github.com/emily33901/go-forgery/valve"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/imgui-go"
+	keyvalues "github.com/galaco/KeyValues"
+	"github.com/sqweek/dialog"
+)
+
+// maxPreviewText stops huge files from being drawn as text
+const maxPreviewText = 64 * 1024
+
+// maxFilterResults stops a short filter from listing the whole filesystem
+const maxFilterResults = 1000
+
+// fileTreeNode is a directory in the file tree of a mount
+type fileTreeNode struct {
+	dirs     map[string]*fileTreeNode
+	dirNames []string
+	files    []string
+}
+
+func newFileTreeNode() *fileTreeNode {
+	return &fileTreeNode{dirs: map[string]*fileTreeNode{}}
+}
+
+func (node *fileTreeNode) add(file string) {
+	parts := strings.Split(file, "/")
+
+	for _, dir := range parts[:len(parts)-1] {
+		child, ok := node.dirs[dir]
+		if !ok {
+			child = newFileTreeNode()
+			node.dirs[dir] = child
+			node.dirNames = append(node.dirNames, dir)
+		}
+		node = child
+	}
+
+	node.files = append(node.files, file)
+}
+
+func (node *fileTreeNode) sort() {
+	sort.Strings(node.dirNames)
+	sort.Strings(node.files)
+
+	for _, child := range node.dirs {
+		child.sort()
+	}
+}
+
+// FileSystemWindow browses the files that the mounted game content provides
+type FileSystemWindow struct {
+	fs *valve.FileSystem
+
+	// Built the first time that the window is shown
+	trees    []*fileTreeNode
+	allPaths []string
+	// winners maps a lowercase path to the priority of the mount that provides it
+	winners map[string]int
+
+	filter string
+
+	selected string
+	mount    int // priority of the mount that selected was read from
+	sources  []valve.Mount
+	data     []byte
+	text     string
+	kv       *keyvalues.KeyValue
+	image    gosigl.TextureBindingId
+	imageW   int
+	imageH   int
+	status   string
+
+	exportOptions formats.PngExportOptions
+}
+
+func NewFileSystemWindow() *FileSystemWindow {
+	return &FileSystemWindow{}
+}
+
+// SetFileSystem changes the filesystem that is being browsed
+func (window *FileSystemWindow) SetFileSystem(fs *valve.FileSystem) {
+	window.clearPreview()
+
+	window.fs = fs
+	window.trees = nil
+	window.allPaths = nil
+	window.winners = nil
+	window.selected = ""
+	window.sources = nil
+}
+
+func (window *FileSystemWindow) buildIndex() {
+	window.winners = map[string]int{}
+	window.trees = make([]*fileTreeNode, 0, len(window.fs.Mounts()))
+
+	for _, m := range window.fs.Mounts() {
+		tree := newFileTreeNode()
+
+		for _, f := range m.Files() {
+			tree.add(f)
+
+			key := strings.ToLower(f)
+			if _, ok := window.winners[key]; !ok {
+				window.winners[key] = m.Priority
+				window.allPaths = append(window.allPaths, f)
+			}
+		}
+
+		tree.sort()
+		window.trees = append(window.trees, tree)
+	}
+
+	sort.Strings(window.allPaths)
+}
+
+func (window *FileSystemWindow) clearPreview() {
+	if window.image != 0 {
+		gosigl.DeleteTextures(window.image)
+	}
+
+	window.image = 0
+	window.data = nil
+	window.text = ""
+	window.kv = nil
+	window.status = ""
+}
+
+// selectFile reads a file from the mount with priority and prepares a preview of it.
+// If priority is -1 then the mount that wins is used
+func (window *FileSystemWindow) selectFile(file string, priority int) {
+	window.clearPreview()
+
+	window.selected = file
+	window.sources = window.fs.Sources(file)
+	if len(window.sources) == 0 {
+		window.status = "File could not be found"
+		return
+	}
+
+	var source *valve.Mount
+	for i := range window.sources {
+		if priority == -1 || window.sources[i].Priority == priority {
+			source = &window.sources[i]
+			break
+		}
+	}
+	if source == nil {
+		window.status = "File could not be found in that mount"
+		return
+	}
+	window.mount = source.Priority
+
+	stream, err := source.Open(file)
+	if err == nil {
+		window.data, err = ioutil.ReadAll(stream)
+	}
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to read %s: %s", file, err)
+		return
+	}
+
+	switch strings.ToLower(path.Ext(file)) {
+	case ".vtf":
+		v, err := formats.ReadVtf(bytes.NewReader(window.data))
+		if err != nil {
+			window.status = fmt.Sprintf("Unable to read vtf: %s", err)
+			return
+		}
+		window.image = cache.CreateTextureFromVtf(v)
+		window.imageW = v.Width()
+		window.imageH = v.Height()
+
+	case ".vmt":
+		window.text = previewText(window.data)
+
+	case ".txt", ".res", ".vdf", ".vmf", ".gi", ".rad", ".vbsp":
+		window.text = previewText(window.data)
+
+		// Only show a tree if it actually parsed as keyvalues
+		if kv, err := formats.ReadKeyValuesFromReader(bytes.NewReader(window.data)); err == nil && kv.HasChildren() {
+			window.kv = kv
+		}
+
+	default:
+		window.status = fmt.Sprintf("No preview for this file (%d bytes)", len(window.data))
+	}
+}
+
+func previewText(data []byte) string {
+	if len(data) > maxPreviewText {
+		return string(data[:maxPreviewText]) + "\n..."
+	}
+
+	return string(data)
+}
+
+func (window *FileSystemWindow) extract() {
+	filename, err := dialog.File().Title("Extract " + path.Base(window.selected)).Save()
+	if err != nil {
+		return
+	}
+
+	if err := ioutil.WriteFile(filename, window.data, 0644); err != nil {
+		window.status = fmt.Sprintf("Unable to extract to %s: %s", filename, err)
+	} else {
+		window.status = fmt.Sprintf("Extracted to %s", filename)
+	}
+}
+
+func (window *FileSystemWindow) renderFile(file string, priority int) {
+	label := path.Base(file)
+	if winner := window.winners[strings.ToLower(file)]; winner != priority {
+		label += fmt.Sprintf(" (overridden by %d)", winner)
+	}
+
+	if imgui.SelectableV(label+"##"+file, window.selected == file && window.mount == priority, 0, imgui.Vec2{}) {
+		window.selectFile(file, priority)
+	}
+}
+
+func (window *FileSystemWindow) renderTree(node *fileTreeNode, priority int) {
+	for _, name := range node.dirNames {
+		if imgui.TreeNode(name) {
+			window.renderTree(node.dirs[name], priority)
+			imgui.TreePop()
+		}
+	}
+
+	for _, file := range node.files {
+		window.renderFile(file, priority)
+	}
+}
+
+func renderKeyValues(kv *keyvalues.KeyValue) {
+	children, _ := kv.Children()
+
+	for i, child := range children {
+		if child.HasChildren() {
+			if imgui.TreeNode(fmt.Sprintf("%s##%d", child.Key(), i)) {
+				renderKeyValues(child)
+				imgui.TreePop()
+			}
+		} else {
+			imgui.Text(fmt.Sprintf("%s = %s", child.Key(), formats.KeyValueString(child)))
+		}
+	}
+}
+
+func (window *FileSystemWindow) renderPreview() {
+	if window.selected == "" {
+		imgui.Text("Select a file to preview it")
+		return
+	}
+
+	imgui.Text(window.selected)
+
+	for _, m := range window.sources {
+		switch {
+		case m.Priority == window.mount:
+			imgui.Text(fmt.Sprintf("Loaded from %s", m))
+		case m.Priority < window.mount:
+			imgui.Text(fmt.Sprintf("Overridden by %s", m))
+		default:
+			imgui.Text(fmt.Sprintf("Overrides %s", m))
+		}
+	}
+
+	if window.data != nil && imgui.Button("Extract...") {
+		window.extract()
+	}
+
+	// Textures are exported through the material loader so they have to be materials
+	// and only the copy that wins can be exported
+	winner := len(window.sources) != 0 && window.sources[0].Priority == window.mount
+	if window.image != 0 && winner && strings.HasPrefix(strings.ToLower(window.selected), "materials/") {
+		imgui.SameLine()
+		if imgui.Button("Export PNG...") {
+			window.status = exportPngs("Export "+path.Base(window.selected), func(dir string) ([]string, error) {
+				return lazy.ExportTexture(window.fs, window.selected, dir, window.exportOptions)
+			})
+		}
+		renderPngExportOptions(&window.exportOptions, false)
+	}
+
+	if window.status != "" {
+		imgui.PushTextWrapPosV(0)
+		imgui.Text(window.status)
+		imgui.PopTextWrapPos()
+	}
+
+	imgui.Separator()
+
+	if window.image != 0 {
+		imgui.Text(fmt.Sprintf("%dx%d", window.imageW, window.imageH))
+
+		// Keep large textures inside of the window
+		size := imgui.Vec2{float32(window.imageW), float32(window.imageH)}
+		if avail := imgui.ContentRegionAvail(); size.X > avail.X && avail.X > 0 {
+			size = imgui.Vec2{avail.X, size.Y * avail.X / size.X}
+		}
+		imgui.Image(cache.OglToImguiTextureId(uint32(window.image)), size)
+	}
+
+	if window.kv != nil {
+		if imgui.TreeNode("KeyValues") {
+			renderKeyValues(window.kv)
+			imgui.TreePop()
+		}
+	}
+
+	if window.text != "" {
+		imgui.Text(window.text)
+	}
+}
+
+func (window *FileSystemWindow) Render(shouldOpen *bool) {
+	if imgui.BeginV("Filesystem", shouldOpen, 0) {
+		if window.fs == nil {
+			imgui.Text("There is no game filesystem mounted")
+			imgui.End()
+			return
+		}
+
+		if window.trees == nil {
+			window.buildIndex()
+		}
+
+		imgui.InputText("Filter", &window.filter)
+
+		avail := imgui.ContentRegionAvail()
+
+		if imgui.BeginChildV("Files", imgui.Vec2{avail.X / 2, 0}, true, 0) {
+			if window.filter != "" {
+				filter := strings.ToLower(window.filter)
+				shown := 0
+
+				for _, f := range window.allPaths {
+					if !strings.Contains(strings.ToLower(f), filter) {
+						continue
+					}
+
+					if shown == maxFilterResults {
+						imgui.Text(fmt.Sprintf("Only showing the first %d results", maxFilterResults))
+						break
+					}
+
+					if imgui.SelectableV(f, window.selected == f, 0, imgui.Vec2{}) {
+						window.selectFile(f, -1)
+					}
+					shown++
+				}
+			} else {
+				for i, m := range window.fs.Mounts() {
+					if imgui.TreeNode(fmt.Sprintf("%s##mount%d", m, i)) {
+						window.renderTree(window.trees[i], m.Priority)
+						imgui.TreePop()
+					}
+				}
+			}
+		}
+		imgui.EndChild()
+
+		imgui.SameLine()
+
+		if imgui.BeginChildV("Preview", imgui.Vec2{0, 0}, true, imgui.WindowFlagsHorizontalScrollbar) {
+			window.renderPreview()
+		}
+		imgui.EndChild()
+	}
+	imgui.End()
+}
@@ -0,0 +1,152 @@
+package windows
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+	"github.com/sqweek/dialog"
+)
+
+// importFormatAutomatic picks DXT1 or DXT5 depending on whether the image has alpha
+const importFormatAutomatic = -1
+
+var importShaders = []string{formats.ShaderLightmappedGeneric, formats.ShaderVertexLitGeneric}
+
+// ImportTextureWindow turns a png or tga into a texture and material in the game
+type ImportTextureWindow struct {
+	source string
+	name   string
+	format int
+	shader string
+
+	options formats.TextureImportOptions
+
+	status string
+}
+
+func NewImportTextureWindow() *ImportTextureWindow {
+	return &ImportTextureWindow{
+		format: importFormatAutomatic,
+		shader: formats.ShaderLightmappedGeneric,
+	}
+}
+
+func importFormatName(format int) string {
+	if format == importFormatAutomatic {
+		return "Automatic (DXT1 or DXT5)"
+	}
+
+	return formats.VtfFormatName(uint32(format))
+}
+
+func (window *ImportTextureWindow) browse() {
+	source, err := dialog.File().Filter("Images", "png", "tga").Title("Import texture").Load()
+	if err != nil {
+		return
+	}
+
+	window.source = source
+	window.status = ""
+
+	// Name it after the file until it is given a better name
+	if window.name == "" {
+		window.name = "custom/" + strings.ToLower(strings.TrimSuffix(filepath.Base(source), filepath.Ext(source)))
+	}
+}
+
+// importTexture returns the name of the material that was made or "" if it failed
+func (window *ImportTextureWindow) importTexture(gameDir string) string {
+	img, err := formats.ReadImage(window.source)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to read %s: %s", window.source, err)
+		return ""
+	}
+
+	options := window.options
+	options.Shader = window.shader
+	options.Format = uint32(window.format)
+	if window.format == importFormatAutomatic {
+		options.Format = formats.VtfFormatDXT1
+		if formats.ImageHasAlpha(img) {
+			options.Format = formats.VtfFormatDXT5
+		}
+	}
+
+	paths, err := formats.ImportTexture(gameDir, window.name, img, options)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to import: %s", err)
+		return ""
+	}
+
+	window.status = fmt.Sprintf("Wrote %s", strings.Join(paths, " and "))
+
+	// The material is named after the vmt without materials/ and the extension
+	return strings.TrimSuffix(strings.TrimPrefix(paths[1], "materials/"), ".vmt")
+}
+
+// Render draws the window. imported is called with the name of each material that is made
+func (window *ImportTextureWindow) Render(gameDir string, shouldOpen *bool, imported func(name string)) {
+	if imgui.BeginV("Import Texture", shouldOpen, imgui.WindowFlagsAlwaysAutoResize) {
+		if imgui.Button("Browse...") {
+			window.browse()
+		}
+		imgui.SameLine()
+		if window.source == "" {
+			imgui.Text("Pick a png or tga to import")
+		} else {
+			imgui.Text(window.source)
+		}
+
+		imgui.InputText("Material name", &window.name)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Where the texture and material go inside of materials, like custom/wall")
+		}
+
+		if imgui.BeginCombo("Format", importFormatName(window.format)) {
+			if imgui.Selectable(importFormatName(importFormatAutomatic)) {
+				window.format = importFormatAutomatic
+			}
+			for _, f := range formats.VtfImportFormats {
+				if imgui.Selectable(importFormatName(int(f))) {
+					window.format = int(f)
+				}
+			}
+			imgui.EndCombo()
+		}
+
+		if imgui.BeginCombo("Shader", window.shader) {
+			for _, s := range importShaders {
+				if imgui.Selectable(s) {
+					window.shader = s
+				}
+			}
+			imgui.EndCombo()
+		}
+
+		imgui.InputText("Surface property", &window.options.SurfaceProp)
+
+		imgui.Checkbox("No mipmaps", &window.options.NoMipmaps)
+		imgui.SameLine()
+		imgui.Checkbox("Normal map", &window.options.NormalMap)
+		imgui.Checkbox("Clamp S", &window.options.ClampS)
+		imgui.SameLine()
+		imgui.Checkbox("Clamp T", &window.options.ClampT)
+		imgui.Checkbox("Translucent", &window.options.Translucent)
+		imgui.SameLine()
+		imgui.Checkbox("Overwrite", &window.options.Overwrite)
+
+		if imgui.Button("Import") && window.source != "" {
+			if name := window.importTexture(gameDir); name != "" {
+				imported(name)
+			}
+		}
+
+		if window.status != "" {
+			imgui.Text(window.status)
+		}
+	}
+	imgui.End()
+}
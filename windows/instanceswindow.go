@@ -0,0 +1,47 @@
+package windows
+
+import (
+	"fmt"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+)
+
+// RenderInstancesWindow lists the func_instances in the map and lets them be opened or collapsed
+func RenderInstancesWindow(shouldOpen *bool, instances []*formats.Instance, loadError string, showInstances *bool,
+	onOpen func(instance *formats.Instance), onCollapse func(instance *formats.Instance)) {
+
+	if imgui.BeginV("Instances", shouldOpen, 0) {
+		imgui.Checkbox("Show instance contents", showInstances)
+
+		if loadError != "" {
+			imgui.PushTextWrapPosV(400)
+			imgui.Text(loadError)
+			imgui.PopTextWrapPos()
+		}
+
+		imgui.Separator()
+
+		for i, instance := range instances {
+			if imgui.TreeNode(fmt.Sprintf("%s (%s)##%d", instance.Name, instance.File, i)) {
+				imgui.Text(fmt.Sprintf("Origin: %v", instance.Origin))
+				imgui.Text(fmt.Sprintf("Angles: %v", instance.Angles))
+
+				for param, value := range instance.Replacements {
+					imgui.Text(fmt.Sprintf("%s = %s", param, value))
+				}
+
+				if imgui.Button("Open") {
+					onOpen(instance)
+				}
+				imgui.SameLine()
+				if imgui.Button("Collapse") {
+					onCollapse(instance)
+				}
+
+				imgui.TreePop()
+			}
+		}
+	}
+	imgui.End()
+}
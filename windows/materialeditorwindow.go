@@ -0,0 +1,435 @@
+package windows
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/render"
+	"github.com/emily33901/go-forgery/render/cache"
+	"github.com/emily33901/go-forgery/render/view"
+	"github.com/emily33901/go-forgery/valve"
+	"github.com/emily33901/gosigl"
+	"github.com/emily33901/imgui-go"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Size of the preview framebuffer
+const materialPreviewSize = 256
+
+// Most textures that the texture picker lists at once
+const texturePickerLimit = 200
+
+// MaterialEditorWindow edits the parameters of a vmt and previews the result
+type MaterialEditorWindow struct {
+	adapter  render.Adapter
+	renderer *render.Renderer
+	fs       *valve.FileSystem
+
+	name   string
+	vmt    *formats.EditableVmt
+	status string
+
+	// Patched materials are saved with everything that they inherit
+	patched bool
+
+	newKey string
+
+	// Which parameter the texture picker is choosing for
+	pickerKey    string
+	pickerFilter string
+	textures     []string
+
+	preview       *view.RenderWindow
+	sphere        *render.MeshHelper
+	plane         *render.MeshHelper
+	usePlane      bool
+	yaw           float32
+	pitch         float32
+	lastMouseDrag imgui.Vec2
+
+	previewTexture     gosigl.TextureBindingId
+	previewTexturePath string
+}
+
+func NewMaterialEditorWindow(adapter render.Adapter, renderer *render.Renderer) *MaterialEditorWindow {
+	return &MaterialEditorWindow{
+		adapter:  adapter,
+		renderer: renderer,
+		sphere:   render.NewPreviewSphere(32, 16, 32),
+		plane:    render.NewPreviewPlane(64),
+		yaw:      45,
+		pitch:    20,
+	}
+}
+
+// SetFileSystem changes the filesystem that materials and textures are read from
+func (window *MaterialEditorWindow) SetFileSystem(fs *valve.FileSystem) {
+	window.fs = fs
+	window.name = ""
+	window.vmt = nil
+	window.textures = nil
+	window.status = ""
+	window.clearPreviewTexture()
+}
+
+// Open loads a material (like custom/wall) into the editor
+func (window *MaterialEditorWindow) Open(name string) {
+	if window.fs == nil || name == "" {
+		return
+	}
+
+	window.name = cache.NormaliseMaterialName(name)
+	window.vmt = nil
+	window.status = ""
+	window.clearPreviewTexture()
+
+	kv, err := formats.ReadVmt("materials/"+window.name+".vmt", window.fs)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to read %s: %s", window.name, err)
+		return
+	}
+
+	window.vmt = formats.NewEditableVmt(kv)
+
+	// The resolved vmt no longer says whether it was a patch so look at the file itself
+	window.patched = false
+	if raw, err := window.fs.GetFile("materials/" + window.name + ".vmt"); err == nil {
+		if original, err := formats.ReadKeyValuesFromReader(raw); err == nil {
+			window.patched = strings.EqualFold(original.Key(), "patch")
+		}
+	}
+}
+
+func (window *MaterialEditorWindow) clearPreviewTexture() {
+	if window.previewTexture != 0 {
+		gosigl.DeleteTextures(window.previewTexture)
+	}
+
+	window.previewTexture = 0
+	window.previewTexturePath = ""
+}
+
+// updatePreviewTexture reads $basetexture again when it has changed
+func (window *MaterialEditorWindow) updatePreviewTexture() {
+	path := ""
+	if p := window.vmt.Param("$basetexture"); p != nil {
+		path = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(p.Value), ".vtf"))
+	}
+
+	if path == window.previewTexturePath {
+		return
+	}
+
+	window.clearPreviewTexture()
+	window.previewTexturePath = path
+
+	if path == "" {
+		return
+	}
+
+	stream, err := window.fs.GetFile("materials/" + path + ".vtf")
+	if err != nil {
+		return
+	}
+
+	v, err := formats.ReadVtf(stream)
+	if err != nil {
+		return
+	}
+
+	window.previewTexture = cache.CreateTextureFromVtf(v)
+}
+
+// RenderPreview draws the material being edited into the preview framebuffer
+func (window *MaterialEditorWindow) RenderPreview() {
+	if window.vmt == nil {
+		return
+	}
+
+	if window.preview == nil {
+		window.preview = view.NewRenderWindow(window.adapter, materialPreviewSize, materialPreviewSize)
+	}
+
+	window.updatePreviewTexture()
+
+	// The sphere is looked at from the side and the plane from above
+	mesh := window.sphere
+	eye, up := mgl32.Vec3{96, 0, 0}, mgl32.Vec3{0, 0, 1}
+	pitch := mgl32.HomogRotate3DY(mgl32.DegToRad(-window.pitch))
+	if window.usePlane {
+		mesh = window.plane
+		eye, up = mgl32.Vec3{0, 0, 96}, mgl32.Vec3{0, 1, 0}
+		pitch = mgl32.HomogRotate3DX(mgl32.DegToRad(window.pitch))
+	}
+
+	model := mgl32.HomogRotate3DZ(mgl32.DegToRad(window.yaw)).Mul4(pitch)
+	viewMatrix := mgl32.LookAtV(eye, mgl32.Vec3{}, up)
+	proj := mgl32.Perspective(mgl32.DegToRad(45), 1, 1, 1024)
+
+	window.renderer.StartFrame()
+	window.renderer.BindMatrices(model, viewMatrix, proj)
+
+	window.preview.Bind(materialPreviewSize, materialPreviewSize)
+	window.renderer.DrawPreview(mesh, window.previewTexture, cache.MaterialStateFromParameters(window.vmt.Parameters()))
+	window.adapter.Error()
+	window.preview.Unbind()
+}
+
+func (window *MaterialEditorWindow) renderPreview() {
+	if window.preview == nil {
+		return
+	}
+
+	imgui.ImageV(cache.OglToImguiTextureId(window.preview.BufferId()),
+		imgui.Vec2{X: materialPreviewSize, Y: materialPreviewSize},
+		imgui.Vec2{X: 0, Y: 1}, imgui.Vec2{X: 1, Y: 0},
+		imgui.Vec4{X: 1, Y: 1, Z: 1, W: 1}, imgui.Vec4{})
+
+	// Dragging the preview spins it around
+	if imgui.IsItemHovered() {
+		drag := imgui.MouseDragDeltaV(0, 0)
+		delta := drag.Minus(window.lastMouseDrag)
+		window.lastMouseDrag = drag
+
+		window.yaw += delta.X / 2
+		window.pitch = mgl32.Clamp(window.pitch+delta.Y/2, -89, 89)
+	} else {
+		window.lastMouseDrag = imgui.Vec2{}
+	}
+
+	if imgui.RadioButton("Sphere", !window.usePlane) {
+		window.usePlane = false
+	}
+	imgui.SameLine()
+	if imgui.RadioButton("Plane", window.usePlane) {
+		window.usePlane = true
+	}
+
+	if window.previewTexture == 0 {
+		imgui.Text("No $basetexture to preview")
+	}
+}
+
+// buildTextures lists every texture in the game once the picker is first opened
+func (window *MaterialEditorWindow) buildTextures() {
+	window.textures = []string{}
+
+	seen := map[string]bool{}
+	for _, f := range window.fs.AllPaths() {
+		f = strings.ToLower(f)
+		if !strings.HasPrefix(f, "materials/") || !strings.HasSuffix(f, ".vtf") {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(f, "materials/"), ".vtf")
+		if !seen[name] {
+			seen[name] = true
+			window.textures = append(window.textures, name)
+		}
+	}
+
+	sort.Strings(window.textures)
+}
+
+func (window *MaterialEditorWindow) renderTexturePicker() {
+	if !imgui.BeginPopup("Pick texture") {
+		return
+	}
+
+	if window.textures == nil {
+		window.buildTextures()
+	}
+
+	imgui.InputText("Filter", &window.pickerFilter)
+	filter := strings.ToLower(window.pickerFilter)
+
+	imgui.BeginChildV("textures", imgui.Vec2{X: 400, Y: 300}, true, 0)
+	shown := 0
+	for _, t := range window.textures {
+		if filter != "" && !strings.Contains(t, filter) {
+			continue
+		}
+
+		if shown == texturePickerLimit {
+			imgui.Text(fmt.Sprintf("Only the first %d textures are shown", texturePickerLimit))
+			break
+		}
+		shown++
+
+		if imgui.Selectable(t) {
+			window.vmt.Set(window.pickerKey, t)
+			imgui.CloseCurrentPopup()
+		}
+	}
+	imgui.EndChild()
+
+	imgui.EndPopup()
+}
+
+// renderParam draws the widget for one parameter. Returns true when it should be removed
+func (window *MaterialEditorWindow) renderParam(p *formats.VmtParam) bool {
+	imgui.PushID(p.Key)
+	defer imgui.PopID()
+
+	remove := imgui.SmallButton("x")
+	imgui.SameLine()
+
+	switch formats.VmtParameterType(p.Key, p.Value) {
+	case formats.VmtTypeBool:
+		v, _ := strconv.ParseFloat(strings.TrimSpace(p.Value), 64)
+		checked := v != 0
+		if imgui.Checkbox(p.Key, &checked) {
+			p.Value = "0"
+			if checked {
+				p.Value = "1"
+			}
+		}
+
+	case formats.VmtTypeInt:
+		v, _ := strconv.ParseFloat(strings.TrimSpace(p.Value), 64)
+		i := int32(v)
+		if imgui.InputInt(p.Key, &i) {
+			p.Value = strconv.Itoa(int(i))
+		}
+
+	case formats.VmtTypeFloat:
+		v, _ := strconv.ParseFloat(strings.TrimSpace(p.Value), 32)
+		f := float32(v)
+		if imgui.DragFloatV(p.Key, &f, 0.01, 0, 0, "%.3f", 1) {
+			p.Value = strconv.FormatFloat(float64(f), 'g', 4, 32)
+		}
+
+	case formats.VmtTypeColour, formats.VmtTypeVector:
+		vector, ok := formats.ParseVmtVector(p.Value)
+		if !ok {
+			// Colours can be written as a single number too
+			v, _ := strconv.ParseFloat(strings.TrimSpace(p.Value), 32)
+			vector = []float32{float32(v), float32(v), float32(v)}
+		}
+
+		changed := false
+		imgui.PushItemWidth(60)
+		for i := range vector {
+			if i != 0 {
+				imgui.SameLine()
+			}
+			if imgui.DragFloatV(fmt.Sprintf("##%d", i), &vector[i], 0.01, 0, 0, "%.3f", 1) {
+				changed = true
+			}
+		}
+		imgui.PopItemWidth()
+		imgui.SameLine()
+		imgui.Text(p.Key)
+
+		if changed {
+			p.Value = formats.FormatVmtVector(vector)
+		}
+
+	case formats.VmtTypeTexture:
+		imgui.InputText(p.Key, &p.Value)
+		imgui.SameLine()
+		if imgui.SmallButton("...") {
+			window.pickerKey = p.Key
+			imgui.OpenPopup("Pick texture")
+		}
+
+	default:
+		imgui.InputText(p.Key, &p.Value)
+	}
+
+	if p.Key == window.pickerKey {
+		window.renderTexturePicker()
+	}
+
+	return remove
+}
+
+func (window *MaterialEditorWindow) renderParams() {
+	imgui.InputText("Shader", &window.vmt.Shader)
+	imgui.Separator()
+
+	removed := ""
+	for _, p := range window.vmt.Params {
+		if window.renderParam(p) {
+			removed = p.Key
+		}
+	}
+	if removed != "" {
+		window.vmt.Remove(removed)
+	}
+
+	imgui.Separator()
+	imgui.InputText("##newparam", &window.newKey)
+	imgui.SameLine()
+	if imgui.Button("Add parameter") {
+		key := strings.TrimSpace(window.newKey)
+		if key != "" && window.vmt.Param(key) == nil {
+			if !strings.HasPrefix(key, "$") && !strings.HasPrefix(key, "%") {
+				key = "$" + key
+			}
+			window.vmt.Set(key, "")
+			window.newKey = ""
+		}
+	}
+
+	if len(window.vmt.Blocks) != 0 {
+		names := make([]string, len(window.vmt.Blocks))
+		for i, b := range window.vmt.Blocks {
+			names[i] = b.Key()
+		}
+		imgui.Text(fmt.Sprintf("Kept as they are: %s", strings.Join(names, ", ")))
+	}
+}
+
+// Render draws the window. saved is called with the name of the material after it is written
+func (window *MaterialEditorWindow) Render(gameDir string, shouldOpen *bool, saved func(name string)) {
+	if imgui.BeginV("Material Editor", shouldOpen, 0) {
+		if window.vmt == nil {
+			if window.status != "" {
+				imgui.Text(window.status)
+			} else {
+				imgui.Text("Select a material to edit it")
+			}
+		} else {
+			window.renderEditor(gameDir, saved)
+		}
+	}
+	imgui.End()
+}
+
+func (window *MaterialEditorWindow) renderEditor(gameDir string, saved func(name string)) {
+	imgui.Text(window.name)
+	if window.patched {
+		imgui.Text("This material patches another, everything that it inherits is saved with it")
+	}
+
+	if imgui.Button("Save") {
+		if path, err := formats.SaveVmt(gameDir, window.name, window.vmt); err != nil {
+			window.status = fmt.Sprintf("Unable to save: %s", err)
+		} else {
+			window.status = fmt.Sprintf("Wrote %s", path)
+			window.patched = false
+			saved(window.name)
+		}
+	}
+	imgui.SameLine()
+	if imgui.Button("Revert") {
+		window.Open(window.name)
+	}
+
+	if window.status != "" {
+		imgui.Text(window.status)
+	}
+
+	imgui.ColumnsV(2, "materialeditor", false)
+
+	window.renderPreview()
+	imgui.NextColumn()
+
+	window.renderParams()
+
+	imgui.Columns()
+}
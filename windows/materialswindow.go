@@ -1,20 +1,395 @@
 package windows
 
 import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
 	"github.com/emily33901/go-forgery/render/cache"
+	"github.com/emily33901/go-forgery/render/lazy"
+	"github.com/emily33901/go-forgery/settings"
+	"github.com/emily33901/go-forgery/valve"
 	"github.com/emily33901/imgui-go"
-	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/emily33901/lambda-core/core/logger"
+)
+
+const (
+	materialSortName = iota
+	materialSortNameDescending
+	materialSortShader
+	materialSortSurfaceProp
 )
 
-func RenderMaterialsWindow(fs filesystem.IFileSystem, shouldOpen *bool, materialSelected func(string)) {
+var materialSortNames = [...]string{
+	materialSortName:           "Name",
+	materialSortNameDescending: "Name (descending)",
+	materialSortShader:         "Shader",
+	materialSortSurfaceProp:    "Surface property",
+}
+
+// MaterialsWindow is a grid of thumbnails for every material in the game
+type MaterialsWindow struct {
+	settings *settings.Settings
+	fs       *valve.FileSystem
+
+	// Filters, an empty string matches anything
+	search         string
+	directory      string
+	shader         string
+	surfaceProp    string
+	keywords       string
+	sortBy         int
+	favouritesOnly bool
+	usedInMapOnly  bool
+
+	mapMaterials map[string]bool
+
+	// The filtered list is only rebuilt when something changes
+	dirty        bool
+	indexedCount int
+	materials    []string
+	directories  []string
+	shaders      []string
+	surfaceProps []string
+
+	selected    string
+	details     *cache.MaterialDetails
+	detailsErr  string
+	detailsInfo *cache.MaterialInfo
+
+	exportOptions formats.PngExportOptions
+	exportStatus  string
+}
+
+func NewMaterialsWindow(s *settings.Settings) *MaterialsWindow {
+	return &MaterialsWindow{
+		settings: s,
+		dirty:    true,
+	}
+}
+
+// SetFileSystem changes the filesystem that details are read from
+func (window *MaterialsWindow) SetFileSystem(fs *valve.FileSystem) {
+	window.fs = fs
+	window.selected = ""
+	window.details = nil
+	window.detailsInfo = nil
+	window.dirty = true
+}
+
+// SetMapMaterials sets the materials that the "used in map" filter shows
+func (window *MaterialsWindow) SetMapMaterials(names []string) {
+	window.mapMaterials = map[string]bool{}
+	for _, name := range names {
+		window.mapMaterials[cache.NormaliseMaterialName(name)] = true
+	}
+
+	window.dirty = true
+}
+
+// searchMatcher returns a function that matches material names against a search.
+// Searches with wildcards are globs over the whole name, anything else matches a substring
+func searchMatcher(search string) func(string) bool {
+	search = strings.ToLower(strings.TrimSpace(search))
+	if search == "" {
+		return func(string) bool { return true }
+	}
+
+	if !strings.ContainsAny(search, "*?") {
+		return func(name string) bool { return strings.Contains(name, search) }
+	}
+
+	pattern := regexp.QuoteMeta(search)
+	pattern = strings.Replace(pattern, `\*`, ".*", -1)
+	pattern = strings.Replace(pattern, `\?`, ".", -1)
+	re := regexp.MustCompile("^" + pattern + "$")
+
+	return re.MatchString
+}
+
+// materialDirectory is the top level directory that a material is in
+func materialDirectory(name string) string {
+	if i := strings.Index(name, "/"); i != -1 {
+		return name[:i]
+	}
+
+	return ""
+}
+
+func hasAnyKeyword(info *cache.MaterialInfo, wanted []string) bool {
+	for _, w := range wanted {
+		for _, k := range info.Keywords {
+			if strings.Contains(k, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// rebuild filters and sorts the materials
+func (window *MaterialsWindow) rebuild(all []string, config *settings.GameConfig) {
+	window.dirty = false
+	window.indexedCount = len(all)
+
+	matches := searchMatcher(window.search)
+
+	wantedKeywords := make([]string, 0)
+	for _, k := range strings.Split(window.keywords, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			wantedKeywords = append(wantedKeywords, k)
+		}
+	}
+
+	directories := map[string]bool{}
+	shaders := map[string]bool{}
+	surfaceProps := map[string]bool{}
+
+	window.materials = window.materials[:0]
+
+	for _, name := range all {
+		info := cache.LookupMaterialInfo(name)
+		if info == nil {
+			info = &cache.MaterialInfo{Name: name}
+		}
+
+		// Choices come from everything so that a filter can always be changed back
+		directories[materialDirectory(name)] = true
+		shaders[info.Shader] = true
+		surfaceProps[info.SurfaceProp] = true
+
+		switch {
+		case !matches(name):
+		case window.directory != "" && materialDirectory(name) != window.directory:
+		case window.shader != "" && info.Shader != window.shader:
+		case window.surfaceProp != "" && info.SurfaceProp != window.surfaceProp:
+		case len(wantedKeywords) > 0 && !hasAnyKeyword(info, wantedKeywords):
+		case window.favouritesOnly && (config == nil || !config.IsFavouriteMaterial(name)):
+		case window.usedInMapOnly && !window.mapMaterials[name]:
+		default:
+			window.materials = append(window.materials, name)
+		}
+	}
+
+	window.directories = sortedKeys(directories)
+	window.shaders = sortedKeys(shaders)
+	window.surfaceProps = sortedKeys(surfaceProps)
+
+	sortKey := func(name string) string { return "" }
+	switch window.sortBy {
+	case materialSortShader:
+		sortKey = func(name string) string {
+			if info := cache.LookupMaterialInfo(name); info != nil {
+				return info.Shader
+			}
+			return ""
+		}
+	case materialSortSurfaceProp:
+		sortKey = func(name string) string {
+			if info := cache.LookupMaterialInfo(name); info != nil {
+				return info.SurfaceProp
+			}
+			return ""
+		}
+	}
+
+	descending := window.sortBy == materialSortNameDescending
+	sort.SliceStable(window.materials, func(i, j int) bool {
+		a, b := window.materials[i], window.materials[j]
+		if ka, kb := sortKey(a), sortKey(b); ka != kb {
+			return ka < kb
+		}
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+// filterCombo is a combo box where the first entry matches anything
+func filterCombo(label string, value *string, choices []string) bool {
+	preview := *value
+	if preview == "" {
+		preview = "Any"
+	}
+
+	changed := false
+	if imgui.BeginCombo(label, preview) {
+		if imgui.Selectable("Any##" + label) {
+			*value = ""
+			changed = true
+		}
+
+		for _, c := range choices {
+			if c == "" {
+				continue
+			}
+			if imgui.Selectable(c) {
+				*value = c
+				changed = true
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	return changed
+}
+
+func (window *MaterialsWindow) renderFilters() {
+	if imgui.InputText("Search", &window.search) {
+		window.dirty = true
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Matches part of a name, or the whole name when it has * or ?")
+	}
+
+	if filterCombo("Directory", &window.directory, window.directories) {
+		window.dirty = true
+	}
+	if filterCombo("Shader", &window.shader, window.shaders) {
+		window.dirty = true
+	}
+	if filterCombo("Surface property", &window.surfaceProp, window.surfaceProps) {
+		window.dirty = true
+	}
+
+	if imgui.InputText("Keywords", &window.keywords) {
+		window.dirty = true
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Comma separated %keywords, any of them can match")
+	}
+
+	if imgui.BeginCombo("Sort", materialSortNames[window.sortBy]) {
+		for i, name := range materialSortNames {
+			if imgui.Selectable(name) {
+				window.sortBy = i
+				window.dirty = true
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	if imgui.Checkbox("Favourites only", &window.favouritesOnly) {
+		window.dirty = true
+	}
+	imgui.SameLine()
+	if imgui.Checkbox("Used in map only", &window.usedInMapOnly) {
+		window.dirty = true
+	}
+}
+
+func (window *MaterialsWindow) selectMaterial(name string) {
+	window.selected = name
+	window.detailsInfo = cache.LookupMaterialInfo(name)
+	window.detailsErr = ""
+	window.exportStatus = ""
+
+	var err error
+	window.details, err = cache.ReadMaterialDetails(window.fs, name)
+	if err != nil {
+		window.detailsErr = err.Error()
+	}
+}
+
+func (window *MaterialsWindow) renderDetails(config *settings.GameConfig) {
+	if window.selected == "" {
+		imgui.Text("Select a material to see its details")
+		return
+	}
+
+	imgui.Text(window.selected)
+
+	if config != nil {
+		label := "Add to favourites"
+		if config.IsFavouriteMaterial(window.selected) {
+			label = "Remove from favourites"
+		}
+
+		imgui.SameLine()
+		if imgui.Button(label) {
+			config.ToggleFavouriteMaterial(window.selected)
+			if err := window.settings.Save(); err != nil {
+				logger.Error("Unable to save settings: %s", err)
+			}
+			window.dirty = true
+		}
+	}
+
+	if info := window.detailsInfo; info != nil {
+		imgui.Text(fmt.Sprintf("Shader: %s", info.Shader))
+		if info.SurfaceProp != "" {
+			imgui.Text(fmt.Sprintf("Surface property: %s", info.SurfaceProp))
+		}
+		if len(info.Keywords) > 0 {
+			imgui.Text(fmt.Sprintf("Keywords: %s", strings.Join(info.Keywords, ", ")))
+		}
+	}
+
+	if details := window.details; details != nil {
+		imgui.Text(fmt.Sprintf("Loaded from %s", details.Source))
+		if details.BaseTexture != "" {
+			imgui.Text(fmt.Sprintf("Base texture: %s", path.Base(details.BaseTexture)))
+		}
+		if details.Width != 0 {
+			imgui.Text(fmt.Sprintf("%dx%d %s", details.Width, details.Height, details.Format))
+		}
+	}
+
+	if window.detailsErr != "" {
+		imgui.Text(window.detailsErr)
+	}
+
+	if imgui.Button("Export PNG...") {
+		window.exportStatus = exportPngs("Export "+window.selected, func(dir string) ([]string, error) {
+			return lazy.ExportMaterial(window.fs, window.selected, dir, window.exportOptions)
+		})
+	}
+	imgui.SameLine()
+	renderPngExportOptions(&window.exportOptions, true)
+
+	if window.exportStatus != "" {
+		imgui.Text(window.exportStatus)
+	}
+}
+
+// Render draws the window. materialSelected is called when a material is clicked
+func (window *MaterialsWindow) Render(shouldOpen *bool, materialSelected func(string)) {
+	cache.UpdateThumbnails()
+
+	config := window.settings.Active()
+
 	if imgui.BeginV("Materials", shouldOpen, 0) {
+		// Indexing adds materials in the background so keep up with it
+		all := cache.GetMaterials()
+		if window.dirty || len(all) != window.indexedCount {
+			window.rebuild(all, config)
+		}
+
+		window.renderFilters()
+		imgui.Text(fmt.Sprintf("%d of %d materials", len(window.materials), len(all)))
+
 		areaAvailable := imgui.ContentRegionAvail()
-		if imgui.BeginChildV("Materials Scrollable", areaAvailable.Minus(imgui.Vec2{0, 100}), false, 0) {
+		if imgui.BeginChildV("Materials Scrollable", areaAvailable.Minus(imgui.Vec2{0, 120}), false, 0) {
 			startCursorPos := imgui.ScrollY()
 			contentSize := imgui.ContentRegionAvail()
 			contentEnd := startCursorPos + contentSize.Y
 
-			const thumbSize = 128
+			const thumbSize = cache.ThumbnailSize
 			const thumbPad = 4
 			const totalSize = thumbSize + thumbPad
 
@@ -24,27 +399,34 @@ func RenderMaterialsWindow(fs filesystem.IFileSystem, shouldOpen *bool, material
 			rowi := 0
 			coli := 0
 
-			// TODO we should be caching these results!!!!
-			materials := cache.GetMaterials()
-
-			for _, k := range materials {
+			for _, k := range window.materials {
 				if float32((rowi+4)*totalSize) > startCursorPos &&
 					float32((rowi-2)*totalSize) < contentEnd {
 
 					imgui.PushID(k)
 					imgui.PushTextWrapPosV(float32((coli + 1) * totalSize))
 					{
-						// Image
+						// Image, thumbnails that are not made yet are asked for
+						// and get drawn once they are ready
 						pos := imgui.CursorPos()
-						imgui.Image(cache.OglToImguiTextureId(uint32(cache.LookupTexture(fs, k))), imgui.Vec2{thumbSize, thumbSize})
+						if tex := cache.LookupThumbnail(k); tex != 0 {
+							imgui.Image(cache.OglToImguiTextureId(uint32(tex)), imgui.Vec2{thumbSize, thumbSize})
+						} else {
+							imgui.Dummy(imgui.Vec2{thumbSize, thumbSize})
+						}
 
 						// Text
 						imgui.SetCursorPos(pos)
-						imgui.Text(k)
+						if config != nil && config.IsFavouriteMaterial(k) {
+							imgui.Text("* " + k)
+						} else {
+							imgui.Text(k)
+						}
 
 						// Selectable
 						imgui.SetCursorPos(pos)
-						if imgui.SelectableV("", false, 0, imgui.Vec2{thumbSize, thumbSize}) {
+						if imgui.SelectableV("", window.selected == k, 0, imgui.Vec2{thumbSize, thumbSize}) {
+							window.selectMaterial(k)
 							materialSelected(k)
 						}
 					}
@@ -69,9 +451,7 @@ func RenderMaterialsWindow(fs filesystem.IFileSystem, shouldOpen *bool, material
 
 		imgui.Separator()
 
-		imgui.Text("wow nice meme")
-		imgui.Text("wow nice meme")
-		imgui.Text("wow nice meme")
+		window.renderDetails(config)
 	}
 	imgui.End()
 }
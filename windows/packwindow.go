@@ -0,0 +1,136 @@
+package windows
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+	"github.com/emily33901/lambda-core/core/filesystem"
+	"github.com/sqweek/dialog"
+)
+
+// PackWindow collects the custom content that a map uses
+type PackWindow struct {
+	files     []*formats.PackFile
+	showStock bool
+	status    string
+}
+
+func NewPackWindow() *PackWindow {
+	return &PackWindow{}
+}
+
+// SetFiles sets the result of a dry run
+func (window *PackWindow) SetFiles(files []*formats.PackFile) {
+	window.files = files
+	window.status = ""
+}
+
+func (window *PackWindow) counts() (pack int, stock int, missing int) {
+	for _, f := range window.files {
+		switch {
+		case f.Missing:
+			missing++
+		case f.Stock:
+			stock++
+		default:
+			pack++
+		}
+	}
+
+	return pack, stock, missing
+}
+
+func (window *PackWindow) packToDirectory(fs filesystem.IFileSystem) {
+	dir, err := dialog.Directory().Title("Pack to folder").Browse()
+	if err != nil {
+		return
+	}
+
+	count, err := formats.WritePackDirectory(fs, window.files, dir)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to pack: %s", err)
+		return
+	}
+
+	window.status = fmt.Sprintf("Packed %d files to %s", count, dir)
+}
+
+func (window *PackWindow) packToZip(fs filesystem.IFileSystem) {
+	filename, err := dialog.File().Filter("Zip archive", "zip").Title("Pack to zip").Save()
+	if err != nil {
+		return
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		filename += ".zip"
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to create %s: %s", filename, err)
+		return
+	}
+	defer file.Close()
+
+	count, err := formats.WritePackZip(fs, window.files, file)
+	if err != nil {
+		window.status = fmt.Sprintf("Unable to pack: %s", err)
+		return
+	}
+
+	window.status = fmt.Sprintf("Packed %d files to %s", count, filename)
+}
+
+// Render draws the window. dryRun is called to work out the files again
+func (window *PackWindow) Render(fs filesystem.IFileSystem, shouldOpen *bool, dryRun func()) {
+	if imgui.BeginV("Pack map", shouldOpen, 0) {
+		if imgui.Button("Dry run") {
+			dryRun()
+		}
+		imgui.SameLine()
+		if imgui.Button("Pack to folder...") {
+			window.packToDirectory(fs)
+		}
+		imgui.SameLine()
+		if imgui.Button("Pack to zip...") {
+			window.packToZip(fs)
+		}
+
+		pack, stock, missing := window.counts()
+		imgui.Text(fmt.Sprintf("%d files to pack, %d stock, %d missing", pack, stock, missing))
+		imgui.Checkbox("Show stock files", &window.showStock)
+
+		if window.status != "" {
+			imgui.PushTextWrapPosV(0)
+			imgui.Text(window.status)
+			imgui.PopTextWrapPos()
+		}
+
+		imgui.Separator()
+
+		if imgui.BeginChildV("Pack files", imgui.Vec2{0, 0}, false, 0) {
+			for _, f := range window.files {
+				if f.Stock && !window.showStock {
+					continue
+				}
+
+				label := f.Path
+				switch {
+				case f.Missing:
+					label += " (missing)"
+				case f.Stock:
+					label += " (stock)"
+				}
+
+				imgui.Text(label)
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("Needed by " + f.ReferencedBy)
+				}
+			}
+		}
+		imgui.EndChild()
+	}
+	imgui.End()
+}
@@ -0,0 +1,59 @@
+package windows
+
+import (
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+)
+
+// PasteSpecialWindow asks for how many copies to paste and how to transform them
+type PasteSpecialWindow struct {
+	copies      int32
+	offset      [3]float32
+	rotation    [3]float32
+	uniqueNames bool
+}
+
+func NewPasteSpecialWindow() *PasteSpecialWindow {
+	return &PasteSpecialWindow{
+		copies:      1,
+		uniqueNames: true,
+	}
+}
+
+// Render draws the window and returns the options to paste with once the user accepts
+func (window *PasteSpecialWindow) Render(shouldOpen *bool) (*formats.PasteOptions, bool) {
+	var options *formats.PasteOptions
+
+	if imgui.BeginV("Paste Special", shouldOpen, imgui.WindowFlagsAlwaysAutoResize) {
+		imgui.SliderInt("Copies", &window.copies, 1, 64)
+
+		imgui.Text("Offset (each copy)")
+		imgui.DragFloatV("X##offset", &window.offset[0], 1, -16384, 16384, "%.2f", 1)
+		imgui.DragFloatV("Y##offset", &window.offset[1], 1, -16384, 16384, "%.2f", 1)
+		imgui.DragFloatV("Z##offset", &window.offset[2], 1, -16384, 16384, "%.2f", 1)
+
+		imgui.Text("Rotation (each copy)")
+		imgui.DragFloatV("X##rotation", &window.rotation[0], 1, -360, 360, "%.2f", 1)
+		imgui.DragFloatV("Y##rotation", &window.rotation[1], 1, -360, 360, "%.2f", 1)
+		imgui.DragFloatV("Z##rotation", &window.rotation[2], 1, -360, 360, "%.2f", 1)
+
+		imgui.Checkbox("Make names unique", &window.uniqueNames)
+
+		if imgui.Button("Paste") {
+			options = &formats.PasteOptions{
+				Copies:      int(window.copies),
+				Offset:      window.offset,
+				Rotation:    window.rotation,
+				UniqueNames: window.uniqueNames,
+			}
+			*shouldOpen = false
+		}
+		imgui.SameLine()
+		if imgui.Button("Cancel") {
+			*shouldOpen = false
+		}
+	}
+	imgui.End()
+
+	return options, options != nil
+}
@@ -0,0 +1,42 @@
+package windows
+
+import (
+	"fmt"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+	"github.com/sqweek/dialog"
+)
+
+// renderPngExportOptions draws the choices for exporting pngs.
+// Compositing alpha only means something for materials
+func renderPngExportOptions(options *formats.PngExportOptions, material bool) {
+	imgui.Checkbox("All frames", &options.AllFrames)
+	imgui.SameLine()
+	imgui.Checkbox("All faces", &options.AllFaces)
+	imgui.SameLine()
+	imgui.Checkbox("All mips", &options.AllMips)
+
+	if material {
+		imgui.SameLine()
+		imgui.Checkbox("Composite alpha", &options.CompositeAlpha)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Bake how the material uses its alpha (translucency, alpha testing and $alpha) into the png")
+		}
+	}
+}
+
+// exportPngs asks for a directory and exports to it. Returns a status to show
+func exportPngs(title string, export func(dir string) ([]string, error)) string {
+	dir, err := dialog.Directory().Title(title).Browse()
+	if err != nil {
+		return ""
+	}
+
+	written, err := export(dir)
+	if err != nil {
+		return fmt.Sprintf("Unable to export: %s", err)
+	}
+
+	return fmt.Sprintf("Exported %d images to %s", len(written), dir)
+}
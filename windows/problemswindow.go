@@ -0,0 +1,73 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/imgui-go"
+)
+
+// RenderProblemsWindow lists the assets that the map refers to that cannot be found
+func RenderProblemsWindow(shouldOpen *bool, problems []*formats.AssetReference,
+	onRefresh func(), onSelect func(asset *formats.AssetReference)) {
+
+	if imgui.BeginV("Problems", shouldOpen, 0) {
+		if imgui.Button("Check again") {
+			onRefresh()
+		}
+
+		imgui.SameLine()
+		imgui.Text(fmt.Sprintf("%d missing assets", len(problems)))
+
+		imgui.Separator()
+
+		for kind, name := range formats.AssetKinds {
+			assets := make([]*formats.AssetReference, 0)
+			for _, p := range problems {
+				if p.Kind == kind {
+					assets = append(assets, p)
+				}
+			}
+
+			if len(assets) == 0 {
+				continue
+			}
+
+			if imgui.TreeNode(fmt.Sprintf("%ss (%d)", name, len(assets))) {
+				for i, asset := range assets {
+					label := fmt.Sprintf("%s (%d)##%s%d", asset.Name, asset.Count, name, i)
+					if imgui.SelectableV(label, false, 0, imgui.Vec2{}) {
+						onSelect(asset)
+					}
+
+					if imgui.IsItemHovered() {
+						imgui.SetTooltip(assetTooltip(asset))
+					}
+				}
+				imgui.TreePop()
+			}
+		}
+	}
+	imgui.End()
+}
+
+func assetTooltip(asset *formats.AssetReference) string {
+	lines := []string{fmt.Sprintf("Looked for %s", asset.Path)}
+
+	if len(asset.Solids) > 0 {
+		lines = append(lines, fmt.Sprintf("%d solids", len(asset.Solids)))
+	}
+	if len(asset.Entities) > 0 {
+		ids := make([]string, 0, len(asset.Entities))
+		for _, e := range asset.Entities {
+			ids = append(ids, fmt.Sprintf("%d", e))
+		}
+		lines = append(lines, fmt.Sprintf("Entities: %s", strings.Join(ids, ", ")))
+	}
+	if len(asset.Solids) > 0 || len(asset.Entities) > 0 {
+		lines = append(lines, "Click to select them")
+	}
+
+	return strings.Join(lines, "\n")
+}
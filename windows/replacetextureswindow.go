@@ -0,0 +1,103 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emily33901/go-forgery/formats"
+	"github.com/emily33901/go-forgery/render/lazy"
+	"github.com/emily33901/go-forgery/render/view"
+	"github.com/emily33901/imgui-go"
+	"github.com/emily33901/lambda-core/core/filesystem"
+)
+
+// ReplaceTexturesWindow finds and replaces materials over the selection or the whole vmf
+type ReplaceTexturesWindow struct {
+	find    string
+	replace string
+	mode    int
+
+	selectionOnly   bool
+	includeEntities bool
+	rescaleUVs      bool
+
+	lastResult string
+}
+
+func NewReplaceTexturesWindow() *ReplaceTexturesWindow {
+	return &ReplaceTexturesWindow{
+		includeEntities: true,
+	}
+}
+
+// SetReplace sets the replace field, used to fill in the material that is selected in the materials window
+func (window *ReplaceTexturesWindow) SetReplace(name string) {
+	window.replace = name
+}
+
+// Render draws the window. selection is the set of currently selected solids
+// and entitySelection the indices of the selected entities
+func (window *ReplaceTexturesWindow) Render(fs filesystem.IFileSystem, shouldOpen *bool, vmf *formats.Vmf, scene *view.Scene,
+	selection map[int]bool, entitySelection map[int]bool) {
+	if imgui.BeginV("Replace Textures", shouldOpen, imgui.WindowFlagsAlwaysAutoResize) {
+		imgui.InputText("Find", &window.find)
+		imgui.InputText("Replace with", &window.replace)
+
+		if imgui.BeginCombo("Match", formats.MatchModes[window.mode]) {
+			for i, x := range formats.MatchModes {
+				if imgui.Selectable(x) {
+					window.mode = i
+				}
+			}
+			imgui.EndCombo()
+		}
+
+		imgui.Checkbox("Selection only", &window.selectionOnly)
+		imgui.Checkbox("Include entities", &window.includeEntities)
+		imgui.Checkbox("Rescale texture scale", &window.rescaleUVs)
+
+		if imgui.Button("Replace") && vmf != nil {
+			r := &formats.MaterialReplacement{
+				Find:            window.find,
+				Replace:         window.replace,
+				Mode:            window.mode,
+				IncludeEntities: window.includeEntities,
+				RescaleUVs:      window.rescaleUVs,
+				TextureSize: func(name string) (int, int, bool) {
+					// Make sure that the material has been loaded first
+					name = strings.ToLower(name)
+					lazy.LoadSingleLazyMaterial(name, fs)
+					return lazy.MaterialDimensions(name)
+				},
+			}
+
+			if window.selectionOnly {
+				r.Solids = selection
+				if r.Solids == nil {
+					r.Solids = map[int]bool{}
+				}
+				r.Entities = entitySelection
+			}
+
+			result, err := vmf.ReplaceMaterials(r)
+
+			if err != nil {
+				window.lastResult = fmt.Sprintf("Error: %s", err)
+			} else {
+				window.lastResult = fmt.Sprintf("Replaced %d faces on %d solids and %d entities",
+					result.Sides, len(result.ChangedSolids), result.Entities)
+
+				// Update the meshes for everything that changed
+				for _, id := range result.ChangedSolids {
+					scene.RebuildSolid(id)
+				}
+			}
+		}
+
+		if window.lastResult != "" {
+			imgui.Separator()
+			imgui.Text(window.lastResult)
+		}
+	}
+	imgui.End()
+}
@@ -54,6 +54,8 @@ type SceneWindow struct {
 
 	scene  *view.Scene
 	camera string
+	// The camera that was made for this window
+	ownCamera string
 
 	cameraSens     *float32
 	cameraMoveSens *float32
@@ -69,6 +71,9 @@ type SceneWindow struct {
 
 	renderType int
 
+	// One of render.ToolTexturesShow, ToolTexturesGhost or ToolTexturesHide
+	toolTextures int
+
 	// TODO: needs to be replaced with a smarter structure
 	// selectionToMake     mgl32.Vec2
 	selectionResult selectionResult
@@ -76,6 +81,12 @@ type SceneWindow struct {
 	// segmentOrigin       mgl32.Vec3
 	selectionValid bool
 
+	// All of the solids that are selected, this can be more than
+	// the one that was clicked on if it is part of a group
+	selectedSolids   []int
+	expandSelection  func(id int) []int
+	selectionChanged func()
+
 	selectedMeshHelper *render.MeshHelper
 
 	selectionMesh *render.MeshHelper
@@ -104,6 +115,7 @@ func NewSceneWindow(
 		renderer:           renderer,
 		scene:              scene,
 		camera:             camera,
+		ownCamera:          camera,
 		width:              width,
 		height:             height,
 		cameraSens:         cameraSens,
@@ -131,8 +143,6 @@ func (window *SceneWindow) Initialize() {
 
 // SelectionChanged handles updating what meshes have been selected
 func (window *SceneWindow) SelectionChanged(selectionToMake mgl32.Vec2) {
-	selectionColor := []float32{1, 0, 0, 0.5}
-
 	// Handle object selection
 
 	aspect := window.wSize.X / window.wSize.Y
@@ -166,15 +176,25 @@ func (window *SceneWindow) SelectionChanged(selectionToMake mgl32.Vec2) {
 						continue
 					}
 
+					// Faces that are hidden in this view cannot be clicked on
+					side := mesh.Meta("side").(int)
+					if window.toolTextures == render.ToolTexturesHide && window.scene.SideFlags(solidId, side).Has(formats.SurfaceTool) {
+						continue
+					}
+
 					// We need to project the point to get the depth of the collision
 					depth := mgl32.Project(point, view, proj, 0, 0, int(window.wSize.X), int(window.wSize.Y))
 
-					selectionResults[point] = selectionResult{solidId, mesh.Meta("side").(int), depth.Z()}
+					selectionResults[point] = selectionResult{solidId, side, depth.Z()}
 				}
 			}
 		}
 	}
 
+	if window.selectionChanged != nil {
+		defer window.selectionChanged()
+	}
+
 	if len(selectionResults) == 0 {
 		window.selectionValid = false
 		return
@@ -196,32 +216,21 @@ func (window *SceneWindow) SelectionChanged(selectionToMake mgl32.Vec2) {
 		}
 	}
 
-	resultModel := window.scene.SolidMeshes[selectionResults[minResult].solid]
-
-	// Select the mesh that is selected
-	if resultModel != nil {
-		window.selectedMeshHelper.ResetMesh()
-
-		mesh := window.selectedMeshHelper.Mesh()
-
-		for _, m := range resultModel.Meshes() {
-			window.selectedMeshHelper.AddMesh(m)
-		}
-
-		newColors := make([]float32, 0, len(mesh.Vertices())*4)
-		for range mesh.Vertices() {
-			newColors = append(newColors, selectionColor...)
-		}
-
-		window.selectedMeshHelper.Mesh().ResetColors(newColors...)
+	selected := []int{selectionResults[minResult].solid}
+	if window.expandSelection != nil {
+		selected = window.expandSelection(selected[0])
 	}
 
+	window.SelectSolids(selected)
+
 	window.selectionResult = selectionResults[minResult]
 
 	window.selectionValid = true
 }
 
 func (window *SceneWindow) RenderScene() {
+	window.scene.Update()
+
 	dirtyComposition := window.scene.FrameCompositor.IsOutdated()
 	if dirtyComposition {
 		window.scene.RecomposeScene()
@@ -237,7 +246,7 @@ func (window *SceneWindow) RenderScene() {
 	}
 
 	window.window.Bind(window.wSize.X, window.wSize.Y)
-	window.renderer.DrawComposition(window.scene.FrameComposed, window.scene.Composition(), window.renderType)
+	window.renderer.DrawComposition(window.scene.FrameComposed, window.scene.Composition(), window.renderType, window.toolTextures)
 	window.graphicsAdapter.Error()
 
 	// Render other misc items (axes, selectionpoint)...
@@ -318,6 +327,15 @@ func (window *SceneWindow) Render(deltaTime float32) {
 					imgui.EndCombo()
 				}
 
+				if imgui.BeginCombo("Tool textures", render.ToolTextureModes[window.toolTextures]) {
+					for i, v := range render.ToolTextureModes {
+						if imgui.Selectable(v) {
+							window.toolTextures = i
+						}
+					}
+					imgui.EndCombo()
+				}
+
 				if imgui.MenuItem("Reset position") {
 					window.Camera().SetPos(mgl32.Vec3{0, 0, 0})
 				}
@@ -469,7 +487,17 @@ func (window *SceneWindow) Render(deltaTime float32) {
 
 		if window.selectionValid != false {
 			if imgui.BeginPopupContextItemV("selection popup", 1) {
-				imgui.Text(fmt.Sprintf("Selected solid_%d by side_%d", window.selectionResult.solid, window.selectionResult.side))
+				if window.selectionResult.side == -1 {
+					imgui.Text(fmt.Sprintf("Selected solid_%d", window.selectionResult.solid))
+				} else {
+					imgui.Text(fmt.Sprintf("Selected solid_%d by side_%d", window.selectionResult.solid, window.selectionResult.side))
+				}
+				if flags := window.scene.SideFlags(window.selectionResult.solid, window.selectionResult.side); flags != 0 {
+					imgui.Text(fmt.Sprintf("Side is %s", flags))
+				}
+				if len(window.selectedSolids) > 1 {
+					imgui.Text(fmt.Sprintf("%d solids in group", len(window.selectedSolids)))
+				}
 				imgui.EndPopup()
 			}
 		}
@@ -506,6 +534,78 @@ func (window *SceneWindow) Render(deltaTime float32) {
 // 	window.window = renderer.NewRenderWindow(window.graphicsAdapter, window.width, window.height)
 // }
 
+// SelectSolids highlights the solids with ids as the selection
+func (window *SceneWindow) SelectSolids(ids []int) {
+	selectionColor := []float32{1, 0, 0, 0.5}
+
+	window.selectedMeshHelper.ResetMesh()
+	window.selectedSolids = window.selectedSolids[:0]
+
+	for _, id := range ids {
+		resultModel := window.scene.SolidMeshes[id]
+		if resultModel == nil {
+			continue
+		}
+
+		for _, m := range resultModel.Meshes() {
+			window.selectedMeshHelper.AddMesh(m)
+		}
+
+		window.selectedSolids = append(window.selectedSolids, id)
+	}
+
+	// Selections that were not clicked on have no side
+	window.selectionValid = len(window.selectedSolids) != 0
+	if window.selectionValid {
+		window.selectionResult = selectionResult{solid: window.selectedSolids[0], side: -1}
+	}
+
+	mesh := window.selectedMeshHelper.Mesh()
+
+	newColors := make([]float32, 0, len(mesh.Vertices())*4)
+	for range mesh.Vertices() {
+		newColors = append(newColors, selectionColor...)
+	}
+
+	mesh.ResetColors(newColors...)
+}
+
+// SetSelectionExpander sets what is used to work out what else should be selected
+// along with a solid that is clicked on (e.g. the rest of its group)
+func (window *SceneWindow) SetSelectionExpander(expand func(id int) []int) {
+	window.expandSelection = expand
+}
+
+// SetSelectionChanged sets what is called when the selection is changed by clicking in the window
+func (window *SceneWindow) SetSelectionChanged(changed func()) {
+	window.selectionChanged = changed
+}
+
+// SelectedSolids returns the ids of the currently selected solids
+func (window *SceneWindow) SelectedSolids() []int {
+	if !window.selectionValid {
+		return nil
+	}
+
+	return window.selectedSolids
+}
+
+// ClearSelection deselects whatever is selected in this window
+func (window *SceneWindow) ClearSelection() {
+	window.selectionValid = false
+	window.selectedSolids = window.selectedSolids[:0]
+	window.selectedMeshHelper.ResetMesh()
+}
+
+// SetScene switches the window over to showing scene (when another map is opened)
+func (window *SceneWindow) SetScene(scene *view.Scene) {
+	window.ClearSelection()
+
+	scene.AddCamera(formats.NewCamera(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, -1}), window.ownCamera)
+	window.camera = window.ownCamera
+	window.scene = scene
+}
+
 func (window *SceneWindow) HasClosed() bool {
 	return !window.open
 }